@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/temporalio/promql-to-dd-go/worker"
+)
+
+// repeatableFlags are set once per element of a YAML sequence rather than from the comma
+// joined sequence.
+var repeatableFlags = map[string]bool{"promql-template": true, "histogram-unit": true, "discovery-matcher": true, "histogram-quantiles": true, "metric-type": true}
+
+// repeatedFlag collects every value of a flag given several times.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *repeatedFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func (f *repeatedFlag) reset() {
+	*f = nil
+}
+
+// commandLineFlags returns the names of the flags set on the command line, which the config
+// file does not override.
+func commandLineFlags(set *flag.FlagSet) map[string]bool {
+	explicit := map[string]bool{}
+	set.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return explicit
+}
+
+// applyConfigFile sets the flags of set from the YAML file at path, a mapping from flag names
+// without the leading dash to values. Scalars are used as they are, sequences are joined with
+// commas and mappings are joined as comma separated key=value pairs, matching the flag
+// syntax. Flags in explicit, given on the command line, override the file. Unknown keys and
+// values the flag rejects fail, so that a typo does not silently fall back to a default.
+func applyConfigFile(set *flag.FlagSet, path string, explicit map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading config file: %w", err)
+	}
+	var values map[string]yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed parsing config file %s: %w", path, err)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "config" || set.Lookup(name) == nil {
+			return fmt.Errorf("unknown key %q in config file %s", name, path)
+		}
+		node := values[name]
+		raw, err := configValues(name, &node)
+		if err != nil {
+			return fmt.Errorf("invalid key %q in config file %s: %w", name, path, err)
+		}
+		if explicit[name] {
+			continue
+		}
+		for _, v := range raw {
+			if err := set.Set(name, v); err != nil {
+				return fmt.Errorf("invalid key %q in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues returns the flag values of node.
+func configValues(name string, node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		items := make([]string, len(node.Content))
+		for i, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: expected a list of scalars", item.Line)
+			}
+			items[i] = item.Value
+		}
+		if repeatableFlags[name] {
+			return items, nil
+		}
+		return []string{strings.Join(items, ",")}, nil
+	case yaml.MappingNode:
+		pairs := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if k.Kind != yaml.ScalarNode || v.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: expected a mapping of scalars", k.Line)
+			}
+			pairs = append(pairs, k.Value+"="+v.Value)
+		}
+		return []string{strings.Join(pairs, ",")}, nil
+	default:
+		return nil, fmt.Errorf("line %d: unsupported value", node.Line)
+	}
+}
+
+// reloadConfigFile resets the flags not in explicit to their defaults and applies the config
+// file again, so that keys removed from the file fall back to their defaults too.
+func reloadConfigFile(set *flag.FlagSet, path string, explicit map[string]bool) error {
+	var err error
+	set.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+		if r, ok := f.Value.(interface{ reset() }); ok {
+			r.reset()
+			return
+		}
+		if setErr := f.Value.Set(f.DefValue); setErr != nil && err == nil {
+			err = fmt.Errorf("failed resetting -%s: %w", f.Name, setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return applyConfigFile(set, path, explicit)
+}
+
+// reloadOnHangup reloads the config file on every SIGHUP and sends the resulting settings to
+// reloads until ctx is done. A file that fails to load or parse is logged and the current
+// settings kept. Only the flags covered by worker.Settings take effect without a restart.
+func reloadOnHangup(ctx context.Context, set *flag.FlagSet, path string, explicit map[string]bool, settings func() (worker.Settings, error), reloads chan<- worker.Settings) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-hangups:
+		case <-ctx.Done():
+			return
+		}
+		slog.Info("Reloading config file", "path", path)
+		if err := reloadConfigFile(set, path, explicit); err != nil {
+			slog.Error("Failed reloading config file, keeping the current configuration", "error", err)
+			continue
+		}
+		s, err := settings()
+		if err != nil {
+			slog.Error("Invalid reloaded configuration, keeping the current configuration", "error", err)
+			continue
+		}
+		select {
+		case reloads <- s:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/worker"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	prefixes := set.String("metric-prefixes", "", "")
+	quantiles := set.String("quantiles", "0.5,0.9,0.95,0.99", "")
+	step := set.Int("step-duration-seconds", 60, "")
+	dedup := set.Bool("dedup", false, "")
+	headers := set.String("otlp-headers", "", "")
+	logLevel := set.String("log-level", "info", "")
+	var templates []string
+	set.Func("promql-template", "", func(s string) error {
+		templates = append(templates, s)
+		return nil
+	})
+
+	path := writeConfigFile(t, `
+metric-prefixes: [temporal_cloud_v0_, temporal_cloud_v1_]
+quantiles:
+  - 0.5
+  - 0.99
+step-duration-seconds: 30
+dedup: true
+otlp-headers:
+  x-team: observability
+log-level: info
+promql-template:
+  - replication_lag=max({{.Selector}})
+  - gc_pause=max({{.Selector}}) by (temporal_namespace)
+`)
+	require.NoError(t, set.Parse([]string{"-log-level", "debug"}))
+	require.NoError(t, applyConfigFile(set, path, commandLineFlags(set)))
+
+	assert.Equal(t, "temporal_cloud_v0_,temporal_cloud_v1_", *prefixes)
+	assert.Equal(t, 30, *step)
+	assert.True(t, *dedup)
+	assert.Equal(t, map[string]string{"x-team": "observability"}, splitMap(*headers))
+	assert.Equal(t, "debug", *logLevel, "command line flags take precedence")
+	assert.Len(t, templates, 2)
+
+	parsed, err := worker.ParseQuantiles(*quantiles)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.5, 0.99}, parsed)
+	for _, raw := range templates {
+		_, err := worker.ParseQueryTemplate(raw)
+		assert.NoError(t, err, raw)
+	}
+}
+
+func TestConfigFileConfiguresWorker(t *testing.T) {
+	path := writeConfigFile(t, `
+metric-prefixes: [temporal_cloud_v0_, temporal_cloud_v1_]
+quantiles: [0.5, 0.99]
+step-duration-seconds: 30
+query-interval-seconds: 300
+dedup: true
+best-effort-queries: true
+non-finite: zero
+cardinality-action: drop
+max-series-per-metric: 500
+namespace-allow: [prod-.*]
+relabel: drop:region
+quantile-style: dotted
+promql-template:
+  - replication_lag=max({{.Selector}})
+  - gc_pause=max({{.Selector}}) by (temporal_namespace)
+`)
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	o := newOptions(set)
+	explicit, err := o.parse(set, []string{"-config", path, "-step-duration-seconds", "15", "-dry-run"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"config": true, "step-duration-seconds": true, "dry-run": true}, explicit)
+
+	w, err := o.newWorker()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_cloud_v0_", "temporal_cloud_v1_"}, w.MetricPrefixes)
+	assert.Equal(t, []float64{0.5, 0.99}, w.Quantiles)
+	assert.Equal(t, 15*time.Second, w.StepDuration, "command line flags take precedence")
+	assert.Equal(t, 5*time.Minute, w.QueryInterval)
+	assert.True(t, w.Deduplicate)
+	assert.True(t, w.BestEffortQueries)
+	assert.True(t, w.DryRun)
+	assert.Equal(t, worker.NonFiniteZero, w.NonFinite)
+	assert.Equal(t, worker.CardinalityDrop, w.CardinalityAction)
+	assert.Equal(t, 500, w.MaxSeriesPerMetric)
+	assert.Equal(t, []string{"prod-.*"}, w.NamespaceAllow)
+	assert.Equal(t, worker.Relabeling{{Action: worker.RelabelDrop, Source: "region"}}, w.Relabeling)
+	assert.Equal(t, worker.QuantileStyleDotted, w.QuantileNaming.Style)
+	assert.Len(t, w.QueryTemplates, 2)
+	assert.Equal(t, 10*time.Second, w.QueryTimeout, "keys missing from the file keep their defaults")
+}
+
+func TestHealthServerIsOptIn(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	o := newOptions(set)
+	_, err := o.parse(set, nil)
+	require.NoError(t, err)
+	assert.Empty(t, *o.healthAddr, "no listener is opened unless asked for")
+
+	set = flag.NewFlagSet("test", flag.ContinueOnError)
+	o = newOptions(set)
+	_, err = o.parse(set, []string{"-config", writeConfigFile(t, "health-addr: \":8080\"\n")})
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", *o.healthAddr)
+}
+
+func TestApplyConfigFileErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown key", content: "quantile: 0.99\n", wantErr: `unknown key "quantile"`},
+		{name: "config key", content: "config: other.yaml\n", wantErr: `unknown key "config"`},
+		{name: "invalid value", content: "step-duration-seconds: one\n", wantErr: `invalid key "step-duration-seconds"`},
+		{name: "nested list", content: "quantiles: [[0.5]]\n", wantErr: "expected a list of scalars"},
+		{name: "not a mapping", content: "- quantiles\n", wantErr: "failed parsing config file"},
+	}
+
+	for _, tc := range testCases {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.String("config", "", "")
+		set.String("quantiles", "", "")
+		set.Int("step-duration-seconds", 60, "")
+		err := applyConfigFile(set, writeConfigFile(t, tc.content), nil)
+		assert.ErrorContains(t, err, tc.wantErr, tc.name)
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	assert.NoError(t, applyConfigFile(set, writeConfigFile(t, ""), nil), "an empty file sets nothing")
+	assert.ErrorContains(t, applyConfigFile(set, filepath.Join(t.TempDir(), "missing.yaml"), nil), "failed reading config file")
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	quantiles := set.String("quantiles", "0.5,0.9,0.95,0.99", "")
+	allow := set.String("namespace-allow", "", "")
+	logLevel := set.String("log-level", "info", "")
+	var templates repeatedFlag
+	set.Var(&templates, "promql-template", "")
+
+	require.NoError(t, set.Parse([]string{"-log-level", "debug"}))
+	explicit := commandLineFlags(set)
+	path := writeConfigFile(t, `
+quantiles: [0.99]
+namespace-allow: [prod-.*]
+log-level: warn
+promql-template:
+  - replication_lag=max({{.Selector}})
+`)
+	require.NoError(t, applyConfigFile(set, path, explicit))
+	assert.Equal(t, "0.99", *quantiles)
+	assert.Equal(t, "prod-.*", *allow)
+	assert.Len(t, templates, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("quantiles: [0.5, 0.95]\nlog-level: warn\n"), 0o600))
+	require.NoError(t, reloadConfigFile(set, path, explicit))
+	assert.Equal(t, "0.5,0.95", *quantiles)
+	assert.Empty(t, *allow, "keys removed from the file fall back to their defaults")
+	assert.Empty(t, templates, "repeated flags are cleared, not appended to")
+	assert.Equal(t, "debug", *logLevel, "command line flags still take precedence")
+}
@@ -1,60 +1,441 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	"github.com/temporalio/promql-to-dd-go/datadog"
+	"github.com/temporalio/promql-to-dd-go/health"
+	"github.com/temporalio/promql-to-dd-go/otlp"
 	"github.com/temporalio/promql-to-dd-go/prometheus"
+	"github.com/temporalio/promql-to-dd-go/remotewrite"
 	"github.com/temporalio/promql-to-dd-go/worker"
 )
 
+// version and commit are set at build time with -ldflags "-X main.version=... -X main.commit=...".
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 func main() {
 	set := flag.NewFlagSet("app", flag.ExitOnError)
-	promURL := set.String("prom-endpoint", "", "Prometheus API endpoint for the server")
-	serverRootCACert := set.String("server-root-ca-cert", "", "Optional path to root server CA cert")
-	clientCert := set.String("client-cert", "", "Required path to client cert")
-	clientKey := set.String("client-key", "", "Required path to client key")
-	serverName := set.String("server-name", "", "Server name to use for verifying the server's certificate")
-	insecureSkipVerify := set.Bool("insecure-skip-verify", false, "Skip verification of the server's certificate and host name")
-	matrixPrefix := set.String("matrix-prefix", "temporal_cloud_", "Prefix of the metrics to be queried and send to Datadog")
-	stepDuration := set.Int("step-duration-seconds", 60, "The step between metrics")
-	queryInterval := set.Int("query-interval-seconds", 600, "Interval between each Prometheus query")
-	sleepDuration := set.Int("sleep-duration-seconds", 60, "Sleep duration between each data submission")
-
-	if err := set.Parse(os.Args[1:]); err != nil {
-		log.Fatalf("failed parsing args: %s", err)
-	} else if *clientCert == "" || *clientKey == "" {
-		log.Fatalf("-client-cert and -client-key are required")
-	}
-
-	datadogClient := datadog.NewAPIClient()
-
-	prometheusClient, err := prometheus.NewAPIClient(
-		prometheus.Config{
-			TargetHost:         *promURL,
-			ServerRootCACert:   *serverRootCACert,
-			ClientCert:         *clientCert,
-			ClientKey:          *clientKey,
-			ServerName:         *serverName,
-			InsecureSkipVerify: *insecureSkipVerify,
-		},
-	)
+	o := newOptions(set)
+
+	explicit, err := o.parse(set, os.Args[1:])
+	if err != nil {
+		fatal("Failed parsing args", "error", err)
+	}
+
+	logger, err := newLogger(os.Stderr, *o.logLevel, *o.logFormat)
 	if err != nil {
-		log.Fatalf("Failed to create Prometheus client: %s", err)
+		fatal("Failed to configure logging", "error", err)
+	}
+	slog.SetDefault(logger)
+
+	if *o.tenantsFile == "" && (*o.clientCert == "" || *o.clientKey == "") && *o.bearerToken == "" && *o.bearerTokenFile == "" && *o.basicAuthUsername == "" {
+		fatal("-client-cert and -client-key are required unless -bearer-token, -bearer-token-file or -basic-auth-username is set")
+	}
+
+	initialSettings, err := o.settings()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if err := worker.ValidateOverlapFactor(*o.overlapFactor); err != nil {
+		fatal("Invalid -overlap-factor", "error", err)
+	}
+	if err := worker.ValidateJitter(*o.sleepJitter); err != nil {
+		fatal("Invalid -sleep-jitter", "error", err)
+	}
+	var classifier prometheus.Classifier
+	if len(o.metricTypeFlags) > 0 {
+		rules := prometheus.RuleClassifier{}
+		for _, raw := range o.metricTypeFlags {
+			rule, err := prometheus.ParseClassRule(raw)
+			if err != nil {
+				fatal("Failed parsing -metric-type", "error", err)
+			}
+			rules.Rules = append(rules.Rules, rule)
+		}
+		classifier = rules
+	}
+
+	var from, to time.Time
+	if *o.backfillFrom != "" {
+		if from, err = time.Parse(time.RFC3339, *o.backfillFrom); err != nil {
+			fatal("Failed parsing -backfill-from", "error", err)
+		}
+		to = time.Now()
+		if *o.backfillTo != "" {
+			if to, err = time.Parse(time.RFC3339, *o.backfillTo); err != nil {
+				fatal("Failed parsing -backfill-to", "error", err)
+			}
+		}
+	}
+
+	outputFailurePolicy, err := datadog.ParseFailurePolicy(*o.outputFailurePolicyFlag)
+	if err != nil {
+		fatal("Failed parsing -output-failure-policy", "error", err)
+	}
+
+	datadogConfig := datadog.Config{
+		MaxBatchSize:         *o.maxBatchSize,
+		SubmitConcurrency:    *o.submitConcurrency,
+		StaticTags:           splitList(*o.staticTags),
+		SourceName:           *o.sourceName,
+		SourceTagKey:         *o.sourceTagKey,
+		Site:                 *o.datadogSite,
+		RateLimit:            *o.datadogRateLimit,
+		RateLimitBurst:       *o.datadogRateLimitBurst,
+		APIKeyFile:           *o.datadogAPIKeyFile,
+		APIKeyReloadInterval: time.Duration(*o.datadogAPIKeyReloadInterval) * time.Second,
+		ProxyURL:             *o.proxyURL,
+		DisableCompression:   !*o.datadogCompression,
+		ApplicationKey:       *o.datadogApplicationKey,
+		SubmitMetadata:       *o.datadogMetadata,
+		MaxIdleConns:         *o.datadogMaxIdleConns,
+		IdleConnTimeout:      time.Duration(*o.datadogIdleConnTimeout) * time.Second,
+	}
+
+	var tenantConfigs []tenantConfig
+	if *o.tenantsFile != "" {
+		if tenantConfigs, err = loadTenants(*o.tenantsFile); err != nil {
+			fatal("Failed loading -tenants-file", "error", err)
+		}
+		if *o.output != "datadog" {
+			fatal("-tenants-file requires -output=datadog, the only output with per-tenant credentials")
+		}
+		if *o.discover || *o.backfillFrom != "" {
+			fatal("-discover and -backfill-from are not supported with -tenants-file")
+		}
+	}
+
+	outputs := splitList(*o.output)
+	if len(tenantConfigs) > 0 {
+		// Every tenant gets its own Datadog client below.
+		outputs = nil
+	}
+	var submitters []datadog.Submitter
+	var maxPointAge time.Duration
+	if len(tenantConfigs) > 0 {
+		maxPointAge = datadog.MaxPointAge
+	}
+	for _, name := range outputs {
+		var outputSubmitter datadog.Submitter
+		switch name {
+		case "datadog":
+			outputSubmitter, err = datadog.NewAPIClient(datadogConfig)
+			if err != nil {
+				fatal("Failed to create Datadog client", "error", err)
+			}
+			maxPointAge = datadog.MaxPointAge
+		case "otlp":
+			outputSubmitter, err = otlp.NewAPIClient(
+				otlp.Config{
+					Endpoint: *o.otlpEndpoint,
+					Headers:  splitMap(*o.otlpHeaders),
+					ProxyURL: *o.proxyURL,
+				},
+			)
+			if err != nil {
+				fatal("Failed to create OTLP client", "error", err)
+			}
+		case "remote-write":
+			outputSubmitter, err = remotewrite.NewAPIClient(
+				remotewrite.Config{
+					URL:         *o.remoteWriteURL,
+					BearerToken: *o.remoteWriteBearerToken,
+					Username:    *o.remoteWriteUsername,
+					Password:    *o.remoteWritePassword,
+					ProxyURL:    *o.proxyURL,
+				},
+			)
+			if err != nil {
+				fatal("Failed to create remote-write client", "error", err)
+			}
+		case "stdout":
+			outputSubmitter = datadog.NewStdoutSubmitter(os.Stdout)
+		default:
+			fatal("Unsupported -output, expected datadog, otlp, remote-write or stdout", "output", name)
+		}
+		submitters = append(submitters, outputSubmitter)
+	}
+	var submitter datadog.Submitter
+	switch len(submitters) {
+	case 0:
+		if len(tenantConfigs) == 0 {
+			fatal("-output is required")
+		}
+	case 1:
+		submitter = submitters[0]
+	default:
+		submitter = datadog.NewMultiSubmitter(outputFailurePolicy, submitters...)
+	}
+
+	prometheusConfig := prometheus.Config{
+		TargetHost:         *o.promURL,
+		ServerRootCACert:   *o.serverRootCACert,
+		ClientCert:         *o.clientCert,
+		ClientKey:          *o.clientKey,
+		BearerToken:        *o.bearerToken,
+		BearerTokenFile:    *o.bearerTokenFile,
+		BasicAuthUsername:  *o.basicAuthUsername,
+		BasicAuthPassword:  *o.basicAuthPassword,
+		ChunkedDiscovery:   *o.chunkedDiscovery,
+		DiscoveryMatchers:  o.discoveryMatcherFlags,
+		IncludeMetrics:     splitList(*o.includeMetrics),
+		ExcludeMetrics:     splitList(*o.excludeMetrics),
+		Classifier:         classifier,
+		ProxyURL:           *o.proxyURL,
+		ServerName:         *o.serverName,
+		InsecureSkipVerify: *o.insecureSkipVerify,
+	}
+
+	// newQuerier creates the Prometheus client of cfg, wrapped to cache, refresh or replace
+	// metric discovery as the flags require. prefixes are the prefixes it is queried with.
+	var refreshing []*prometheus.RefreshingQuerier
+	newQuerier := func(cfg prometheus.Config, prefixes []string) prometheus.Querier {
+		prometheusClient, err := prometheus.NewAPIClient(cfg)
+		if err != nil {
+			fatal("Failed to create Prometheus client", "error", err)
+		}
+		var querier prometheus.Querier = prometheus.NewCachingQuerier(prometheusClient, time.Duration(*o.metricListTTL)*time.Second)
+		staticMetrics := prometheus.MetricNames{
+			Histograms: splitList(*o.staticHistograms),
+			Counters:   splitList(*o.staticCounters),
+			Gauges:     splitList(*o.staticGauges),
+		}
+		if len(staticMetrics.Histograms)+len(staticMetrics.Counters)+len(staticMetrics.Gauges) > 0 {
+			if *o.metricListRefresh > 0 {
+				fatal("-static-histograms, -static-counters and -static-gauges are mutually exclusive with -metric-list-refresh-seconds")
+			}
+			if err := prometheus.ValidateStaticMetrics(staticMetrics, prefixes); err != nil {
+				fatal("Invalid static metrics", "error", err)
+			}
+			querier = prometheus.NewStaticQuerier(prometheusClient, staticMetrics)
+		} else if *o.metricListRefresh > 0 {
+			r := prometheus.NewRefreshingQuerier(prometheusClient, time.Duration(*o.metricListRefresh)*time.Second)
+			refreshing = append(refreshing, r)
+			querier = r
+		}
+		return querier
+	}
+	prefixes := initialSettings.MetricPrefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{initialSettings.MetricPrefix}
+	}
+
+	registry := promclient.NewRegistry()
+	worker.RegisterBuildInfo(registry, version, commit)
+
+	var reloads chan worker.Settings
+	if *o.configFile != "" {
+		reloads = make(chan worker.Settings, 1)
 	}
 
-	worker := worker.Worker{
-		Querier:       prometheusClient,
-		Submitter:     datadogClient,
-		MetricPrefix:  *matrixPrefix,
-		StepDuration:  time.Duration(*stepDuration) * time.Second,
-		QueryInterval: time.Duration(*queryInterval) * time.Second,
-		SleepDuration: time.Duration(*sleepDuration) * time.Second,
-		Quantiles:     []float64{0.5, 0.9, 0.95, 0.99},
+	// newWorker configures a worker from the flags.
+	newWorker := func(querier prometheus.Querier, submitter datadog.Submitter, metrics *worker.Metrics, checkpointPath string, reloads <-chan worker.Settings) *worker.Worker {
+		var checkpoint worker.CheckpointStore
+		if checkpointPath != "" {
+			checkpoint = worker.FileCheckpoint{Path: checkpointPath}
+		}
+		w, err := o.newWorker()
+		if err != nil {
+			fatal("Invalid configuration", "error", err)
+		}
+		w.Querier = querier
+		w.Submitter = submitter
+		w.Metrics = metrics
+		w.Checkpoint = checkpoint
+		w.CheckpointMaxAge = maxPointAge
+		w.Reloads = reloads
+		return w
 	}
 
-	worker.Run()
+	// exporter runs the single worker of the flags or, with -tenants-file, one worker per tenant.
+	var exporter interface {
+		health.CycleReporter
+		health.Pauser
+		Run(ctx context.Context) error
+		RunOnce(ctx context.Context) error
+	}
+	var single *worker.Worker
+	var tenants worker.Tenants
+	var tenantReloads []chan worker.Settings
+	if len(tenantConfigs) > 0 {
+		for _, tc := range tenantConfigs {
+			tenantSubmitter, err := datadog.NewAPIClient(tc.datadogConfig(datadogConfig))
+			if err != nil {
+				fatal("Failed to create Datadog client", "tenant", tc.Name, "error", err)
+			}
+			tenantPrefixes := prefixes
+			if len(tc.MetricPrefixes) > 0 {
+				tenantPrefixes = tc.MetricPrefixes
+			}
+			var checkpointPath string
+			if *o.checkpointFile != "" {
+				checkpointPath = tc.checkpointPath(*o.checkpointFile)
+			}
+			var tenantReload chan worker.Settings
+			if reloads != nil {
+				tenantReload = make(chan worker.Settings, 1)
+				tenantReloads = append(tenantReloads, tenantReload)
+			}
+			metrics := worker.NewMetrics(promclient.WrapRegistererWith(promclient.Labels{worker.TenantTagKey: tc.Name}, registry))
+			w := newWorker(newQuerier(tc.prometheusConfig(prometheusConfig), tenantPrefixes), tenantSubmitter, metrics, checkpointPath, tenantReload)
+			if len(tc.MetricPrefixes) > 0 {
+				w.MetricPrefixes = tc.MetricPrefixes
+			}
+			w.Tags = tc.tags()
+			w.Logger = slog.Default().With(worker.TenantTagKey, tc.Name)
+			tenants = append(tenants, worker.Tenant{Name: tc.Name, Worker: w})
+		}
+		if err := tenants.Validate(); err != nil {
+			fatal("Invalid configuration", "error", err)
+		}
+		exporter = tenants
+	} else {
+		single = newWorker(newQuerier(prometheusConfig, prefixes), submitter, worker.NewMetrics(registry), *o.checkpointFile, reloads)
+		if err := single.Validate(); err != nil {
+			fatal("Invalid configuration", "error", err)
+		}
+		exporter = single
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, r := range refreshing {
+		go r.Run(ctx)
+	}
+
+	if *o.discover {
+		err := single.Discover(ctx, os.Stdout)
+		stop()
+		if err != nil {
+			fatal("Discovery failed", "error", err)
+		}
+		return
+	}
+
+	if *o.pauseEndpoints && *o.healthAddr == "" {
+		fatal("-pause-endpoints requires -health-addr")
+	}
+	if *o.healthAddr != "" {
+		mux := http.NewServeMux()
+		health.RegisterHandlers(mux, exporter, time.Duration(*o.readinessStaleness)*time.Second)
+		if *o.pauseEndpoints {
+			health.RegisterPauseHandlers(mux, exporter)
+		}
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		serveHTTP(ctx, *o.healthAddr, mux)
+	}
+
+	if *o.backfillFrom != "" {
+		err := single.Backfill(ctx, from, to, maxPointAge)
+		stop()
+		if err != nil {
+			fatal("Backfill failed", "error", err)
+		}
+		return
+	}
+
+	if *o.oneshot {
+		err := exporter.RunOnce(ctx)
+		stop()
+		if err != nil {
+			fatal("Cycle failed", "error", err)
+		}
+		return
+	}
+
+	if reloads != nil {
+		go reloadOnHangup(ctx, set, *o.configFile, explicit, o.settings, reloads)
+		if len(tenants) > 0 {
+			go fanOutReloads(ctx, reloads, tenantConfigs, tenantReloads)
+		}
+	}
+
+	if err := exporter.Run(ctx); err != nil {
+		stop()
+		fatal("Worker exited", "error", err)
+	}
+}
+
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func splitList(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func splitMap(s string) map[string]string {
+	values := map[string]string{}
+	for _, kv := range splitList(s) {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down HTTP server", "error", err)
+		}
+	}()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP server failed", "error", err)
+		}
+	}()
 }
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/temporalio/promql-to-dd-go/datadog"
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+	"github.com/temporalio/promql-to-dd-go/worker"
+)
+
+// options holds the flags of the command.
+type options struct {
+	configFile                  *string
+	tenantsFile                 *string
+	promURL                     *string
+	serverRootCACert            *string
+	clientCert                  *string
+	clientKey                   *string
+	bearerToken                 *string
+	bearerTokenFile             *string
+	basicAuthUsername           *string
+	basicAuthPassword           *string
+	proxyURL                    *string
+	serverName                  *string
+	insecureSkipVerify          *bool
+	includeMetrics              *string
+	excludeMetrics              *string
+	staticHistograms            *string
+	staticCounters              *string
+	staticGauges                *string
+	chunkedDiscovery            *bool
+	discoveryMatcherFlags       repeatedFlag
+	metricTypeFlags             repeatedFlag
+	matrixPrefix                *string
+	metricPrefixes              *string
+	prefixTag                   *string
+	stepDuration                *int
+	adaptiveStepPoints          *int
+	minStep                     *int
+	maxStep                     *int
+	queryInterval               *int
+	queryDelay                  *int
+	maxSampleAge                *int
+	overlapFactor               *float64
+	sleepDuration               *int
+	sleepJitter                 *float64
+	rateWindow                  *int
+	quantilesFlag               *string
+	quantileStyle               *string
+	quantileTag                 *bool
+	histogramAverage            *bool
+	histogramCountSum           *bool
+	disableHistograms           *bool
+	disableCounters             *bool
+	combineQuantiles            *bool
+	deriveCounterRates          *bool
+	instantGauges               *bool
+	histogramGroupBy            *string
+	namespaceAllow              *string
+	namespaceDeny               *string
+	operationFilter             *string
+	maxSeriesPerMetric          *int
+	emptyQueryCycles            *int
+	maxPointsPerCycle           *int
+	cardinalityActionFlag       *string
+	allLabelsAsTags             *bool
+	nameStripPrefix             *string
+	nameAddPrefix               *string
+	nameRegex                   *string
+	nameReplacement             *string
+	originalNameTag             *string
+	relabel                     *string
+	namespaceTag                *string
+	operationTag                *string
+	histogramUnitFlags          repeatedFlag
+	quantileOverrideFlags       repeatedFlag
+	queryTemplateFlags          repeatedFlag
+	metricListTTL               *int
+	metricListRefresh           *int
+	queryConcurrency            *int
+	queryTimeout                *int
+	queryRetries                *int
+	queryRetryBackoff           *int
+	abortOnQueryTimeout         *bool
+	bestEffortQueries           *bool
+	maxQuerySteps               *int
+	retryBackoffBase            *int
+	retryBackoffMax             *int
+	staticTags                  *string
+	sourceName                  *string
+	sourceTagKey                *string
+	datadogSite                 *string
+	datadogRateLimit            *float64
+	datadogRateLimitBurst       *int
+	datadogAPIKeyFile           *string
+	datadogApplicationKey       *string
+	datadogMetadata             *bool
+	datadogAPIKeyReloadInterval *int
+	datadogMaxIdleConns         *int
+	datadogIdleConnTimeout      *int
+	datadogCompression          *bool
+	maxBatchSize                *int
+	submitConcurrency           *int
+	scrapeInterval              *int
+	output                      *string
+	outputFailurePolicyFlag     *string
+	otlpEndpoint                *string
+	otlpHeaders                 *string
+	remoteWriteURL              *string
+	remoteWriteBearerToken      *string
+	remoteWriteUsername         *string
+	remoteWritePassword         *string
+	nonFinite                   *string
+	maxConsecutiveFailures      *int
+	breakerFailureThreshold     *int
+	breakerOpenDuration         *int
+	drainTimeout                *int
+	dedup                       *bool
+	discover                    *bool
+	backfillFrom                *string
+	backfillTo                  *string
+	checkpointFile              *string
+	oneshot                     *bool
+	dryRun                      *bool
+	dryRunJSON                  *bool
+	healthAddr                  *string
+	logLevel                    *string
+	logFormat                   *string
+	pauseEndpoints              *bool
+	readinessStaleness          *int
+}
+
+// newOptions defines the flags of the command on set.
+func newOptions(set *flag.FlagSet) *options {
+	o := &options{}
+	o.configFile = set.String("config", "", "YAML file setting flags by name, e.g. quantiles: [0.5, 0.99]; flags given on the command line take precedence")
+	o.tenantsFile = set.String("tenants-file", "", "YAML list of tenants exported side by side, each with its own Prometheus endpoint and credentials, Datadog API key file, prefixes and tags, tagged tenant:<name>")
+	o.promURL = set.String("prom-endpoint", "", "Prometheus API endpoint for the server")
+	o.serverRootCACert = set.String("server-root-ca-cert", "", "Optional path to root server CA cert")
+	o.clientCert = set.String("client-cert", "", "Path to client cert, required unless a bearer token is set")
+	o.clientKey = set.String("client-key", "", "Path to client key, required unless a bearer token is set")
+	o.bearerToken = set.String("bearer-token", "", "Bearer token sent to the Prometheus endpoint")
+	o.bearerTokenFile = set.String("bearer-token-file", "", "File holding the bearer token for the Prometheus endpoint, re-read when it changes")
+	o.basicAuthUsername = set.String("basic-auth-username", "", "HTTP basic auth username for the Prometheus endpoint, instead of a bearer token")
+	o.basicAuthPassword = set.String("basic-auth-password", "", "HTTP basic auth password for the Prometheus endpoint")
+	o.proxyURL = set.String("proxy-url", "", "Proxy for all outbound requests, defaults to HTTP_PROXY, HTTPS_PROXY and NO_PROXY")
+	o.serverName = set.String("server-name", "", "Server name to use for verifying the server's certificate")
+	o.insecureSkipVerify = set.Bool("insecure-skip-verify", false, "Skip verification of the server's certificate and host name")
+	o.includeMetrics = set.String("include-metrics", "", "Comma separated regular expressions of the discovered metric names to export, e.g. .*_latency_.*; empty for all")
+	o.excludeMetrics = set.String("exclude-metrics", "", "Comma separated regular expressions of the discovered metric names to skip, takes precedence over -include-metrics")
+	o.staticHistograms = set.String("static-histograms", "", "Comma separated histogram _bucket names exported instead of discovering metrics")
+	o.staticCounters = set.String("static-counters", "", "Comma separated counter names exported instead of discovering metrics")
+	o.staticGauges = set.String("static-gauges", "", "Comma separated gauge names exported instead of discovering metrics")
+	o.chunkedDiscovery = set.Bool("chunked-discovery", false, "Discover metric names in several smaller requests")
+	set.Var(&o.discoveryMatcherFlags, "discovery-matcher", "Label matcher a series must satisfy for its metric to be discovered, repeatable, e.g. temporal_namespace!=\"\"")
+	set.Var(&o.metricTypeFlags, "metric-type", "Type of matching discovered metrics as <pattern>=<histogram|counter|gauge|summary>, repeatable, overriding the naming heuristic, e.g. .*_queue_total=gauge")
+	o.matrixPrefix = set.String("matrix-prefix", "temporal_cloud_", "Prefix of the metrics to be queried and send to Datadog")
+	o.metricPrefixes = set.String("metric-prefixes", "", "Comma separated prefixes queried in turn, overriding -matrix-prefix")
+	o.prefixTag = set.String("prefix-tag", "", "Tag key added to every series with its originating prefix, empty to disable")
+	o.stepDuration = set.Int("step-duration-seconds", 60, "The step between metrics")
+	o.adaptiveStepPoints = set.Int("adaptive-step-points", 0, "Derive the step from the range length, targeting this many points per series and query instead of -step-duration-seconds; 0 to disable")
+	o.minStep = set.Int("min-step-seconds", int(worker.DefaultMinStepDuration.Seconds()), "Lower bound of adaptive steps")
+	o.maxStep = set.Int("max-step-seconds", int(worker.DefaultMaxStepDuration.Seconds()), "Upper bound of adaptive steps")
+	o.queryInterval = set.Int("query-interval-seconds", 600, "Interval between each Prometheus query")
+	o.queryDelay = set.Int("query-delay-seconds", 0, "Seconds the end of every query range lags behind now, for samples ingested late")
+	o.maxSampleAge = set.Int("max-sample-age-seconds", 0, "Drop samples older than that many seconds before conversion, 0 to disable; Datadog rejects points older than an hour")
+	o.overlapFactor = set.Float64("overlap-factor", worker.DefaultOverlapFactor, "Query window as a multiple of the query interval, at least 1")
+	o.sleepDuration = set.Int("sleep-duration-seconds", 60, "Sleep duration between each data submission")
+	o.sleepJitter = set.Float64("sleep-jitter", 0, "Shift every cycle by a random offset of up to this fraction of -sleep-duration, at most 0.5")
+	o.rateWindow = set.Int("rate-window-seconds", 60, "Range window used inside rate() queries")
+	o.quantilesFlag = set.String("quantiles", "0.5,0.9,0.95,0.99", "Comma separated histogram quantiles to export, each between 0 and 1 exclusive, typically 0.5, 0.9, 0.95 and 0.99")
+	o.quantileStyle = set.String("quantile-style", string(worker.QuantileStyleSuffix), "How quantiles are encoded in metric names: suffix (_P99), dotted (.p99) or none")
+	o.quantileTag = set.Bool("quantile-tag", false, "Tag quantile gauges with quantile:<q>")
+	o.histogramAverage = set.Bool("histogram-average", false, "Also emit the mean of every histogram as <metric>.avg")
+	o.histogramCountSum = set.Bool("histogram-count-sum", false, "Forward the _count and _sum of every histogram as a count and a gauge only")
+	o.disableHistograms = set.Bool("disable-histograms", false, "Skip every histogram query, exporting no quantiles, averages or histogram counts")
+	o.disableCounters = set.Bool("disable-counters", false, "Skip every counter query, exporting no rates")
+	o.combineQuantiles = set.Bool("combine-quantiles", false, "Query all the quantiles of a histogram in a single query instead of one query per quantile")
+	o.deriveCounterRates = set.Bool("derive-counter-rates", false, "Compute counter rates from the raw counter query instead of a separate rate() query")
+	o.instantGauges = set.Bool("instant-gauges", false, "Query gauges with an instant query at the end of every cycle instead of a range query")
+	o.histogramGroupBy = set.String("histogram-group-by", strings.Join(worker.DefaultHistogramGroupBy, ","), "Comma separated labels to aggregate histograms by, le is always included")
+	o.namespaceAllow = set.String("namespace-allow", "", "Comma separated regular expressions of the namespaces to export, empty for all")
+	o.namespaceDeny = set.String("namespace-deny", "", "Comma separated regular expressions of the namespaces to exclude, takes precedence over -namespace-allow")
+	o.operationFilter = set.String("operation-filter", "", "Comma separated regular expressions of the operations to exclude")
+	o.maxSeriesPerMetric = set.Int("max-series-per-metric", 0, "Distinct tag sets a metric may have per cycle before -cardinality-action applies, 0 to disable")
+	o.emptyQueryCycles = set.Int("empty-query-cycles", worker.DefaultEmptyQueryCycles, "Warn about discovered metrics whose queries return no series for that many cycles in a row")
+	o.maxPointsPerCycle = set.Int("max-points-per-cycle", 0, "Points converted per cycle across all sources before the remainder is dropped, 0 to disable")
+	o.cardinalityActionFlag = set.String("cardinality-action", "warn", "What to do with metrics exceeding -max-series-per-metric: warn or drop")
+	o.allLabelsAsTags = set.Bool("all-labels-as-tags", false, "Also send every Prometheus label as a key:value Datadog tag")
+	o.nameStripPrefix = set.String("name-strip-prefix", "", "Prefix removed from every Datadog metric name, e.g. temporal_cloud_v0_")
+	o.nameAddPrefix = set.String("name-add-prefix", "", "Prefix prepended to every Datadog metric name, e.g. temporal.")
+	o.nameRegex = set.String("name-regex", "", "Regular expression replaced in every Datadog metric name, after -name-strip-prefix")
+	o.nameReplacement = set.String("name-replacement", "", "Replacement for -name-regex, may reference groups like $1")
+	o.originalNameTag = set.String("original-name-tag", "", "Tag key holding the original metric name of renamed series, empty to disable")
+	o.relabel = set.String("relabel", "", "Comma separated relabel rules: keep:<label>, drop:<label> or rename:<label>:<tag>")
+	o.namespaceTag = set.String("namespace-tag", "", "Datadog tag key for the temporal_namespace label, e.g. namespace; empty keeps the label name")
+	o.operationTag = set.String("operation-tag", "", "Datadog tag key for the operation label, e.g. temporal_operation; empty keeps the label name")
+	set.Var(&o.histogramUnitFlags, "histogram-unit", "Unit of the quantiles and averages of matching histograms as <pattern>=<second|millisecond>, repeatable; millisecond converts from seconds, e.g. .*_latency_bucket=millisecond")
+	set.Var(&o.quantileOverrideFlags, "histogram-quantiles", "Quantiles of matching histograms as <pattern>=<quantiles>, repeatable, overriding -quantiles, e.g. .*_latency_bucket=0.5,0.99")
+	set.Var(&o.queryTemplateFlags, "promql-template", "PromQL override for matching metrics as <pattern>=<template>, repeatable; the template may use {{.Metric}}, {{.Selector}}, {{.Quantile}}, {{.RateWindow}} and {{.GroupBy}}")
+	o.metricListTTL = set.Int("metric-list-ttl-seconds", int(prometheus.DefaultMetricListTTL.Seconds()), "How long discovered metric names are reused before discovering them again")
+	o.metricListRefresh = set.Int("metric-list-refresh-seconds", 0, "Refresh discovered metric names in the background at this interval instead of on expiry, 0 to disable")
+	o.queryConcurrency = set.Int("query-concurrency", 4, "Maximum number of concurrent Prometheus queries")
+	o.queryTimeout = set.Int("query-timeout-seconds", 10, "Timeout of a single Prometheus query")
+	o.queryRetries = set.Int("query-retries", 0, "Times a query failing with a Prometheus server or network error is repeated before failing the cycle, 0 to disable")
+	o.queryRetryBackoff = set.Int("query-retry-backoff-seconds", 1, "Initial delay before repeating a failed query, doubling on each attempt")
+	o.abortOnQueryTimeout = set.Bool("abort-on-query-timeout", false, "Fail the whole cycle when a single query times out instead of skipping it")
+	o.bestEffortQueries = set.Bool("best-effort-queries", false, "Submit the series of the successful queries when some fail, instead of failing the whole cycle")
+	o.maxQuerySteps = set.Int("max-query-steps", worker.DefaultMaxQuerySteps, "Split range queries evaluating more steps into several queries")
+	o.retryBackoffBase = set.Int("retry-backoff-base-seconds", 3, "Initial delay before retrying a failed cycle")
+	o.retryBackoffMax = set.Int("retry-backoff-max-seconds", 120, "Maximum delay between retries of failed cycles")
+	o.staticTags = set.String("static-tags", "", "Comma separated key:value tags added to every series, e.g. env:prod,cluster:temporal-us")
+	o.sourceName = set.String("source-name", "", "Name of this Temporal account or cluster, added to every Datadog series as a <source-tag-key>:<name> tag")
+	o.sourceTagKey = set.String("source-tag-key", datadog.DefaultSourceTagKey, "Tag key of -source-name")
+	o.datadogSite = set.String("datadog-site", "", "Datadog site to submit to, e.g. datadoghq.eu; defaults to DD_SITE or datadoghq.com")
+	o.datadogRateLimit = set.Float64("datadog-rate-limit", 0, "Maximum Datadog intake requests per second, 0 for no limit")
+	o.datadogRateLimitBurst = set.Int("datadog-rate-limit-burst", 1, "Number of Datadog intake requests allowed at once when rate limited")
+	o.datadogAPIKeyFile = set.String("datadog-api-key-file", "", "File holding the Datadog API key, used instead of DD_API_KEY and re-read periodically")
+	o.datadogApplicationKey = set.String("datadog-application-key", "", "Datadog application key sent with every request, for intake endpoints requiring one; the plain intake does not")
+	o.datadogMetadata = set.Bool("datadog-metadata", false, "Submit the unit, type and description of every metric once per process; requires -datadog-application-key or DD_APP_KEY")
+	o.datadogAPIKeyReloadInterval = set.Int("datadog-api-key-reload-interval", 60, "Seconds between reads of -datadog-api-key-file")
+	o.datadogMaxIdleConns = set.Int("datadog-max-idle-conns", 0, "Idle connections kept to Datadog for reuse across batches and cycles, 0 for the submit concurrency")
+	o.datadogIdleConnTimeout = set.Int("datadog-idle-conn-timeout-seconds", int(datadog.DefaultIdleConnTimeout.Seconds()), "Seconds an idle connection to Datadog is kept before being closed")
+	o.datadogCompression = set.Bool("datadog-compression", true, "Gzip intake payloads sent to Datadog")
+	o.maxBatchSize = set.Int("max-batch-size", datadog.DefaultMaxBatchSize, "Maximum number of series per Datadog submission")
+	o.submitConcurrency = set.Int("submit-concurrency", datadog.DefaultSubmitConcurrency, "Maximum number of Datadog batches submitted at once")
+	o.scrapeInterval = set.Int("scrape-interval-seconds", 60, "Resolution of the source metrics, used to validate the rate window")
+	o.output = set.String("output", "datadog", "Comma separated outputs to send the series to concurrently: datadog, otlp, remote-write or stdout")
+	o.outputFailurePolicyFlag = set.String("output-failure-policy", "any", "With several outputs, fail the cycle when any output failed or only when all did: any or all")
+	o.otlpEndpoint = set.String("otlp-endpoint", "", "OTLP/HTTP collector endpoint, e.g. http://otel-collector:4318, when -output=otlp")
+	o.otlpHeaders = set.String("otlp-headers", "", "Comma separated key=value headers added to OTLP export requests")
+	o.remoteWriteURL = set.String("remote-write-url", "", "Prometheus remote-write endpoint, e.g. http://mimir:9009/api/v1/push, when -output=remote-write")
+	o.remoteWriteBearerToken = set.String("remote-write-bearer-token", "", "Optional bearer token for the remote-write endpoint")
+	o.remoteWriteUsername = set.String("remote-write-username", "", "Optional basic auth username for the remote-write endpoint")
+	o.remoteWritePassword = set.String("remote-write-password", "", "Optional basic auth password for the remote-write endpoint")
+	o.nonFinite = set.String("non-finite", string(worker.NonFiniteSkip), "What to do with NaN and Inf samples: skip or zero")
+	o.maxConsecutiveFailures = set.Int("max-consecutive-failures", 0, "Exit after that many failed cycles in a row, 0 to retry forever")
+	o.breakerFailureThreshold = set.Int("breaker-failure-threshold", 0, "Stop submitting after that many failed submissions in a row, 0 to disable the circuit breaker")
+	o.breakerOpenDuration = set.Int("breaker-open-duration", 60, "Seconds the circuit breaker stays open before probing with a single submission")
+	o.drainTimeout = set.Int("drain-timeout-seconds", 10, "On shutdown, seconds allowed to submit the series already converted by the cycle in flight, 0 to drop them")
+	o.dedup = set.Bool("dedup", false, "Merge duplicate series and points before submission")
+	o.discover = set.Bool("discover", false, "List the discovered metrics with their classification and exit")
+	o.backfillFrom = set.String("backfill-from", "", "Replay the metrics from this RFC 3339 time and exit, instead of running continuously")
+	o.backfillTo = set.String("backfill-to", "", "End of the backfill range as an RFC 3339 time, defaults to now")
+	o.checkpointFile = set.String("checkpoint-file", "", "File persisting the end of the last submitted range, so that a restart resumes from it; empty to disable")
+	o.oneshot = set.Bool("oneshot", false, "Run a single cycle and exit with a non-zero status if it failed")
+	o.dryRun = set.Bool("dry-run", false, "Query and convert metrics but log them instead of submitting to Datadog")
+	o.dryRunJSON = set.Bool("dry-run-json", false, "In dry-run mode, also log every series as JSON")
+	o.healthAddr = set.String("health-addr", "", "Address to serve /healthz, /readyz and /metrics on, e.g. :8080. Disabled when empty")
+	o.logLevel = set.String("log-level", "info", "Log level: debug, info, warn or error")
+	o.logFormat = set.String("log-format", "text", "Log format: text or json")
+	o.pauseEndpoints = set.Bool("pause-endpoints", false, "Serve POST /pause and POST /resume on -health-addr to stop and restart submissions without restarting the process")
+	o.readinessStaleness = set.Int("readiness-staleness-seconds", 600, "Maximum age of the last successful cycle for /readyz to succeed")
+	return o
+}
+
+// parse parses args into the flags of set and then applies the -config file, which the flags
+// given in args override. It returns the names of those flags.
+func (o *options) parse(set *flag.FlagSet, args []string) (map[string]bool, error) {
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := commandLineFlags(set)
+	if *o.configFile != "" {
+		if err := applyConfigFile(set, *o.configFile, explicit); err != nil {
+			return nil, fmt.Errorf("failed loading -config: %w", err)
+		}
+	}
+	return explicit, nil
+}
+
+// settings parses the flags reloaded from -config on SIGHUP.
+func (o *options) settings() (worker.Settings, error) {
+	quantiles, err := worker.ParseQuantiles(*o.quantilesFlag)
+	if err != nil {
+		return worker.Settings{}, fmt.Errorf("failed parsing -quantiles: %w", err)
+	}
+	quantileOverrides := worker.QuantileOverrides{}
+	for _, raw := range o.quantileOverrideFlags {
+		override, err := worker.ParseQuantileOverride(raw)
+		if err != nil {
+			return worker.Settings{}, fmt.Errorf("failed parsing -histogram-quantiles: %w", err)
+		}
+		quantileOverrides = append(quantileOverrides, override)
+	}
+	relabeling, err := worker.ParseRelabeling(*o.relabel)
+	if err != nil {
+		return worker.Settings{}, fmt.Errorf("failed parsing -relabel: %w", err)
+	}
+	queryTemplates := worker.QueryTemplates{}
+	for _, raw := range o.queryTemplateFlags {
+		qt, err := worker.ParseQueryTemplate(raw)
+		if err != nil {
+			return worker.Settings{}, fmt.Errorf("failed parsing -promql-template: %w", err)
+		}
+		queryTemplates = append(queryTemplates, qt)
+	}
+	for name, patterns := range map[string]string{"namespace-allow": *o.namespaceAllow, "namespace-deny": *o.namespaceDeny, "operation-filter": *o.operationFilter} {
+		if err := worker.ValidatePatterns(splitList(patterns)); err != nil {
+			return worker.Settings{}, fmt.Errorf("failed parsing -%s: %w", name, err)
+		}
+	}
+	return worker.Settings{
+		MetricPrefix:      *o.matrixPrefix,
+		MetricPrefixes:    splitList(*o.metricPrefixes),
+		PrefixTag:         *o.prefixTag,
+		Quantiles:         quantiles,
+		QuantileOverrides: quantileOverrides,
+		HistogramGroupBy:  splitList(*o.histogramGroupBy),
+		NamespaceAllow:    splitList(*o.namespaceAllow),
+		NamespaceDeny:     splitList(*o.namespaceDeny),
+		OperationFilter:   splitList(*o.operationFilter),
+		QueryTemplates:    queryTemplates,
+		Relabeling:        relabeling,
+		NamespaceTag:      *o.namespaceTag,
+		OperationTag:      *o.operationTag,
+		AllLabelsAsTags:   *o.allLabelsAsTags,
+	}, nil
+}
+
+// newWorker returns a worker configured from the flags, without its querier, submitter,
+// metrics or checkpoint.
+func (o *options) newWorker() (*worker.Worker, error) {
+	settings, err := o.settings()
+	if err != nil {
+		return nil, err
+	}
+	histogramUnits := worker.UnitRules{}
+	for _, raw := range o.histogramUnitFlags {
+		rule, err := worker.ParseUnitRule(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing -histogram-unit: %w", err)
+		}
+		histogramUnits = append(histogramUnits, rule)
+	}
+	naming, err := worker.NewNameTransform(*o.nameStripPrefix, *o.nameAddPrefix, *o.nameRegex, *o.nameReplacement, *o.originalNameTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing -name-regex: %w", err)
+	}
+	quantileNaming, err := worker.ParseQuantileNaming(*o.quantileStyle, *o.quantileTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing -quantile-style: %w", err)
+	}
+	nonFinitePolicy, err := worker.ParseNonFinitePolicy(*o.nonFinite)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing -non-finite: %w", err)
+	}
+	cardinalityAction, err := worker.ParseCardinalityAction(*o.cardinalityActionFlag)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing -cardinality-action: %w", err)
+	}
+
+	w := &worker.Worker{
+		StepDuration:            time.Duration(*o.stepDuration) * time.Second,
+		AdaptiveStepPoints:      *o.adaptiveStepPoints,
+		MinStepDuration:         time.Duration(*o.minStep) * time.Second,
+		MaxStepDuration:         time.Duration(*o.maxStep) * time.Second,
+		QueryInterval:           time.Duration(*o.queryInterval) * time.Second,
+		OverlapFactor:           *o.overlapFactor,
+		QueryDelay:              time.Duration(*o.queryDelay) * time.Second,
+		MaxSampleAge:            time.Duration(*o.maxSampleAge) * time.Second,
+		SleepDuration:           time.Duration(*o.sleepDuration) * time.Second,
+		Jitter:                  *o.sleepJitter,
+		RateWindow:              time.Duration(*o.rateWindow) * time.Second,
+		ScrapeInterval:          time.Duration(*o.scrapeInterval) * time.Second,
+		HistogramUnits:          histogramUnits,
+		HistogramAverage:        *o.histogramAverage,
+		HistogramCountSum:       *o.histogramCountSum,
+		InstantGauges:           *o.instantGauges,
+		DeriveCounterRates:      *o.deriveCounterRates,
+		CombineQuantiles:        *o.combineQuantiles,
+		DisableHistograms:       *o.disableHistograms,
+		DisableCounters:         *o.disableCounters,
+		Naming:                  naming,
+		MaxSeriesPerMetric:      *o.maxSeriesPerMetric,
+		CardinalityAction:       cardinalityAction,
+		EmptyQueryCycles:        *o.emptyQueryCycles,
+		MaxPointsPerCycle:       *o.maxPointsPerCycle,
+		QuantileNaming:          quantileNaming,
+		QueryConcurrency:        *o.queryConcurrency,
+		QueryTimeout:            time.Duration(*o.queryTimeout) * time.Second,
+		AbortOnQueryTimeout:     *o.abortOnQueryTimeout,
+		QueryRetries:            *o.queryRetries,
+		QueryRetryBackoff:       time.Duration(*o.queryRetryBackoff) * time.Second,
+		BestEffortQueries:       *o.bestEffortQueries,
+		MaxQuerySteps:           *o.maxQuerySteps,
+		RetryBackoffBase:        time.Duration(*o.retryBackoffBase) * time.Second,
+		RetryBackoffMax:         time.Duration(*o.retryBackoffMax) * time.Second,
+		MaxConsecutiveFailures:  *o.maxConsecutiveFailures,
+		BreakerFailureThreshold: *o.breakerFailureThreshold,
+		BreakerOpenDuration:     time.Duration(*o.breakerOpenDuration) * time.Second,
+		DrainTimeout:            time.Duration(*o.drainTimeout) * time.Second,
+		NonFinite:               nonFinitePolicy,
+		Deduplicate:             *o.dedup,
+		DryRun:                  *o.dryRun,
+		DryRunJSON:              *o.dryRunJSON,
+	}
+	w.ApplySettings(settings)
+	return w, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/temporalio/promql-to-dd-go/datadog"
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+	"github.com/temporalio/promql-to-dd-go/worker"
+)
+
+// tenantConfig is an entry of -tenants-file. Its keys are named after the flags they override
+// for the tenant; every other flag applies to all tenants.
+type tenantConfig struct {
+	Name              string   `yaml:"name"`
+	PromEndpoint      string   `yaml:"prom-endpoint"`
+	ServerRootCACert  string   `yaml:"server-root-ca-cert"`
+	ServerName        string   `yaml:"server-name"`
+	ClientCert        string   `yaml:"client-cert"`
+	ClientKey         string   `yaml:"client-key"`
+	BearerTokenFile   string   `yaml:"bearer-token-file"`
+	DatadogAPIKeyFile string   `yaml:"datadog-api-key-file"`
+	DatadogSite       string   `yaml:"datadog-site"`
+	MetricPrefixes    []string `yaml:"metric-prefixes"`
+	Tags              []string `yaml:"tags"`
+}
+
+// loadTenants reads the YAML list of tenants at path. Every tenant needs a name, a Prometheus
+// endpoint with its own credentials and a Datadog API key file, so that no tenant falls back
+// to the credentials of another.
+func loadTenants(path string) ([]tenantConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading tenants file: %w", err)
+	}
+	var tenants []tenantConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&tenants); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed parsing tenants file %s: %w", path, err)
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("tenants file %s lists no tenant", path)
+	}
+
+	var errs []error
+	for i, t := range tenants {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i+1)
+			errs = append(errs, fmt.Errorf("tenant %s has no name", name))
+		}
+		if t.PromEndpoint == "" {
+			errs = append(errs, fmt.Errorf("tenant %s has no prom-endpoint", name))
+		}
+		if (t.ClientCert == "" || t.ClientKey == "") && t.BearerTokenFile == "" {
+			errs = append(errs, fmt.Errorf("tenant %s needs client-cert and client-key, or bearer-token-file", name))
+		}
+		if t.DatadogAPIKeyFile == "" {
+			errs = append(errs, fmt.Errorf("tenant %s has no datadog-api-key-file", name))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %w", path, err)
+	}
+	return tenants, nil
+}
+
+// prometheusConfig returns base with the endpoint and credentials of the tenant.
+func (t tenantConfig) prometheusConfig(base prometheus.Config) prometheus.Config {
+	base.TargetHost = t.PromEndpoint
+	base.ServerRootCACert = t.ServerRootCACert
+	base.ServerName = t.ServerName
+	base.ClientCert = t.ClientCert
+	base.ClientKey = t.ClientKey
+	base.BearerToken = ""
+	base.BearerTokenFile = t.BearerTokenFile
+	base.BasicAuthUsername = ""
+	base.BasicAuthPassword = ""
+	return base
+}
+
+// datadogConfig returns base with the API key and site of the tenant.
+func (t tenantConfig) datadogConfig(base datadog.Config) datadog.Config {
+	base.APIKeyFile = t.DatadogAPIKeyFile
+	if t.DatadogSite != "" {
+		base.Site = t.DatadogSite
+	}
+	return base
+}
+
+// tags returns the tags added to every series of the tenant.
+func (t tenantConfig) tags() []string {
+	return append([]string{worker.TenantTagKey + ":" + t.Name}, t.Tags...)
+}
+
+// checkpointPath returns the checkpoint file of the tenant next to the shared path.
+func (t tenantConfig) checkpointPath(path string) string {
+	return path + "." + t.Name
+}
+
+// fanOutReloads sends the settings reloaded on SIGHUP to the worker of every tenant, keeping
+// the metric prefixes of the tenants setting their own. The channels are buffered and a
+// tenant busy with a long cycle gets the latest settings only, so that it cannot hold back
+// the others.
+func fanOutReloads(ctx context.Context, reloads <-chan worker.Settings, configs []tenantConfig, tenantReloads []chan worker.Settings) {
+	for {
+		var s worker.Settings
+		select {
+		case s = <-reloads:
+		case <-ctx.Done():
+			return
+		}
+		for i, ch := range tenantReloads {
+			tenantSettings := s
+			if len(configs[i].MetricPrefixes) > 0 {
+				tenantSettings.MetricPrefixes = configs[i].MetricPrefixes
+			}
+			for sent := false; !sent; {
+				select {
+				case ch <- tenantSettings:
+					sent = true
+				default:
+					select {
+					case <-ch:
+					default:
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/datadog"
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestLoadTenants(t *testing.T) {
+	path := writeConfigFile(t, `
+- name: acme
+  prom-endpoint: https://acme.tmprl.cloud/prometheus
+  client-cert: acme.pem
+  client-key: acme.key
+  datadog-api-key-file: acme-dd
+  tags: [plan:enterprise]
+- name: globex
+  prom-endpoint: https://globex.tmprl.cloud/prometheus
+  bearer-token-file: globex-token
+  datadog-api-key-file: globex-dd
+  datadog-site: datadoghq.eu
+  metric-prefixes: [temporal_cloud_v1_]
+`)
+	tenants, err := loadTenants(path)
+	require.NoError(t, err)
+	require.Len(t, tenants, 2)
+
+	base := prometheus.Config{TargetHost: "https://shared/prometheus", BearerToken: "shared", ChunkedDiscovery: true}
+	acme := tenants[0].prometheusConfig(base)
+	assert.Equal(t, "https://acme.tmprl.cloud/prometheus", acme.TargetHost)
+	assert.Equal(t, "acme.pem", acme.ClientCert)
+	assert.Empty(t, acme.BearerToken, "a tenant never uses the shared credentials")
+	assert.True(t, acme.ChunkedDiscovery)
+	assert.Equal(t, []string{"tenant:acme", "plan:enterprise"}, tenants[0].tags())
+
+	globex := tenants[1].datadogConfig(datadog.Config{Site: "datadoghq.com", APIKeyFile: "shared-dd", MaxBatchSize: 100})
+	assert.Equal(t, "globex-dd", globex.APIKeyFile)
+	assert.Equal(t, "datadoghq.eu", globex.Site)
+	assert.Equal(t, 100, globex.MaxBatchSize)
+	assert.Equal(t, []string{"temporal_cloud_v1_"}, tenants[1].MetricPrefixes)
+	assert.Equal(t, "/var/lib/checkpoint.globex", tenants[1].checkpointPath("/var/lib/checkpoint"))
+}
+
+func TestLoadTenantsErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content string
+		wantErr string
+	}{
+		"empty":            {content: "", wantErr: "lists no tenant"},
+		"unknown key":      {content: "- name: acme\n  api-key: x\n", wantErr: "field api-key not found"},
+		"missing name":     {content: "- prom-endpoint: https://p\n  bearer-token-file: t\n  datadog-api-key-file: k\n", wantErr: "tenant 1 has no name"},
+		"missing endpoint": {content: "- name: acme\n  bearer-token-file: t\n  datadog-api-key-file: k\n", wantErr: "tenant acme has no prom-endpoint"},
+		"missing creds":    {content: "- name: acme\n  prom-endpoint: https://p\n  client-cert: c\n  datadog-api-key-file: k\n", wantErr: "tenant acme needs client-cert and client-key, or bearer-token-file"},
+		"missing api key":  {content: "- name: acme\n  prom-endpoint: https://p\n  bearer-token-file: t\n", wantErr: "tenant acme has no datadog-api-key-file"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadTenants(writeConfigFile(t, tc.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+)
+
+// DefaultAPIKeyReloadInterval is used when Config.APIKeyReloadInterval is not set.
+const DefaultAPIKeyReloadInterval = time.Minute
+
+// apiKeyFile holds an API key read from a file, re-read once the reload interval elapsed so
+// that keys rotated by a secrets controller take effect without a restart. A nil *apiKeyFile
+// leaves the key from the DD_API_KEY environment variable in place.
+type apiKeyFile struct {
+	path     string
+	interval time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	key    string
+	readAt time.Time
+}
+
+func newAPIKeyFile(path string, interval time.Duration) (*apiKeyFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if interval <= 0 {
+		interval = DefaultAPIKeyReloadInterval
+	}
+	f := &apiKeyFile{path: path, interval: interval, now: time.Now}
+	if _, err := f.current(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *apiKeyFile) current() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	if f.key != "" && now.Sub(f.readAt) < f.interval {
+		return f.key, nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Datadog API key file: %w", err)
+	}
+	key := strings.TrimSpace(string(b))
+	if key == "" {
+		return "", errors.New("Datadog API key file is empty")
+	}
+	f.key = key
+	f.readAt = now
+	return f.key, nil
+}
+
+// withAPIKey returns ctx with the current API key replacing the one from the environment.
+func (f *apiKeyFile) withAPIKey(ctx context.Context) (context.Context, error) {
+	if f == nil {
+		return ctx, nil
+	}
+	key, err := f.current()
+	if err != nil {
+		return nil, err
+	}
+	return withAuthKey(ctx, "apiKeyAuth", key), nil
+}
+
+// withAuthKey returns ctx with the named SDK authentication key set.
+func withAuthKey(ctx context.Context, name, key string) context.Context {
+	keys := map[string]datadog.APIKey{}
+	if existing, ok := ctx.Value(datadog.ContextAPIKeys).(map[string]datadog.APIKey); ok {
+		for n, k := range existing {
+			keys[n] = k
+		}
+	}
+	keys[name] = datadog.APIKey{Key: key}
+	return context.WithValue(ctx, datadog.ContextAPIKeys, keys)
+}
@@ -0,0 +1,52 @@
+package datadog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitMetricsReloadsAPIKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(path, []byte("old-key\n"), 0o600))
+
+	api := &fakeMetricsAPI{}
+	client, err := newAPIClient(api, Config{APIKeyFile: path, APIKeyReloadInterval: time.Minute})
+	require.NoError(t, err)
+	now := time.Now()
+	client.apiKey.now = func() time.Time { return now }
+
+	submittedKey := func() string {
+		require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+		keys, ok := api.ctx.Value(datadog.ContextAPIKeys).(map[string]datadog.APIKey)
+		require.True(t, ok)
+		return keys["apiKeyAuth"].Key
+	}
+	assert.Equal(t, "old-key", submittedKey())
+
+	require.NoError(t, os.WriteFile(path, []byte("new-key\n"), 0o600))
+	assert.Equal(t, "old-key", submittedKey(), "the file is not re-read before the interval elapsed")
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, "new-key", submittedKey())
+}
+
+func TestSubmitMetricsAPIKeyFileErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	_, err := newAPIClient(&fakeMetricsAPI{}, Config{APIKeyFile: path})
+	assert.ErrorContains(t, err, "failed to read Datadog API key file")
+
+	require.NoError(t, os.WriteFile(path, []byte("key"), 0o600))
+	client, err := newAPIClient(&fakeMetricsAPI{}, Config{APIKeyFile: path})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(" \n"), 0o600))
+	client.apiKey.now = func() time.Time { return time.Now().Add(DefaultAPIKeyReloadInterval) }
+	assert.ErrorContains(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)), "API key file is empty")
+}
@@ -3,75 +3,325 @@ package datadog
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
-	"golang.org/x/sync/errgroup"
+
+	"github.com/temporalio/promql-to-dd-go/proxy"
+	"github.com/temporalio/promql-to-dd-go/retryafter"
 )
 
+// DefaultMaxBatchSize keeps a batch of series comfortably below Datadog's intake payload limit.
+const DefaultMaxBatchSize = 1000
+
+// DefaultSubmitConcurrency is the number of batches in flight when SubmitConcurrency is not set.
+const DefaultSubmitConcurrency = 4
+
+// DefaultIdleConnTimeout is how long idle intake connections are kept when IdleConnTimeout is
+// not set, longer than the usual interval between cycles so that connections outlive it.
+const DefaultIdleConnTimeout = 90 * time.Second
+
+// MaxPointAge is how far in the past Datadog accepts submitted points; older points are
+// dropped by the intake.
+const MaxPointAge = time.Hour
+
+// DefaultSite is the US1 site, used when neither Site nor DD_SITE is set.
+const DefaultSite = "datadoghq.com"
+
+// Sites lists the Datadog sites accepted for Config.Site.
+var Sites = []string{
+	"datadoghq.com",
+	"us3.datadoghq.com",
+	"us5.datadoghq.com",
+	"ap1.datadoghq.com",
+	"datadoghq.eu",
+	"ddog-gov.com",
+}
+
 type (
 	Submitter interface {
-		SubmitMetrics(series []datadogV2.MetricSeries) error
+		SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error
 	}
 
 	APIClient struct {
-		api *datadogV2.MetricsApi
+		api          metricsAPI
+		maxBatchSize int
+		concurrency  int
+		staticTags   []string
+		sourceTag    string
+		site         string
+		limiter      *rateLimiter
+		apiKey       *apiKeyFile
+		compress     bool
+		appKey       string
+		metadata     *metadataSubmitter
+	}
+
+	metricsAPI interface {
+		SubmitMetrics(ctx context.Context, body datadogV2.MetricPayload, o ...datadogV2.SubmitMetricsOptionalParameters) (datadogV2.IntakePayloadAccepted, *http.Response, error)
 	}
 )
 
-func NewAPIClient() *APIClient {
+type Config struct {
+	// MaxBatchSize is the maximum number of series sent in a single intake request.
+	MaxBatchSize int
+	// SubmitConcurrency bounds the number of batches submitted at once. Defaults to
+	// DefaultSubmitConcurrency.
+	SubmitConcurrency int
+	// StaticTags are key:value tags added to every submitted series.
+	StaticTags []string
+	// SourceName identifies the Temporal account or cluster the series come from, added to
+	// every series as a <SourceTagKey>:<SourceName> tag. Unlike a static tag it replaces any
+	// tag of the series with the same key, so it is always present and always accurate.
+	// SourceTagKey defaults to DefaultSourceTagKey.
+	SourceName   string
+	SourceTagKey string
+	// Site is the Datadog site to submit to, such as datadoghq.eu. When empty the DD_SITE
+	// environment variable is used, falling back to DefaultSite.
+	Site string
+	// RateLimit caps intake requests per second, zero disables the limit. RateLimitBurst
+	// requests may be sent at once, defaults to 1.
+	RateLimit      float64
+	RateLimitBurst int
+	// ProxyURL routes requests through a proxy. When empty HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY are honored.
+	ProxyURL string
+	// APIKeyFile is read for the API key instead of the DD_API_KEY environment variable, and
+	// re-read every APIKeyReloadInterval, which defaults to DefaultAPIKeyReloadInterval.
+	APIKeyFile           string
+	APIKeyReloadInterval time.Duration
+	// DisableCompression sends intake payloads uncompressed instead of gzip encoded.
+	DisableCompression bool
+	// ApplicationKey is sent as the DD-APPLICATION-KEY header of every request, for intake
+	// endpoints behind policies requiring it. The plain intake only needs the API key.
+	ApplicationKey string
+	// SubmitMetadata additionally submits the unit, type and description of every metric
+	// once per process, so dashboards show proper units. The metadata API requires an
+	// application key, from ApplicationKey or the DD_APP_KEY environment variable.
+	SubmitMetadata bool
+	// MaxIdleConns bounds the idle connections the HTTP client keeps to Datadog for reuse by
+	// later batches and cycles, defaults to the submit concurrency so that every batch in
+	// flight finds one. IdleConnTimeout closes idle connections after that long, defaults to
+	// DefaultIdleConnTimeout.
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+}
+
+func (cfg Config) submitConcurrency() int {
+	if cfg.SubmitConcurrency <= 0 {
+		return DefaultSubmitConcurrency
+	}
+	return cfg.SubmitConcurrency
+}
+
+// ApplicationKeyHeader carries Config.ApplicationKey.
+const ApplicationKeyHeader = "DD-APPLICATION-KEY"
+
+func NewAPIClient(cfg Config) (*APIClient, error) {
+	configuration, err := newConfiguration(cfg)
+	if err != nil {
+		return nil, err
+	}
+	apiClient := datadog.NewAPIClient(configuration)
+	client, err := newAPIClient(datadogV2.NewMetricsApi(apiClient), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SubmitMetadata {
+		client.metadata = newMetadataSubmitter(datadogV1.NewMetricsApi(apiClient))
+	}
+	return client, nil
+}
+
+// newConfiguration returns the SDK configuration for cfg. Its HTTP client, and so its
+// connection pool, is shared by every request of the client.
+func newConfiguration(cfg Config) (*datadog.Configuration, error) {
+	if cfg.MaxIdleConns < 0 {
+		return nil, fmt.Errorf("max idle connections must not be negative, got %d", cfg.MaxIdleConns)
+	}
+	if cfg.IdleConnTimeout < 0 {
+		return nil, fmt.Errorf("idle connection timeout must not be negative, got %s", cfg.IdleConnTimeout)
+	}
+	transport, err := proxy.Transport(cfg.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	// Every request goes to the same intake host, whose idle connections would otherwise be
+	// capped at http.DefaultMaxIdleConnsPerHost, fewer than the batches in flight.
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	if transport.MaxIdleConns == 0 {
+		transport.MaxIdleConns = cfg.submitConcurrency()
+	}
+	transport.MaxIdleConnsPerHost = transport.MaxIdleConns
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	if transport.IdleConnTimeout == 0 {
+		transport.IdleConnTimeout = DefaultIdleConnTimeout
+	}
 	configuration := datadog.NewConfiguration()
 	configuration.RetryConfiguration.EnableRetry = true
-	apiClient := datadog.NewAPIClient(configuration)
+	// The SDK only honors X-Ratelimit-Reset on 429s, Retry-After is handled by the transport.
+	configuration.HTTPClient = &http.Client{Transport: retryafter.NewTransport(transport)}
+	// The metrics API only authenticates with the API key, so the application key is not
+	// picked up from the context like DD_APP_KEY would be.
+	if cfg.ApplicationKey != "" {
+		configuration.AddDefaultHeader(ApplicationKeyHeader, cfg.ApplicationKey)
+	}
+	return configuration, nil
+}
+
+func newAPIClient(api metricsAPI, cfg Config) (*APIClient, error) {
+	if err := validateTags(cfg.StaticTags); err != nil {
+		return nil, fmt.Errorf("invalid static tags: %w", err)
+	}
+	sourceTag, err := sourceTag(cfg.SourceName, cfg.SourceTagKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSite(cfg.Site); err != nil {
+		return nil, err
+	}
+	if cfg.SubmitMetadata && cfg.ApplicationKey == "" && os.Getenv("DD_APP_KEY") == "" {
+		return nil, errors.New("submitting metric metadata requires an application key")
+	}
+
+	apiKey, err := newAPIKeyFile(cfg.APIKeyFile, cfg.APIKeyReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBatchSize := cfg.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = DefaultMaxBatchSize
+	}
 	return &APIClient{
-		api: datadogV2.NewMetricsApi(apiClient),
+		api:          api,
+		maxBatchSize: maxBatchSize,
+		concurrency:  cfg.submitConcurrency(),
+		staticTags:   cfg.StaticTags,
+		sourceTag:    sourceTag,
+		site:         cfg.Site,
+		limiter:      newRateLimiter(cfg.RateLimit, cfg.RateLimitBurst),
+		apiKey:       apiKey,
+		compress:     !cfg.DisableCompression,
+		appKey:       cfg.ApplicationKey,
+	}, nil
+}
+
+func validateSite(site string) error {
+	if site == "" {
+		return nil
 	}
+	for _, s := range Sites {
+		if site == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown Datadog site %q, expected one of %s", site, strings.Join(Sites, ", "))
 }
 
-func (c *APIClient) SubmitMetrics(series []datadogV2.MetricSeries) error {
-	pageNum := 0
-	pageSize := 100 // TODO: calculate this dynamically based on DD's payload size limit
-	g := new(errgroup.Group)
+// SubmitMetrics splits series into batches of at most MaxBatchSize and submits them with at
+// most SubmitConcurrency in flight, in no particular order. Every batch is attempted; the
+// returned error counts the failed batches and joins their failures.
+func (c *APIClient) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	series = withStaticTags(withSourceTag(series, c.sourceTag), c.staticTags)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		batches int
+		slots   = make(chan struct{}, c.concurrency)
+	)
 
-	for {
-		start, end := paginate(pageNum, pageSize, len(series))
+	for pageNum := 0; ; pageNum++ {
+		start, end := paginate(pageNum, c.maxBatchSize, len(series))
 		if start == end {
 			break
 		}
+		batches++
 
-		g.Go(func() error {
-			pagedSeries := series[start:end]
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(pageNum int, pagedSeries []datadogV2.MetricSeries) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := c.submitBatch(ctx, pagedSeries); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("batch %d: %w", pageNum, err))
+				mu.Unlock()
+			}
+		}(pageNum, series[start:end])
+	}
+
+	wg.Wait()
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d batches failed: %w", len(errs), batches, errors.Join(errs...))
+	}
+	c.describe(ctx, series)
+	return nil
+}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			ctx = datadog.NewDefaultContext(ctx)
-			body := datadogV2.MetricPayload{Series: pagedSeries}
+// requestContext returns ctx with the API key and site of the SDK requests.
+func (c *APIClient) requestContext(ctx context.Context) (context.Context, error) {
+	ctx, err := c.apiKey.withAPIKey(datadog.NewDefaultContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if c.site != "" {
+		ctx = context.WithValue(ctx, datadog.ContextServerVariables, map[string]string{"site": c.site})
+	}
+	return ctx, nil
+}
 
-			resp, httpr, err := c.api.SubmitMetrics(ctx, body, *datadogV2.NewSubmitMetricsOptionalParameters())
-			if err != nil {
-				return fmt.Errorf("failed to submit metrics: %w", err)
-			}
+func (c *APIClient) submitBatch(ctx context.Context, series []datadogV2.MetricSeries) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to submit metrics: %w", err)
+	}
 
-			if httpr.StatusCode != 202 {
-				return fmt.Errorf("failed to submit metrics: %+v", httpr)
-			}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	ctx, err := c.requestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to submit metrics: %w", err)
+	}
+	body := datadogV2.MetricPayload{Series: series}
 
-			if len(resp.Errors) > 0 {
-				responseContent, err := json.MarshalIndent(resp, "", "  ")
-				if err != nil {
-					return fmt.Errorf("failed to marshal Datadog response: %w", err)
-				}
-				return fmt.Errorf("failed to submit metrics: %s", responseContent)
-			}
-			return nil
-		})
+	params := datadogV2.NewSubmitMetricsOptionalParameters()
+	if c.compress {
+		params = params.WithContentEncoding(datadogV2.METRICCONTENTENCODING_GZIP)
+	}
+	resp, httpr, err := c.api.SubmitMetrics(ctx, body, *params)
+	if httpr != nil && httpr.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := retryafter.Parse(httpr, time.Now()); ok {
+			c.limiter.pause(delay)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to submit metrics: %w", err)
+	}
 
-		pageNum++
+	if httpr.StatusCode != 202 {
+		return fmt.Errorf("failed to submit metrics: %+v", httpr)
 	}
 
-	return g.Wait()
+	if len(resp.Errors) > 0 {
+		responseContent, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal Datadog response: %w", err)
+		}
+		return fmt.Errorf("failed to submit metrics: %s", responseContent)
+	}
+	return nil
 }
 
 func paginate(pageNum int, pageSize int, sliceLength int) (int, int) {
@@ -0,0 +1,412 @@
+package datadog
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetricsAPI struct {
+	mu      sync.Mutex
+	batches [][]datadogV2.MetricSeries
+	ctx     context.Context
+	fail    func(body datadogV2.MetricPayload) error
+}
+
+func (a *fakeMetricsAPI) SubmitMetrics(ctx context.Context, body datadogV2.MetricPayload, _ ...datadogV2.SubmitMetricsOptionalParameters) (datadogV2.IntakePayloadAccepted, *http.Response, error) {
+	a.mu.Lock()
+	a.batches = append(a.batches, body.Series)
+	a.ctx = ctx
+	a.mu.Unlock()
+	if a.fail != nil {
+		if err := a.fail(body); err != nil {
+			return datadogV2.IntakePayloadAccepted{}, nil, err
+		}
+	}
+	return datadogV2.IntakePayloadAccepted{}, &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func syntheticSeries(n int) []datadogV2.MetricSeries {
+	series := make([]datadogV2.MetricSeries, n)
+	for i := range series {
+		series[i] = datadogV2.MetricSeries{Metric: fmt.Sprintf("metric_%d", i)}
+	}
+	return series
+}
+
+func TestSubmitMetricsBatches(t *testing.T) {
+	testCases := []struct {
+		name         string
+		maxBatchSize int
+		numSeries    int
+		wantBatches  []int
+	}{
+		{name: "default batch size", numSeries: 2500, wantBatches: []int{500, 1000, 1000}},
+		{name: "custom batch size", maxBatchSize: 300, numSeries: 900, wantBatches: []int{300, 300, 300}},
+		{name: "single batch", maxBatchSize: 1000, numSeries: 10, wantBatches: []int{10}},
+		{name: "no series", numSeries: 0, wantBatches: []int{}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			api := &fakeMetricsAPI{}
+			client, err := newAPIClient(api, Config{MaxBatchSize: tc.maxBatchSize})
+			require.NoError(t, err)
+
+			require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(tc.numSeries)))
+
+			gotBatches := []int{}
+			for _, b := range api.batches {
+				gotBatches = append(gotBatches, len(b))
+			}
+			sort.Ints(gotBatches)
+			assert.Equal(t, tc.wantBatches, gotBatches)
+		})
+	}
+}
+
+func TestSubmitMetricsAggregatesErrors(t *testing.T) {
+	errFirst := errors.New("first batch rejected")
+	errLast := errors.New("last batch rejected")
+	api := &fakeMetricsAPI{fail: func(body datadogV2.MetricPayload) error {
+		switch body.Series[0].Metric {
+		case "metric_0":
+			return errFirst
+		case "metric_20":
+			return errLast
+		}
+		return nil
+	}}
+	client, err := newAPIClient(api, Config{MaxBatchSize: 10})
+	require.NoError(t, err)
+
+	err = client.SubmitMetrics(context.Background(), syntheticSeries(25))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errFirst)
+	assert.ErrorIs(t, err, errLast)
+	assert.Len(t, api.batches, 3, "all batches should be attempted")
+	assert.ErrorContains(t, err, "2 of 3 batches failed")
+}
+
+// inFlightMetricsAPI holds every request until release is closed, recording the peak number
+// of concurrent requests.
+type inFlightMetricsAPI struct {
+	inFlight, peak, total atomic.Int32
+	release               chan struct{}
+}
+
+func (a *inFlightMetricsAPI) SubmitMetrics(context.Context, datadogV2.MetricPayload, ...datadogV2.SubmitMetricsOptionalParameters) (datadogV2.IntakePayloadAccepted, *http.Response, error) {
+	n := a.inFlight.Add(1)
+	defer a.inFlight.Add(-1)
+	a.total.Add(1)
+	for {
+		peak := a.peak.Load()
+		if n <= peak || a.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	<-a.release
+	return datadogV2.IntakePayloadAccepted{}, &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func TestSubmitMetricsBoundedConcurrency(t *testing.T) {
+	testCases := []struct {
+		name        string
+		concurrency int
+		wantPeak    int32
+	}{
+		{name: "default", wantPeak: DefaultSubmitConcurrency},
+		{name: "custom", concurrency: 2, wantPeak: 2},
+		{name: "sequential", concurrency: 1, wantPeak: 1},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			api := &inFlightMetricsAPI{release: make(chan struct{})}
+			client, err := newAPIClient(api, Config{MaxBatchSize: 1, SubmitConcurrency: tc.concurrency})
+			require.NoError(t, err)
+
+			done := make(chan error)
+			go func() { done <- client.SubmitMetrics(context.Background(), syntheticSeries(10)) }()
+			require.Eventually(t, func() bool { return api.inFlight.Load() == tc.wantPeak }, time.Second, time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+			close(api.release)
+			require.NoError(t, <-done)
+			assert.Equal(t, tc.wantPeak, api.peak.Load())
+			assert.Equal(t, int32(10), api.total.Load())
+		})
+	}
+}
+
+func TestSubmitMetricsStaticTags(t *testing.T) {
+	api := &fakeMetricsAPI{}
+	client, err := newAPIClient(api, Config{StaticTags: []string{"env:prod", "cluster:temporal-us", "temporal_namespace:ignored"}})
+	require.NoError(t, err)
+
+	series := []datadogV2.MetricSeries{
+		{
+			Metric: "latency_P99",
+			Resources: []datadogV2.MetricResource{
+				{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")},
+			},
+		},
+		{
+			Metric: "requests_rate1m",
+			Tags:   []string{"env:staging"},
+		},
+	}
+	require.NoError(t, client.SubmitMetrics(context.Background(), series))
+
+	require.Len(t, api.batches, 1)
+	got := api.batches[0]
+	assert.ElementsMatch(t, []string{"env:prod", "cluster:temporal-us"}, got[0].Tags)
+	assert.ElementsMatch(t, []string{"env:staging", "cluster:temporal-us", "temporal_namespace:ignored"}, got[1].Tags)
+	assert.Equal(t, []string{"env:staging"}, series[1].Tags, "input series must not be modified")
+}
+
+func TestNewAPIClientRejectsInvalidStaticTags(t *testing.T) {
+	for _, tag := range []string{"env", ":prod", "env:"} {
+		_, err := newAPIClient(&fakeMetricsAPI{}, Config{StaticTags: []string{tag}})
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestSubmitMetricsSourceTag(t *testing.T) {
+	api := &fakeMetricsAPI{}
+	client, err := newAPIClient(api, Config{SourceName: "temporal-us", StaticTags: []string{"env:prod", "temporal_source:ignored"}})
+	require.NoError(t, err)
+
+	series := []datadogV2.MetricSeries{
+		{Metric: "latency_P99"},
+		{Metric: "requests_rate1m", Tags: []string{"temporal_source:stale", "env:staging"}},
+	}
+	require.NoError(t, client.SubmitMetrics(context.Background(), series))
+
+	require.Len(t, api.batches, 1)
+	got := api.batches[0]
+	assert.ElementsMatch(t, []string{"temporal_source:temporal-us", "env:prod"}, got[0].Tags)
+	assert.ElementsMatch(t, []string{"temporal_source:temporal-us", "env:staging"}, got[1].Tags,
+		"the source tag replaces existing tags of the same key")
+	assert.Equal(t, []string{"temporal_source:stale", "env:staging"}, series[1].Tags, "input series must not be modified")
+
+	client, err = newAPIClient(api, Config{SourceName: "eu", SourceTagKey: "cluster"})
+	require.NoError(t, err)
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+	assert.Equal(t, []string{"cluster:eu"}, api.batches[1][0].Tags)
+}
+
+func TestNewAPIClientRejectsInvalidSourceName(t *testing.T) {
+	for _, name := range []string{"temporal us", "us,eu"} {
+		_, err := newAPIClient(&fakeMetricsAPI{}, Config{SourceName: name})
+		assert.ErrorContains(t, err, "invalid source tag", name)
+	}
+	_, err := newAPIClient(&fakeMetricsAPI{}, Config{SourceName: "us", SourceTagKey: "bad key"})
+	assert.ErrorContains(t, err, "invalid source tag")
+}
+
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSubmitMetricsSite(t *testing.T) {
+	testCases := []struct {
+		name    string
+		site    string
+		wantURL string
+	}{
+		{name: "default", wantURL: "https://api.datadoghq.com"},
+		{name: "eu", site: "datadoghq.eu", wantURL: "https://api.datadoghq.eu"},
+		{name: "gov", site: "ddog-gov.com", wantURL: "https://api.ddog-gov.com"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DD_SITE", "")
+			os.Unsetenv("DD_SITE")
+			api := &fakeMetricsAPI{}
+			client, err := newAPIClient(api, Config{Site: tc.site})
+			require.NoError(t, err)
+			require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+
+			url, err := datadog.NewConfiguration().ServerURLWithContext(api.ctx, "v2.MetricsApi.SubmitMetrics")
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantURL, url)
+		})
+	}
+}
+
+func TestNewAPIClientRejectsUnknownSite(t *testing.T) {
+	_, err := newAPIClient(&fakeMetricsAPI{}, Config{Site: "datadoghq.example"})
+	assert.ErrorContains(t, err, `unknown Datadog site "datadoghq.example"`)
+}
+
+func TestNewAPIClientProxy(t *testing.T) {
+	connected := make(chan string, 1)
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// HTTPS traffic is tunneled with CONNECT, refusing it is enough to observe the target.
+		if r.Method == http.MethodConnect {
+			connected <- r.Host
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxySrv.Close()
+
+	client, err := NewAPIClient(Config{Site: "datadoghq.eu", ProxyURL: proxySrv.URL})
+	require.NoError(t, err)
+
+	assert.Error(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+	select {
+	case host := <-connected:
+		assert.Equal(t, "api.datadoghq.eu:443", host)
+	default:
+		t.Fatal("the request did not go through the proxy")
+	}
+}
+
+func TestNewAPIClientRejectsInvalidProxy(t *testing.T) {
+	_, err := NewAPIClient(Config{ProxyURL: "proxy.internal:3128"})
+	assert.ErrorContains(t, err, "invalid proxy URL")
+}
+
+// intakePayload decodes the series names only, MetricPayload rejects series without points.
+type intakePayload struct {
+	Series []struct {
+		Metric string `json:"metric"`
+	} `json:"series"`
+}
+
+// intakeServer returns a client submitting to a local intake, which records the decoded
+// payload and Content-Encoding of every request.
+// intake records the requests received by an intakeServer.
+type intake struct {
+	encodings []string
+	appKeys   []string
+	payloads  []intakePayload
+}
+
+func intakeServer(t *testing.T, cfg Config) (*APIClient, *intake) {
+	t.Helper()
+	received := &intake{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.encodings = append(received.encodings, r.Header.Get("Content-Encoding"))
+		received.appKeys = append(received.appKeys, r.Header.Get(ApplicationKeyHeader))
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = gz
+		}
+		var payload intakePayload
+		require.NoError(t, json.NewDecoder(body).Decode(&payload))
+		received.payloads = append(received.payloads, payload)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	configuration, err := newConfiguration(cfg)
+	require.NoError(t, err)
+	configuration.Scheme = "http"
+	configuration.Host = strings.TrimPrefix(srv.URL, "http://")
+	client, err := newAPIClient(datadogV2.NewMetricsApi(datadog.NewAPIClient(configuration)), cfg)
+	require.NoError(t, err)
+	return client, received
+}
+
+func TestSubmitMetricsCompression(t *testing.T) {
+	t.Run("gzip by default", func(t *testing.T) {
+		client, received := intakeServer(t, Config{})
+		require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(3)))
+		assert.Equal(t, []string{"gzip"}, received.encodings)
+		require.Len(t, received.payloads, 1)
+		assert.Len(t, received.payloads[0].Series, 3)
+		assert.Equal(t, "metric_0", received.payloads[0].Series[0].Metric)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client, received := intakeServer(t, Config{DisableCompression: true})
+		require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(3)))
+		assert.Equal(t, []string{""}, received.encodings)
+		require.Len(t, received.payloads, 1)
+		assert.Len(t, received.payloads[0].Series, 3)
+	})
+}
+
+func TestSubmitMetricsApplicationKey(t *testing.T) {
+	t.Run("unset by default", func(t *testing.T) {
+		client, received := intakeServer(t, Config{})
+		require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+		assert.Equal(t, []string{""}, received.appKeys)
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		client, received := intakeServer(t, Config{ApplicationKey: "app-key", MaxBatchSize: 2})
+		require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(3)))
+		assert.Equal(t, []string{"app-key", "app-key"}, received.appKeys, "every batch carries the key")
+	})
+}
+
+func TestSubmitMetricsReusesConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := Config{MaxBatchSize: 1, SubmitConcurrency: 1}
+	configuration, err := newConfiguration(cfg)
+	require.NoError(t, err)
+	configuration.Scheme = "http"
+	configuration.Host = strings.TrimPrefix(srv.URL, "http://")
+	client, err := newAPIClient(datadogV2.NewMetricsApi(datadog.NewAPIClient(configuration)), cfg)
+	require.NoError(t, err)
+
+	var dialed, reused atomic.Int32
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				reused.Add(1)
+			} else {
+				dialed.Add(1)
+			}
+		},
+	})
+	for cycle := 0; cycle < 3; cycle++ {
+		require.NoError(t, client.SubmitMetrics(ctx, syntheticSeries(4)))
+	}
+	assert.Equal(t, int32(1), dialed.Load(), "a single connection serves every batch of every cycle")
+	assert.Equal(t, int32(11), reused.Load())
+}
+
+func TestNewConfigurationConnectionPool(t *testing.T) {
+	_, err := newConfiguration(Config{MaxIdleConns: -1})
+	assert.Error(t, err)
+	_, err = newConfiguration(Config{IdleConnTimeout: -time.Second})
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package datadog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+type metadataAPI interface {
+	UpdateMetricMetadata(ctx context.Context, metricName string, body datadogV1.MetricMetadata) (datadogV1.MetricMetadata, *http.Response, error)
+}
+
+// metadataTimeout bounds a single metadata update, so that a slow metadata endpoint does not
+// hold up the submission.
+const metadataTimeout = 5 * time.Second
+
+// metadataSubmitter submits the metadata of every metric once per process. It is safe for
+// concurrent use.
+type metadataSubmitter struct {
+	api     metadataAPI
+	timeout time.Duration
+
+	mu        sync.Mutex
+	described map[string]bool
+}
+
+func newMetadataSubmitter(api metadataAPI) *metadataSubmitter {
+	return &metadataSubmitter{api: api, timeout: metadataTimeout, described: map[string]bool{}}
+}
+
+// undescribed returns the metrics of series whose metadata was not submitted yet, marking them
+// submitted: a metric is attempted once, so that a rejected update is not retried every cycle.
+func (m *metadataSubmitter) undescribed(series []datadogV2.MetricSeries) []datadogV2.MetricSeries {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := []datadogV2.MetricSeries{}
+	for _, s := range series {
+		if !m.described[s.Metric] {
+			m.described[s.Metric] = true
+			pending = append(pending, s)
+		}
+	}
+	return pending
+}
+
+// describe submits the metadata of the metrics of series not described yet. Metadata is best
+// effort: failures are logged but do not fail the submission, and each update is bounded by
+// the metadata timeout.
+func (c *APIClient) describe(ctx context.Context, series []datadogV2.MetricSeries) {
+	if c.metadata == nil {
+		return
+	}
+	for _, s := range c.metadata.undescribed(series) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.describeMetric(ctx, s); err != nil {
+			slog.Warn("Failed to submit metric metadata", "metric", s.Metric, "error", err)
+		}
+	}
+}
+
+func (c *APIClient) describeMetric(ctx context.Context, s datadogV2.MetricSeries) error {
+	ctx, cancel := context.WithTimeout(ctx, c.metadata.timeout)
+	defer cancel()
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	ctx, err := c.requestContext(ctx)
+	if err != nil {
+		return err
+	}
+	if c.appKey != "" {
+		ctx = withAuthKey(ctx, "appKeyAuth", c.appKey)
+	}
+	_, _, err = c.metadata.api.UpdateMetricMetadata(ctx, s.Metric, metricMetadata(s))
+	return err
+}
+
+// conversionSuffix matches the suffixes added to Prometheus names on conversion.
+var conversionSuffix = regexp.MustCompile(`(_P\d+|\.p\d+|\.avg|_rate1m)$`)
+
+// metricUnits maps Prometheus base unit suffixes, and names known to be in seconds, to
+// Datadog units.
+var metricUnits = []struct {
+	suffix string
+	unit   string
+}{
+	{"_milliseconds", "millisecond"},
+	{"_seconds", "second"},
+	{"_latency", "second"},
+	{"_bytes", "byte"},
+}
+
+// metricMetadata derives the metadata of a converted series from its name and type: the unit
+// of the series or else from the Prometheus unit suffix of its base name, per second for
+// rates, and a description naming the base metric.
+func metricMetadata(s datadogV2.MetricSeries) datadogV1.MetricMetadata {
+	metadata := datadogV1.MetricMetadata{}
+	base := conversionSuffix.ReplaceAllString(s.Metric, "")
+	if s.Unit != nil {
+		metadata.SetUnit(*s.Unit)
+	} else {
+		for _, u := range metricUnits {
+			if strings.HasSuffix(base, u.suffix) {
+				metadata.SetUnit(u.unit)
+				break
+			}
+		}
+	}
+
+	kind := "gauge"
+	switch s.GetType() {
+	case datadogV2.METRICINTAKETYPE_RATE:
+		kind = "rate"
+		metadata.SetPerUnit("second")
+	case datadogV2.METRICINTAKETYPE_COUNT:
+		kind = "count"
+	}
+	metadata.SetType(kind)
+
+	metadata.SetDescription(fmt.Sprintf("Temporal Cloud metric %s, exported from Prometheus as a %s", base, kind))
+	return metadata
+}
@@ -0,0 +1,120 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetadataAPI struct {
+	mu      sync.Mutex
+	updates map[string][]datadogV1.MetricMetadata
+	appKeys []string
+	fail    error
+	// hang blocks every update until its context is done.
+	hang bool
+}
+
+func (a *fakeMetadataAPI) UpdateMetricMetadata(ctx context.Context, metricName string, body datadogV1.MetricMetadata) (datadogV1.MetricMetadata, *http.Response, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.updates == nil {
+		a.updates = map[string][]datadogV1.MetricMetadata{}
+	}
+	a.updates[metricName] = append(a.updates[metricName], body)
+	keys, _ := ctx.Value(datadog.ContextAPIKeys).(map[string]datadog.APIKey)
+	a.appKeys = append(a.appKeys, keys["appKeyAuth"].Key)
+	if a.hang {
+		<-ctx.Done()
+		return datadogV1.MetricMetadata{}, nil, ctx.Err()
+	}
+	if a.fail != nil {
+		return datadogV1.MetricMetadata{}, nil, a.fail
+	}
+	return body, &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestSubmitMetricsMetadataOncePerMetric(t *testing.T) {
+	metadata := &fakeMetadataAPI{}
+	client, err := newAPIClient(&fakeMetricsAPI{}, Config{MaxBatchSize: 2, ApplicationKey: "app-key", SubmitMetadata: true})
+	require.NoError(t, err)
+	client.metadata = newMetadataSubmitter(metadata)
+
+	series := append(syntheticSeries(3), syntheticSeries(3)...)
+	require.NoError(t, client.SubmitMetrics(context.Background(), series))
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(4)))
+
+	assert.Len(t, metadata.updates, 4)
+	for name, updates := range metadata.updates {
+		assert.Len(t, updates, 1, name)
+	}
+	assert.Equal(t, []string{"app-key", "app-key", "app-key", "app-key"}, metadata.appKeys)
+}
+
+func TestSubmitMetricsMetadataIsBestEffort(t *testing.T) {
+	metadata := &fakeMetadataAPI{fail: errors.New("forbidden")}
+	client, err := newAPIClient(&fakeMetricsAPI{}, Config{ApplicationKey: "app-key", SubmitMetadata: true})
+	require.NoError(t, err)
+	client.metadata = newMetadataSubmitter(metadata)
+
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+	assert.Len(t, metadata.updates["metric_0"], 1, "a rejected update is not retried")
+}
+
+func TestSubmitMetricsMetadataTimeout(t *testing.T) {
+	metadata := &fakeMetadataAPI{hang: true}
+	client, err := newAPIClient(&fakeMetricsAPI{}, Config{ApplicationKey: "app-key", SubmitMetadata: true})
+	require.NoError(t, err)
+	client.metadata = newMetadataSubmitter(metadata)
+	client.metadata.timeout = 10 * time.Millisecond
+
+	started := time.Now()
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(3)))
+	assert.Less(t, time.Since(started), time.Second, "each update is bounded by the metadata timeout")
+	assert.Len(t, metadata.updates, 3, "a timed out update does not skip the next metrics")
+}
+
+func TestSubmitMetricsMetadataRequiresApplicationKey(t *testing.T) {
+	t.Setenv("DD_APP_KEY", "")
+	_, err := newAPIClient(&fakeMetricsAPI{}, Config{SubmitMetadata: true})
+	assert.ErrorContains(t, err, "application key")
+}
+
+func TestMetricMetadata(t *testing.T) {
+	series := func(name string, metricType datadogV2.MetricIntakeType) datadogV2.MetricSeries {
+		return datadogV2.MetricSeries{Metric: name, Type: metricType.Ptr()}
+	}
+
+	latency := metricMetadata(series("temporal_cloud_v0_service_latency_P99", datadogV2.METRICINTAKETYPE_GAUGE))
+	assert.Equal(t, "second", latency.GetUnit())
+	assert.Equal(t, "gauge", latency.GetType())
+	assert.Equal(t, "Temporal Cloud metric temporal_cloud_v0_service_latency, exported from Prometheus as a gauge", latency.GetDescription())
+
+	converted := series("temporal_cloud_v0_service_latency_P99", datadogV2.METRICINTAKETYPE_GAUGE)
+	converted.Unit = datadog.PtrString("millisecond")
+	convertedMetadata := metricMetadata(converted)
+	assert.Equal(t, "millisecond", convertedMetadata.GetUnit(), "the unit of the series wins")
+
+	dotted := metricMetadata(series("temporal_cloud_v0_service_latency.p50", datadogV2.METRICINTAKETYPE_GAUGE))
+	assert.Equal(t, "second", dotted.GetUnit())
+
+	rate := metricMetadata(series("temporal_cloud_v0_frontend_service_request_rate1m", datadogV2.METRICINTAKETYPE_RATE))
+	assert.False(t, rate.HasUnit())
+	assert.Equal(t, "second", rate.GetPerUnit())
+	assert.Equal(t, "rate", rate.GetType())
+
+	bytes := metricMetadata(series("payload_size_bytes", datadogV2.METRICINTAKETYPE_COUNT))
+	assert.Equal(t, "byte", bytes.GetUnit())
+	assert.Equal(t, "count", bytes.GetType())
+	assert.False(t, bytes.HasPerUnit())
+}
@@ -0,0 +1,78 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// FailurePolicy decides whether a failed backend fails a MultiSubmitter submission.
+type FailurePolicy string
+
+const (
+	// FailOnAny fails the submission when any backend failed, the default.
+	FailOnAny FailurePolicy = "any"
+	// FailOnAll only fails the submission when every backend failed, logging the failures
+	// of the others, so that a secondary backend cannot hold back the primary one.
+	FailOnAll FailurePolicy = "all"
+)
+
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch p := FailurePolicy(s); p {
+	case "", FailOnAny:
+		return FailOnAny, nil
+	case FailOnAll:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown failure policy %q, want %q or %q", s, FailOnAny, FailOnAll)
+	}
+}
+
+// MultiSubmitter forwards every submission to all its submitters concurrently, for instance to
+// double-write to Datadog and OTLP during a migration.
+type MultiSubmitter struct {
+	submitters []Submitter
+	policy     FailurePolicy
+}
+
+func NewMultiSubmitter(policy FailurePolicy, submitters ...Submitter) *MultiSubmitter {
+	return &MultiSubmitter{submitters: submitters, policy: policy}
+}
+
+// SubmitMetrics submits the series to every submitter and aggregates their errors according to
+// the failure policy. Submitters share the series and must not modify them.
+func (m *MultiSubmitter) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	errs := make([]error, len(m.submitters))
+	var wg sync.WaitGroup
+	for i, submitter := range m.submitters {
+		i, submitter := i, submitter
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := submitter.SubmitMetrics(ctx, series); err != nil {
+				errs[i] = fmt.Errorf("submitter %d: %w", i+1, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if m.policy == FailOnAll && failed < len(m.submitters) {
+		for _, err := range errs {
+			if err != nil {
+				slog.Warn("Submission failed on one of the outputs", "error", err)
+			}
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type funcSubmitter func(ctx context.Context, series []datadogV2.MetricSeries) error
+
+func (f funcSubmitter) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	return f(ctx, series)
+}
+
+func TestMultiSubmitterForwardsToAll(t *testing.T) {
+	first, second := &fakeMetricsAPI{}, &fakeMetricsAPI{}
+	firstClient, err := newAPIClient(first, Config{})
+	require.NoError(t, err)
+	secondClient, err := newAPIClient(second, Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, NewMultiSubmitter(FailOnAny, firstClient, secondClient).SubmitMetrics(context.Background(), syntheticSeries(3)))
+	require.Len(t, first.batches, 1)
+	require.Len(t, second.batches, 1)
+	assert.Equal(t, syntheticSeries(3), first.batches[0])
+	assert.Equal(t, syntheticSeries(3), second.batches[0])
+}
+
+func TestMultiSubmitterRunsConcurrently(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := funcSubmitter(func(context.Context, []datadogV2.MetricSeries) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewMultiSubmitter(FailOnAny, blocking, blocking).SubmitMetrics(context.Background(), syntheticSeries(1))
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("submitters did not run concurrently")
+		}
+	}
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestMultiSubmitterFailurePolicy(t *testing.T) {
+	errRejected := errors.New("rejected")
+	ok := funcSubmitter(func(context.Context, []datadogV2.MetricSeries) error { return nil })
+	failing := funcSubmitter(func(context.Context, []datadogV2.MetricSeries) error { return errRejected })
+
+	err := NewMultiSubmitter(FailOnAny, ok, failing).SubmitMetrics(context.Background(), syntheticSeries(1))
+	assert.ErrorIs(t, err, errRejected)
+	assert.ErrorContains(t, err, "submitter 2")
+
+	assert.NoError(t, NewMultiSubmitter(FailOnAll, ok, failing).SubmitMetrics(context.Background(), syntheticSeries(1)))
+	assert.ErrorIs(t, NewMultiSubmitter(FailOnAll, failing, failing).SubmitMetrics(context.Background(), syntheticSeries(1)), errRejected)
+}
+
+func TestParseFailurePolicy(t *testing.T) {
+	for s, want := range map[string]FailurePolicy{"": FailOnAny, "any": FailOnAny, "all": FailOnAll} {
+		got, err := ParseFailurePolicy(s)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseFailurePolicy("some")
+	assert.Error(t, err)
+}
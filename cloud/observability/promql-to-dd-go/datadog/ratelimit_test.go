@@ -0,0 +1,109 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timedMetricsAPI records when every request arrives and answers with respond.
+type timedMetricsAPI struct {
+	mu      sync.Mutex
+	times   []time.Time
+	respond func(n int) (*http.Response, error)
+}
+
+func (a *timedMetricsAPI) SubmitMetrics(context.Context, datadogV2.MetricPayload, ...datadogV2.SubmitMetricsOptionalParameters) (datadogV2.IntakePayloadAccepted, *http.Response, error) {
+	a.mu.Lock()
+	a.times = append(a.times, time.Now())
+	n := len(a.times)
+	a.mu.Unlock()
+	if a.respond != nil {
+		resp, err := a.respond(n)
+		return datadogV2.IntakePayloadAccepted{}, resp, err
+	}
+	return datadogV2.IntakePayloadAccepted{}, &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func TestSubmitMetricsRateLimit(t *testing.T) {
+	api := &timedMetricsAPI{}
+	client, err := newAPIClient(api, Config{MaxBatchSize: 1, RateLimit: 20, RateLimitBurst: 2})
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(6)))
+
+	// Two batches go out with the burst, the remaining four are spaced by 50ms each.
+	require.Len(t, api.times, 6)
+	assert.GreaterOrEqual(t, api.times[5].Sub(start), 190*time.Millisecond)
+	assert.Less(t, api.times[1].Sub(start), 40*time.Millisecond)
+}
+
+func TestSubmitMetricsRetryAfterPausesLimiter(t *testing.T) {
+	api := &timedMetricsAPI{respond: func(n int) (*http.Response, error) {
+		if n == 1 {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", "1")
+			return resp, errors.New("429 Too Many Requests")
+		}
+		return &http.Response{StatusCode: http.StatusAccepted}, nil
+	}}
+	client, err := newAPIClient(api, Config{RateLimit: 1000, RateLimitBurst: 10})
+	require.NoError(t, err)
+
+	assert.Error(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+	start := time.Now()
+	require.NoError(t, client.SubmitMetrics(context.Background(), syntheticSeries(1)))
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond, "the next request waits for Retry-After")
+}
+
+func TestRateLimiterWaitRespectsContext(t *testing.T) {
+	l := newRateLimiter(1, 1)
+	require.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestAPIClientHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(Config{})
+	require.NoError(t, err)
+
+	// Point the SDK at the test server instead of a Datadog site.
+	ctx := context.WithValue(context.Background(), datadog.ContextServerIndex, 1)
+	ctx = context.WithValue(ctx, datadog.ContextServerVariables, map[string]string{
+		"protocol": "http",
+		"name":     strings.TrimPrefix(srv.URL, "http://"),
+	})
+	start := time.Now()
+	_, httpr, err := client.api.SubmitMetrics(ctx, datadogV2.MetricPayload{Series: syntheticSeries(1)})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, httpr.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,41 @@
+package datadog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// StdoutSubmitter writes every submission as a Datadog intake payload, one JSON document per
+// line, instead of sending it anywhere. Unlike dry-run it is a regular backend, for local
+// debugging and pipeline tests. It is safe for concurrent use.
+type StdoutSubmitter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewStdoutSubmitter returns a StdoutSubmitter writing to out, typically os.Stdout.
+func NewStdoutSubmitter(out io.Writer) *StdoutSubmitter {
+	return &StdoutSubmitter{out: out}
+}
+
+func (s *StdoutSubmitter) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(datadogV2.MetricPayload{Series: series})
+	if err != nil {
+		return fmt.Errorf("failed to marshal series: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.out.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write series: %w", err)
+	}
+	return nil
+}
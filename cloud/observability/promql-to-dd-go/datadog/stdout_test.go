@@ -0,0 +1,58 @@
+package datadog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdoutSubmitter(t *testing.T) {
+	var out bytes.Buffer
+	submitter := NewStdoutSubmitter(&out)
+
+	series := []datadogV2.MetricSeries{{
+		Metric: "temporal_cloud_v0_pending_tasks",
+		Type:   datadogV2.METRICINTAKETYPE_GAUGE.Ptr(),
+		Points: []datadogV2.MetricPoint{{Timestamp: Ptr(int64(1257894000)), Value: Ptr(12.5)}},
+		Resources: []datadogV2.MetricResource{
+			{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")},
+		},
+		Tags: []string{"env:prod"},
+	}}
+	require.NoError(t, submitter.SubmitMetrics(context.Background(), series))
+	require.NoError(t, submitter.SubmitMetrics(context.Background(), syntheticSeries(2)))
+
+	scanner := bufio.NewScanner(&out)
+	lines := []map[string]any{}
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 2, "one JSON document per batch")
+
+	assert.Equal(t, map[string]any{
+		"series": []any{map[string]any{
+			"metric":    "temporal_cloud_v0_pending_tasks",
+			"type":      float64(3),
+			"points":    []any{map[string]any{"timestamp": float64(1257894000), "value": 12.5}},
+			"resources": []any{map[string]any{"type": "temporal_namespace", "name": "disneyland"}},
+			"tags":      []any{"env:prod"},
+		}},
+	}, lines[0])
+	assert.Len(t, lines[1]["series"], 2)
+}
+
+func TestStdoutSubmitterCancelled(t *testing.T) {
+	var out bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, NewStdoutSubmitter(&out).SubmitMetrics(ctx, syntheticSeries(1)))
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,97 @@
+package datadog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// DefaultSourceTagKey is the tag key of Config.SourceName.
+const DefaultSourceTagKey = "temporal_source"
+
+// sourceTag returns the tag added for name, empty when name is empty.
+func sourceTag(name, key string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if key == "" {
+		key = DefaultSourceTagKey
+	}
+	tag := key + ":" + name
+	if strings.ContainsAny(tag, ", ") || validateTags([]string{tag}) != nil {
+		return "", fmt.Errorf("invalid source tag %q, expected key:value without spaces or commas", tag)
+	}
+	return tag, nil
+}
+
+// validateTags checks that every tag has the key:value form.
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || key == "" || value == "" {
+			return fmt.Errorf("invalid tag %q, expected key:value", tag)
+		}
+	}
+	return nil
+}
+
+func tagKey(tag string) string {
+	key, _, _ := strings.Cut(tag, ":")
+	return key
+}
+
+// withStaticTags returns a copy of series with the static tags appended. A static tag is
+// skipped for a series that already carries the same key, either as a tag or as a resource
+// derived from a Prometheus label. The input series are not modified.
+func withStaticTags(series []datadogV2.MetricSeries, staticTags []string) []datadogV2.MetricSeries {
+	if len(staticTags) == 0 {
+		return series
+	}
+
+	tagged := make([]datadogV2.MetricSeries, len(series))
+	for i, s := range series {
+		existing := map[string]bool{}
+		for _, tag := range s.Tags {
+			existing[tagKey(tag)] = true
+		}
+		for _, r := range s.Resources {
+			if r.Type != nil {
+				existing[*r.Type] = true
+			}
+		}
+
+		tags := make([]string, len(s.Tags), len(s.Tags)+len(staticTags))
+		copy(tags, s.Tags)
+		for _, tag := range staticTags {
+			if !existing[tagKey(tag)] {
+				tags = append(tags, tag)
+			}
+		}
+		s.Tags = tags
+		tagged[i] = s
+	}
+	return tagged
+}
+
+// withSourceTag returns a copy of series with the source tag appended, replacing the tags of
+// the same key. The input series are not modified.
+func withSourceTag(series []datadogV2.MetricSeries, sourceTag string) []datadogV2.MetricSeries {
+	if sourceTag == "" {
+		return series
+	}
+
+	key := tagKey(sourceTag)
+	tagged := make([]datadogV2.MetricSeries, len(series))
+	for i, s := range series {
+		tags := make([]string, 0, len(s.Tags)+1)
+		for _, tag := range s.Tags {
+			if tagKey(tag) != key {
+				tags = append(tags, tag)
+			}
+		}
+		s.Tags = append(tags, sourceTag)
+		tagged[i] = s
+	}
+	return tagged
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type CycleReporter interface {
+	LastCycle() (lastSuccess, lastFailure time.Time)
+}
+
+// SubmissionReporter is optionally implemented by a CycleReporter to report the last
+// successful submission. A zero time means nothing was submitted yet, as in dry-run mode.
+type SubmissionReporter interface {
+	LastSubmission() time.Time
+}
+
+// Pauser is optionally implemented by a CycleReporter whose submissions can be paused at
+// runtime, see RegisterPauseHandlers.
+type Pauser interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// RegisterHandlers adds /healthz and /readyz to mux. /healthz reports the process is alive,
+// /readyz succeeds only if the most recent cycle succeeded no longer than staleness ago and,
+// for a SubmissionReporter, the last submission is not older than staleness either. A paused
+// Pauser stays alive and ready, /healthz reporting it is paused.
+func RegisterHandlers(mux *http.ServeMux, reporter CycleReporter, staleness time.Duration) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if pauser, ok := reporter.(Pauser); ok && pauser.Paused() {
+			fmt.Fprintln(w, "ok, submission paused")
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := ready(reporter, staleness, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		if submissions, ok := reporter.(SubmissionReporter); ok && !submissions.LastSubmission().IsZero() {
+			fmt.Fprintf(w, "ok, last submission at %s\n", submissions.LastSubmission().Format(time.RFC3339))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+func ready(reporter CycleReporter, staleness time.Duration, now time.Time) error {
+	lastSuccess, lastFailure := reporter.LastCycle()
+	switch {
+	case lastSuccess.IsZero():
+		return fmt.Errorf("no successful cycle yet")
+	case !lastFailure.Before(lastSuccess):
+		return fmt.Errorf("last cycle failed at %s", lastFailure.Format(time.RFC3339))
+	case now.Sub(lastSuccess) > staleness:
+		return fmt.Errorf("last successful cycle at %s is older than %s", lastSuccess.Format(time.RFC3339), staleness)
+	}
+	if pauser, ok := reporter.(Pauser); ok && pauser.Paused() {
+		// Nothing is submitted while paused.
+		return nil
+	}
+	if submissions, ok := reporter.(SubmissionReporter); ok {
+		if last := submissions.LastSubmission(); !last.IsZero() && now.Sub(last) > staleness {
+			return fmt.Errorf("last successful submission at %s is older than %s", last.Format(time.RFC3339), staleness)
+		}
+	}
+	return nil
+}
+
+// RegisterPauseHandlers adds POST /pause and POST /resume to mux, stopping and restarting the
+// submissions of pauser without restarting the process.
+func RegisterPauseHandlers(mux *http.ServeMux, pauser Pauser) {
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pauser.Pause()
+		fmt.Fprintln(w, "submission paused")
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pauser.Resume()
+		fmt.Fprintln(w, "submission resumed")
+	})
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReporter struct {
+	lastSuccess    time.Time
+	lastFailure    time.Time
+	lastSubmission time.Time
+}
+
+func (r *fakeReporter) LastCycle() (time.Time, time.Time) {
+	return r.lastSuccess, r.lastFailure
+}
+
+func (r *fakeReporter) LastSubmission() time.Time {
+	return r.lastSubmission
+}
+
+func TestHandlers(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name       string
+		reporter   *fakeReporter
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "healthz always ok", reporter: &fakeReporter{}, path: "/healthz", wantStatus: http.StatusOK},
+		{name: "not ready before first cycle", reporter: &fakeReporter{}, path: "/readyz", wantStatus: http.StatusServiceUnavailable},
+		{name: "ready after recent success", reporter: &fakeReporter{lastSuccess: now}, path: "/readyz", wantStatus: http.StatusOK},
+		{
+			name:       "ready after recovering from failure",
+			reporter:   &fakeReporter{lastSuccess: now, lastFailure: now.Add(-time.Minute)},
+			path:       "/readyz",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "not ready after failure",
+			reporter:   &fakeReporter{lastSuccess: now.Add(-time.Minute), lastFailure: now},
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "not ready when stale",
+			reporter:   &fakeReporter{lastSuccess: now.Add(-time.Hour)},
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "ready after recent submission",
+			reporter:   &fakeReporter{lastSuccess: now, lastSubmission: now.Add(-time.Minute)},
+			path:       "/readyz",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok, last submission at " + now.Add(-time.Minute).Format(time.RFC3339) + "\n",
+		},
+		{
+			name:       "not ready when the last submission is stale",
+			reporter:   &fakeReporter{lastSuccess: now, lastSubmission: now.Add(-time.Hour)},
+			path:       "/readyz",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			RegisterHandlers(mux, tc.reporter, 10*time.Minute)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+type pausableReporter struct {
+	fakeReporter
+	paused bool
+}
+
+func (r *pausableReporter) Pause()       { r.paused = true }
+func (r *pausableReporter) Resume()      { r.paused = false }
+func (r *pausableReporter) Paused() bool { return r.paused }
+
+func TestPauseHandlers(t *testing.T) {
+	now := time.Now()
+	reporter := &pausableReporter{fakeReporter: fakeReporter{lastSuccess: now, lastSubmission: now.Add(-time.Hour)}}
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, reporter, 10*time.Minute)
+	RegisterPauseHandlers(mux, reporter)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	assert.Equal(t, "ok\n", serve(http.MethodGet, "/healthz").Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, serve(http.MethodGet, "/readyz").Code)
+
+	rec := serve(http.MethodGet, "/pause")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	assert.False(t, reporter.paused)
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/pause").Code)
+	assert.True(t, reporter.paused)
+	assert.Equal(t, "ok, submission paused\n", serve(http.MethodGet, "/healthz").Body.String())
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/readyz").Code, "a stale submission is expected while paused")
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/resume").Code)
+	assert.False(t, reporter.paused)
+	assert.Equal(t, "ok\n", serve(http.MethodGet, "/healthz").Body.String())
+}
@@ -0,0 +1,208 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+
+	"github.com/temporalio/promql-to-dd-go/proxy"
+)
+
+// APIClient exports series to an OpenTelemetry collector using OTLP/HTTP with JSON encoding.
+// It satisfies the same submitter role as the Datadog client.
+type APIClient struct {
+	endpoint   string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+type Config struct {
+	// Endpoint is the base URL of the collector, e.g. http://otel-collector:4318.
+	// The /v1/metrics path is appended unless already present.
+	Endpoint string
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string
+	// Timeout bounds a single export request. Defaults to 10 seconds.
+	Timeout time.Duration
+	// ProxyURL routes requests through a proxy. When empty HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY are honored.
+	ProxyURL string
+}
+
+func NewAPIClient(cfg Config) (*APIClient, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: scheme must be http or https", cfg.Endpoint)
+	}
+	if !strings.HasSuffix(u.Path, "/v1/metrics") {
+		u.Path = strings.TrimRight(u.Path, "/") + "/v1/metrics"
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	transport, err := proxy.Transport(cfg.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIClient{
+		endpoint:   u.String(),
+		headers:    cfg.Headers,
+		httpClient: &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+func (c *APIClient) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	body, err := json.Marshal(toExportRequest(series))
+	if err != nil {
+		return fmt.Errorf("failed to marshal OTLP request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "promql-to-dd")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to export metrics: %s: %s", resp.Status, respBody)
+	}
+	return nil
+}
+
+// The types below mirror the OTLP/JSON encoding of ExportMetricsServiceRequest.
+type (
+	exportRequest struct {
+		ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+	}
+
+	resourceMetrics struct {
+		Resource     resource       `json:"resource"`
+		ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+	}
+
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+
+	scopeMetrics struct {
+		Scope   scope    `json:"scope"`
+		Metrics []metric `json:"metrics"`
+	}
+
+	scope struct {
+		Name string `json:"name"`
+	}
+
+	metric struct {
+		Name  string `json:"name"`
+		Unit  string `json:"unit,omitempty"`
+		Gauge *gauge `json:"gauge,omitempty"`
+		Sum   *sum   `json:"sum,omitempty"`
+	}
+
+	gauge struct {
+		DataPoints []numberDataPoint `json:"dataPoints"`
+	}
+
+	sum struct {
+		DataPoints             []numberDataPoint `json:"dataPoints"`
+		AggregationTemporality int               `json:"aggregationTemporality"`
+		IsMonotonic            bool              `json:"isMonotonic"`
+	}
+
+	numberDataPoint struct {
+		Attributes   []keyValue `json:"attributes"`
+		TimeUnixNano string     `json:"timeUnixNano"`
+		AsDouble     float64    `json:"asDouble"`
+	}
+
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+
+	anyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+const aggregationTemporalityCumulative = 2
+
+// toExportRequest maps gauges (including histogram quantiles) to OTLP gauges, rates to
+// gauges with a per-second unit and raw counts to cumulative monotonic sums. Prometheus
+// labels and key:value tags become data point attributes.
+func toExportRequest(series []datadogV2.MetricSeries) exportRequest {
+	metrics := make([]metric, 0, len(series))
+	for _, s := range series {
+		attributes := []keyValue{}
+		for _, r := range s.Resources {
+			if r.Type != nil && r.Name != nil {
+				attributes = append(attributes, keyValue{Key: *r.Type, Value: anyValue{StringValue: *r.Name}})
+			}
+		}
+		for _, tag := range s.Tags {
+			if key, value, ok := strings.Cut(tag, ":"); ok {
+				attributes = append(attributes, keyValue{Key: key, Value: anyValue{StringValue: value}})
+			}
+		}
+
+		points := make([]numberDataPoint, 0, len(s.Points))
+		for _, p := range s.Points {
+			if p.Timestamp == nil || p.Value == nil {
+				continue
+			}
+			points = append(points, numberDataPoint{
+				Attributes:   attributes,
+				TimeUnixNano: strconv.FormatInt(time.Unix(*p.Timestamp, 0).UnixNano(), 10),
+				AsDouble:     *p.Value,
+			})
+		}
+
+		m := metric{Name: s.Metric}
+		switch s.GetType() {
+		case datadogV2.METRICINTAKETYPE_COUNT:
+			m.Sum = &sum{DataPoints: points, AggregationTemporality: aggregationTemporalityCumulative, IsMonotonic: true}
+		case datadogV2.METRICINTAKETYPE_RATE:
+			m.Unit = "1/s"
+			m.Gauge = &gauge{DataPoints: points}
+		default:
+			m.Gauge = &gauge{DataPoints: points}
+		}
+		metrics = append(metrics, m)
+	}
+
+	return exportRequest{ResourceMetrics: []resourceMetrics{{
+		Resource: resource{Attributes: []keyValue{
+			{Key: "service.name", Value: anyValue{StringValue: "promql-to-dd"}},
+		}},
+		ScopeMetrics: []scopeMetrics{{
+			Scope:   scope{Name: "github.com/temporalio/promql-to-dd-go"},
+			Metrics: metrics,
+		}},
+	}}}
+}
@@ -0,0 +1,102 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSubmitMetricsToReceiver(t *testing.T) {
+	var (
+		gotPath    string
+		gotHeaders http.Header
+		gotRequest exportRequest
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotHeaders = r.Header
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&gotRequest))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	client, err := NewAPIClient(Config{Endpoint: receiver.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	require.NoError(t, err)
+
+	series := []datadogV2.MetricSeries{
+		{
+			Metric:    "latency_P99",
+			Type:      datadogV2.METRICINTAKETYPE_GAUGE.Ptr(),
+			Points:    []datadogV2.MetricPoint{{Timestamp: Ptr(int64(1257894000)), Value: Ptr(0.25)}},
+			Resources: []datadogV2.MetricResource{{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")}},
+			Tags:      []string{"env:prod"},
+		},
+		{
+			Metric: "requests_rate1m",
+			Type:   datadogV2.METRICINTAKETYPE_RATE.Ptr(),
+			Points: []datadogV2.MetricPoint{{Timestamp: Ptr(int64(1257894000)), Value: Ptr(3.5)}},
+		},
+		{
+			Metric: "requests_count",
+			Type:   datadogV2.METRICINTAKETYPE_COUNT.Ptr(),
+			Points: []datadogV2.MetricPoint{{Timestamp: Ptr(int64(1257894000)), Value: Ptr(42.0)}},
+		},
+	}
+	require.NoError(t, client.SubmitMetrics(context.Background(), series))
+
+	assert.Equal(t, "/v1/metrics", gotPath)
+	assert.Equal(t, "application/json", gotHeaders.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", gotHeaders.Get("Authorization"))
+
+	require.Len(t, gotRequest.ResourceMetrics, 1)
+	require.Len(t, gotRequest.ResourceMetrics[0].ScopeMetrics, 1)
+	metrics := gotRequest.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 3)
+
+	gaugeMetric := metrics[0]
+	assert.Equal(t, "latency_P99", gaugeMetric.Name)
+	require.NotNil(t, gaugeMetric.Gauge)
+	require.Len(t, gaugeMetric.Gauge.DataPoints, 1)
+	assert.Equal(t, "1257894000000000000", gaugeMetric.Gauge.DataPoints[0].TimeUnixNano)
+	assert.Equal(t, 0.25, gaugeMetric.Gauge.DataPoints[0].AsDouble)
+	assert.ElementsMatch(t, []keyValue{
+		{Key: "temporal_namespace", Value: anyValue{StringValue: "disneyland"}},
+		{Key: "env", Value: anyValue{StringValue: "prod"}},
+	}, gaugeMetric.Gauge.DataPoints[0].Attributes)
+
+	rateMetric := metrics[1]
+	require.NotNil(t, rateMetric.Gauge)
+	assert.Equal(t, "1/s", rateMetric.Unit)
+
+	countMetric := metrics[2]
+	require.NotNil(t, countMetric.Sum)
+	assert.Nil(t, countMetric.Gauge)
+	assert.True(t, countMetric.Sum.IsMonotonic)
+	assert.Equal(t, aggregationTemporalityCumulative, countMetric.Sum.AggregationTemporality)
+}
+
+func TestSubmitMetricsReceiverError(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	client, err := NewAPIClient(Config{Endpoint: receiver.URL + "/v1/metrics"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, client.SubmitMetrics(context.Background(), nil), "400")
+}
+
+func TestNewAPIClientInvalidEndpoint(t *testing.T) {
+	_, err := NewAPIClient(Config{Endpoint: "otel-collector:4318"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bearerAuthRoundTripper sets an Authorization header on every request. When a token file is
+// configured it takes precedence over the static token and is re-read whenever its
+// modification time changes, so rotated tokens are picked up without a restart.
+type bearerAuthRoundTripper struct {
+	next      http.RoundTripper
+	token     string
+	tokenFile string
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+func newBearerAuthRoundTripper(next http.RoundTripper, token, tokenFile string) *bearerAuthRoundTripper {
+	return &bearerAuthRoundTripper{next: next, token: token, tokenFile: tokenFile}
+}
+
+func (rt *bearerAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := rt.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		// RoundTrippers must not modify the caller's request.
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return rt.next.RoundTrip(req)
+}
+
+func (rt *bearerAuthRoundTripper) currentToken() (string, error) {
+	if rt.tokenFile == "" {
+		return rt.token, nil
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	info, err := os.Stat(rt.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat bearer token file: %w", err)
+	}
+	if info.ModTime().Equal(rt.modTime) && rt.token != "" {
+		return rt.token, nil
+	}
+	b, err := os.ReadFile(rt.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bearer token file: %w", err)
+	}
+	rt.token = strings.TrimSpace(string(b))
+	rt.modTime = info.ModTime()
+	return rt.token, nil
+}
+
+// basicAuthRoundTripper sets HTTP basic auth credentials on every request, for proxies in
+// front of Prometheus that do not accept bearer tokens.
+type basicAuthRoundTripper struct {
+	next     http.RoundTripper
+	username string
+	password string
+}
+
+func newBasicAuthRoundTripper(next http.RoundTripper, username, password string) *basicAuthRoundTripper {
+	return &basicAuthRoundTripper{next: next, username: username, password: password}
+}
+
+func (rt *basicAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(rt.username, rt.password)
+	return rt.next.RoundTrip(req)
+}
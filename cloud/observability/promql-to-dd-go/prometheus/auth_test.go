@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func authServer(t *testing.T) (*httptest.Server, *string) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestBearerAuthRoundTripperStaticToken(t *testing.T) {
+	srv, got := authServer(t)
+	client := &http.Client{Transport: newBearerAuthRoundTripper(http.DefaultTransport, "s3cr3t", "")}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "Bearer s3cr3t", *got)
+	assert.Empty(t, req.Header.Get("Authorization"), "the caller's request must not be modified")
+}
+
+func TestBearerAuthRoundTripperTokenFileRotation(t *testing.T) {
+	srv, got := authServer(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("first\n"), 0o600))
+	client := &http.Client{Transport: newBearerAuthRoundTripper(http.DefaultTransport, "ignored", tokenFile)}
+
+	get := func() string {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return *got
+	}
+	assert.Equal(t, "Bearer first", get())
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("second\n"), 0o600))
+	// Make sure the modification time changes even on filesystems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(tokenFile, later, later))
+	assert.Equal(t, "Bearer second", get())
+}
+
+func TestBearerAuthRoundTripperMissingTokenFile(t *testing.T) {
+	client := &http.Client{Transport: newBearerAuthRoundTripper(http.DefaultTransport, "", filepath.Join(t.TempDir(), "missing"))}
+	_, err := client.Get("http://127.0.0.1:0")
+	assert.ErrorContains(t, err, "bearer token file")
+}
+
+func TestBasicAuthRoundTripper(t *testing.T) {
+	srv, got := authServer(t)
+	client := &http.Client{Transport: newBasicAuthRoundTripper(http.DefaultTransport, "exporter", "s3cr3t")}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "Basic ZXhwb3J0ZXI6czNjcjN0", *got)
+	assert.Empty(t, req.Header.Get("Authorization"), "the caller's request must not be modified")
+}
+
+func TestAPIClientBasicAuthOverTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "exporter" || password != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":["temporal_cloud_v0_frontend_service_requests_count"]}`))
+	}))
+	defer srv.Close()
+	serverCA := filepath.Join(t.TempDir(), "server-ca.pem")
+	writePEM(t, serverCA, "CERTIFICATE", srv.Certificate().Raw)
+
+	client, err := NewAPIClient(Config{TargetHost: srv.URL, ServerRootCACert: serverCA, BasicAuthUsername: "exporter", BasicAuthPassword: "s3cr3t"})
+	require.NoError(t, err)
+	metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_v0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_cloud_v0_frontend_service_requests_count"}, metrics.Counters)
+
+	client, err = NewAPIClient(Config{TargetHost: srv.URL, ServerRootCACert: serverCA, BasicAuthUsername: "exporter", BasicAuthPassword: "wrong"})
+	require.NoError(t, err)
+	_, err = client.ListMetrics(context.Background(), "temporal_cloud_v0")
+	assert.Error(t, err)
+
+	_, err = NewAPIClient(Config{TargetHost: srv.URL, BasicAuthUsername: "exporter", BearerToken: "token"})
+	assert.ErrorContains(t, err, "mutually exclusive")
+	_, err = NewAPIClient(Config{TargetHost: srv.URL, BasicAuthPassword: "s3cr3t"})
+	assert.ErrorContains(t, err, "without a username")
+}
@@ -0,0 +1,72 @@
+package prometheus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// DefaultMetricListTTL is how long discovered metric names are reused by CachingQuerier.
+const DefaultMetricListTTL = 5 * time.Minute
+
+// CachingQuerier caches ListMetrics results per prefix for a TTL while passing QueryMetrics
+// through. It is safe for concurrent use.
+type CachingQuerier struct {
+	Querier
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedMetricNames
+}
+
+type cachedMetricNames struct {
+	names     MetricNames
+	expiresAt time.Time
+}
+
+func NewCachingQuerier(querier Querier, ttl time.Duration) *CachingQuerier {
+	if ttl <= 0 {
+		ttl = DefaultMetricListTTL
+	}
+	return &CachingQuerier{
+		Querier: querier,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cachedMetricNames{},
+	}
+}
+
+func (c *CachingQuerier) ListMetrics(ctx context.Context, metricPrefix string) (MetricNames, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[metricPrefix]; ok && c.now().Before(entry.expiresAt) {
+		return entry.names, nil
+	}
+
+	names, err := c.Querier.ListMetrics(ctx, metricPrefix)
+	if err != nil {
+		return MetricNames{}, err
+	}
+	c.entries[metricPrefix] = cachedMetricNames{names: names, expiresAt: c.now().Add(c.ttl)}
+	return names, nil
+}
+
+func (c *CachingQuerier) QueryMetrics(ctx context.Context, promql string, queryRange promapi.Range) (model.Matrix, error) {
+	return c.Querier.QueryMetrics(ctx, promql, queryRange)
+}
+
+func (c *CachingQuerier) QueryInstant(ctx context.Context, promql string, ts time.Time) (model.Vector, error) {
+	return c.Querier.QueryInstant(ctx, promql, ts)
+}
+
+// Refresh drops all cached metric names so the next ListMetrics call discovers them again.
+func (c *CachingQuerier) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]cachedMetricNames{}
+}
@@ -0,0 +1,76 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingQuerier struct {
+	calls int
+	err   error
+}
+
+func (q *countingQuerier) ListMetrics(_ context.Context, metricPrefix string) (MetricNames, error) {
+	q.calls++
+	if q.err != nil {
+		return MetricNames{}, q.err
+	}
+	return MetricNames{Gauges: []string{metricPrefix + "gauge"}}, nil
+}
+
+func (q *countingQuerier) QueryMetrics(context.Context, string, promapi.Range) (model.Matrix, error) {
+	return model.Matrix{}, nil
+}
+
+func (q *countingQuerier) QueryInstant(context.Context, string, time.Time) (model.Vector, error) {
+	return model.Vector{}, nil
+}
+
+func TestCachingQuerier(t *testing.T) {
+	inner := &countingQuerier{}
+	cache := NewCachingQuerier(inner, time.Minute)
+	now := time.Unix(1257894000, 0)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	names, err := cache.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_gauge"}, names.Gauges)
+
+	_, err = cache.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.calls, "cached within the TTL")
+
+	_, err = cache.ListMetrics(ctx, "other_")
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.calls, "prefixes are cached separately")
+
+	now = now.Add(time.Minute)
+	_, err = cache.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.calls, "expired after the TTL")
+
+	cache.Refresh()
+	_, err = cache.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, 4, inner.calls, "refresh forces discovery")
+}
+
+func TestCachingQuerierDoesNotCacheErrors(t *testing.T) {
+	inner := &countingQuerier{err: errors.New("unavailable")}
+	cache := NewCachingQuerier(inner, time.Minute)
+
+	_, err := cache.ListMetrics(context.Background(), "temporal_")
+	require.Error(t, err)
+	inner.err = nil
+	_, err = cache.ListMetrics(context.Background(), "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.calls)
+}
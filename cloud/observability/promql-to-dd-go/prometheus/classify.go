@@ -0,0 +1,163 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Classifier groups discovered metric names by how they are queried, see MetricNames.
+type Classifier interface {
+	Classify(names []string) MetricNames
+}
+
+// ClassifierFunc adapts a function to a Classifier.
+type ClassifierFunc func(names []string) MetricNames
+
+func (f ClassifierFunc) Classify(names []string) MetricNames {
+	return f(names)
+}
+
+// DefaultClassifier classifies names by their suffix with ClassifyMetrics.
+var DefaultClassifier Classifier = ClassifierFunc(ClassifyMetrics)
+
+// ClassifyMetrics groups metric names into histograms, counters, gauges and summaries.
+// A name is a summary when its _sum and _count exist without a matching _bucket; the
+// _sum and _count of a summary are not reported separately.
+func ClassifyMetrics(names []string) MetricNames {
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+	isSummary := func(base string) bool {
+		return exists[base] && exists[base+"_sum"] && exists[base+"_count"] && !exists[base+"_bucket"]
+	}
+
+	metrics := MetricNames{
+		Histograms: []string{},
+		Counters:   []string{},
+		Gauges:     []string{},
+		Summaries:  []string{},
+	}
+	for _, name := range names {
+		switch {
+		case isSummary(name):
+			metrics.Summaries = append(metrics.Summaries, name)
+		case isSummary(strings.TrimSuffix(name, "_sum")), isSummary(strings.TrimSuffix(name, "_count")):
+			continue
+		case strings.HasSuffix(name, "_bucket"):
+			metrics.Histograms = append(metrics.Histograms, name)
+		case strings.HasSuffix(name, "_count"), strings.HasSuffix(name, "_total"):
+			metrics.Counters = append(metrics.Counters, name)
+		default:
+			metrics.Gauges = append(metrics.Gauges, name)
+		}
+	}
+	return metrics
+}
+
+// MetricType is the type a ClassRule assigns.
+type MetricType string
+
+const (
+	MetricTypeHistogram MetricType = "histogram"
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeGauge     MetricType = "gauge"
+	MetricTypeSummary   MetricType = "summary"
+)
+
+// ClassRule assigns Type to the names matching Pattern.
+type ClassRule struct {
+	Pattern *regexp.Regexp
+	Type    MetricType
+}
+
+// ParseClassRule parses a rule of the form <pattern>=<type>, the pattern being a regular
+// expression matched against the whole metric name and the type histogram, counter, gauge or
+// summary. A histogram is named after its _bucket series and a summary after its base name,
+// as ClassifyMetrics reports them.
+func ParseClassRule(s string) (ClassRule, error) {
+	pattern, typ, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" {
+		return ClassRule{}, fmt.Errorf("invalid metric type rule %q, expected <pattern>=<type>", s)
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return ClassRule{}, fmt.Errorf("invalid metric type rule pattern %q: %w", pattern, err)
+	}
+	switch t := MetricType(strings.TrimSpace(typ)); t {
+	case MetricTypeHistogram, MetricTypeCounter, MetricTypeGauge, MetricTypeSummary:
+		return ClassRule{Pattern: re, Type: t}, nil
+	default:
+		return ClassRule{}, fmt.Errorf("unknown metric type %q in rule %q, want %q, %q, %q or %q",
+			typ, s, MetricTypeHistogram, MetricTypeCounter, MetricTypeGauge, MetricTypeSummary)
+	}
+}
+
+// String returns the rule in the <pattern>=<type> form accepted by ParseClassRule.
+func (r ClassRule) String() string {
+	pattern := strings.TrimSuffix(strings.TrimPrefix(r.Pattern.String(), "^(?:"), ")$")
+	return pattern + "=" + string(r.Type)
+}
+
+// RuleClassifier classifies the names matching one of Rules by the first matching rule, and
+// the others with Fallback, which defaults to DefaultClassifier. Rules fix the names the
+// naming heuristic gets wrong, such as a gauge ending in _total. The _sum and _count series of
+// a summary typed by a rule belong to it, as with ClassifyMetrics, and are not classified.
+type RuleClassifier struct {
+	Rules    []ClassRule
+	Fallback Classifier
+}
+
+func (c RuleClassifier) Classify(names []string) MetricNames {
+	matched := MetricNames{Histograms: []string{}, Counters: []string{}, Gauges: []string{}, Summaries: []string{}}
+	rest := []string{}
+names:
+	for _, name := range names {
+		for _, rule := range c.Rules {
+			if !rule.Pattern.MatchString(name) {
+				continue
+			}
+			switch rule.Type {
+			case MetricTypeHistogram:
+				matched.Histograms = append(matched.Histograms, name)
+			case MetricTypeCounter:
+				matched.Counters = append(matched.Counters, name)
+			case MetricTypeGauge:
+				matched.Gauges = append(matched.Gauges, name)
+			case MetricTypeSummary:
+				matched.Summaries = append(matched.Summaries, name)
+			}
+			continue names
+		}
+		rest = append(rest, name)
+	}
+
+	summaries := map[string]bool{}
+	for _, name := range matched.Summaries {
+		summaries[name] = true
+	}
+	others := []string{}
+	for _, name := range rest {
+		base, sum := strings.CutSuffix(name, "_sum")
+		if !sum {
+			base, _ = strings.CutSuffix(name, "_count")
+		}
+		if base != name && summaries[base] {
+			continue
+		}
+		others = append(others, name)
+	}
+
+	fallback := c.Fallback
+	if fallback == nil {
+		fallback = DefaultClassifier
+	}
+	classified := fallback.Classify(others)
+	return MetricNames{
+		Histograms: append(matched.Histograms, classified.Histograms...),
+		Counters:   append(matched.Counters, classified.Counters...),
+		Gauges:     append(matched.Gauges, classified.Gauges...),
+		Summaries:  append(matched.Summaries, classified.Summaries...),
+	}
+}
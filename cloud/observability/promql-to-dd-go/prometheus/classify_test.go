@@ -0,0 +1,92 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListMetricsCustomClassifier(t *testing.T) {
+	var classified []string
+	client := &APIClient{
+		API: &fakeAPI{labelValues: model.LabelValues{"temporal_cloud_v0_a", "temporal_cloud_v0_b"}},
+		Classifier: ClassifierFunc(func(names []string) MetricNames {
+			classified = names
+			return MetricNames{Counters: names}
+		}),
+	}
+
+	metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_cloud_v0_a", "temporal_cloud_v0_b"}, classified)
+	assert.Equal(t, MetricNames{Counters: []string{"temporal_cloud_v0_a", "temporal_cloud_v0_b"}}, metrics)
+}
+
+func TestRuleClassifier(t *testing.T) {
+	rule := func(s string) ClassRule {
+		r, err := ParseClassRule(s)
+		require.NoError(t, err)
+		return r
+	}
+	classifier := RuleClassifier{Rules: []ClassRule{
+		rule(".*_queue_total=gauge"),
+		rule(".*_backlog=counter"),
+		rule(".*_total=histogram"),
+		rule("rpc_duration=summary"),
+	}}
+
+	metrics := classifier.Classify([]string{
+		"task_queue_total",
+		"task_backlog",
+		"poll_success_total",
+		"rpc_duration",
+		"service_latency_bucket",
+		"pending_tasks",
+		"request_count",
+	})
+
+	assert.Equal(t, []string{"poll_success_total", "service_latency_bucket"}, metrics.Histograms)
+	assert.Equal(t, []string{"task_backlog", "request_count"}, metrics.Counters)
+	assert.Equal(t, []string{"task_queue_total", "pending_tasks"}, metrics.Gauges)
+	assert.Equal(t, []string{"rpc_duration"}, metrics.Summaries)
+}
+
+func TestRuleClassifierSummaryParts(t *testing.T) {
+	rule, err := ParseClassRule("rpc_latency=summary")
+	require.NoError(t, err)
+	names := []string{"rpc_latency", "rpc_latency_sum", "rpc_latency_count", "request_count"}
+
+	metrics := RuleClassifier{Rules: []ClassRule{rule}}.Classify(names)
+	assert.Equal(t, []string{"rpc_latency"}, metrics.Summaries)
+	assert.Equal(t, []string{"request_count"}, metrics.Counters)
+	assert.Empty(t, metrics.Gauges)
+	assert.Equal(t, ClassifyMetrics(names), metrics, "as the default classifier")
+}
+
+func TestRuleClassifierFallback(t *testing.T) {
+	classifier := RuleClassifier{Fallback: ClassifierFunc(func(names []string) MetricNames {
+		return MetricNames{Gauges: names}
+	})}
+
+	metrics := classifier.Classify([]string{"request_count", "latency_bucket"})
+	assert.Equal(t, []string{"request_count", "latency_bucket"}, metrics.Gauges)
+	assert.Empty(t, metrics.Counters)
+	assert.Empty(t, metrics.Histograms)
+}
+
+func TestParseClassRule(t *testing.T) {
+	r, err := ParseClassRule(".*_queue_total=gauge")
+	require.NoError(t, err)
+	assert.Equal(t, MetricTypeGauge, r.Type)
+	assert.True(t, r.Pattern.MatchString("task_queue_total"))
+	assert.False(t, r.Pattern.MatchString("task_queue_total_sum"))
+	assert.Equal(t, ".*_queue_total=gauge", r.String())
+
+	for _, s := range []string{"", "=gauge", ".*_total", "(=gauge", ".*_total=timer"} {
+		_, err := ParseClassRule(s)
+		assert.Error(t, err, s)
+	}
+}
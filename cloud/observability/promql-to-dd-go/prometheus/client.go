@@ -3,26 +3,53 @@ package prometheus
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
 	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+
+	"github.com/temporalio/promql-to-dd-go/proxy"
+	"github.com/temporalio/promql-to-dd-go/retryafter"
 )
 
 type (
 	Querier interface {
-		ListMetrics(metricPrefix string) ([]string, []string, error)
-		QueryMetrics(promql string, queryRange promapi.Range) (model.Matrix, error)
+		ListMetrics(ctx context.Context, metricPrefix string) (MetricNames, error)
+		QueryMetrics(ctx context.Context, promql string, queryRange promapi.Range) (model.Matrix, error)
+		QueryInstant(ctx context.Context, promql string, ts time.Time) (model.Vector, error)
 	}
 
 	APIClient struct {
 		promapi.API
+		// ChunkedDiscovery splits metric name discovery into several requests, for endpoints
+		// where a single request is slow or exceeds response size limits.
+		ChunkedDiscovery bool
+		// DiscoveryMatchers are label matchers, such as temporal_namespace!="", that a series
+		// must satisfy for its metric name to be discovered. They exclude the metrics sharing
+		// the prefix that are of no interest before they are classified and queried.
+		DiscoveryMatchers []string
+		// NameFilter selects the discovered names before they are classified.
+		NameFilter NameFilter
+		// Classifier groups the discovered names by how they are queried. Defaults to
+		// DefaultClassifier.
+		Classifier Classifier
 	}
 )
 
+// MetricNames holds discovered metric names grouped by how they are queried.
+type MetricNames struct {
+	Histograms []string
+	Counters   []string
+	Gauges     []string
+	// Summaries are the base names of summary metrics, whose series carry a quantile label.
+	Summaries []string
+}
+
 type Config struct {
 	TargetHost         string
 	ServerRootCACert   string
@@ -30,9 +57,67 @@ type Config struct {
 	ClientKey          string
 	ServerName         string
 	InsecureSkipVerify bool
+	// BearerToken is sent as an Authorization header on every request.
+	BearerToken string
+	// BearerTokenFile is read for the bearer token instead of BearerToken, and re-read when
+	// the file changes.
+	BearerTokenFile string
+	// BasicAuthUsername and BasicAuthPassword are sent as HTTP basic auth on every request,
+	// instead of a bearer token.
+	BasicAuthUsername string
+	BasicAuthPassword string
+	// ChunkedDiscovery sets APIClient.ChunkedDiscovery.
+	ChunkedDiscovery bool
+	// DiscoveryMatchers sets APIClient.DiscoveryMatchers.
+	DiscoveryMatchers []string
+	// IncludeMetrics and ExcludeMetrics are the patterns of APIClient.NameFilter.
+	IncludeMetrics []string
+	ExcludeMetrics []string
+	// Classifier sets APIClient.Classifier.
+	Classifier Classifier
+	// ProxyURL routes requests through a proxy. When empty HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY are honored.
+	ProxyURL string
+}
+
+// ValidateEndpoint checks that target looks like a reachable Prometheus API endpoint: an
+// absolute http or https URL with a host.
+func ValidateEndpoint(target string) error {
+	if target == "" {
+		return fmt.Errorf("no Prometheus endpoint configured")
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid Prometheus endpoint %q: %w", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid Prometheus endpoint %q, expected an http or https URL such as https://<account>.tmprl.cloud/prometheus", target)
+	}
+	return nil
 }
 
 func NewAPIClient(cfg Config) (*APIClient, error) {
+	if err := ValidateEndpoint(cfg.TargetHost); err != nil {
+		return nil, err
+	}
+	if cfg.BasicAuthUsername != "" && (cfg.BearerToken != "" || cfg.BearerTokenFile != "") {
+		return nil, fmt.Errorf("basic auth and bearer token are mutually exclusive")
+	}
+	if cfg.BasicAuthUsername == "" && cfg.BasicAuthPassword != "" {
+		return nil, fmt.Errorf("basic auth password given without a username")
+	}
+	for _, m := range cfg.DiscoveryMatchers {
+		if err := validateLabelMatcher(m); err != nil {
+			return nil, err
+		}
+	}
+	nameFilter, err := NewNameFilter(cfg.IncludeMetrics, cfg.ExcludeMetrics)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification of the Prometheus endpoint is disabled, do not use in production")
+	}
 	tlsCfg, err := BuildTLSConfig(
 		cfg.ClientCert,
 		cfg.ClientKey,
@@ -44,54 +129,152 @@ func NewAPIClient(cfg Config) (*APIClient, error) {
 		return nil, fmt.Errorf("failed to build tls config %w", err)
 	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{TLSClientConfig: tlsCfg},
+	proxyFunc, err := proxy.Func(cfg.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = retryafter.NewTransport(&http.Transport{TLSClientConfig: tlsCfg, Proxy: proxyFunc})
+	if cfg.BearerToken != "" || cfg.BearerTokenFile != "" {
+		transport = newBearerAuthRoundTripper(transport, cfg.BearerToken, cfg.BearerTokenFile)
+	}
+	if cfg.BasicAuthUsername != "" {
+		transport = newBasicAuthRoundTripper(transport, cfg.BasicAuthUsername, cfg.BasicAuthPassword)
 	}
+	httpClient := &http.Client{Transport: transport}
 
 	client, err := NewHttpClient(cfg.TargetHost, httpClient)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build tls client %w", err)
 	}
 
-	return &APIClient{promapi.NewAPI(client)}, nil
+	return &APIClient{API: promapi.NewAPI(client), ChunkedDiscovery: cfg.ChunkedDiscovery, DiscoveryMatchers: cfg.DiscoveryMatchers, NameFilter: nameFilter, Classifier: cfg.Classifier}, nil
 }
 
-func (c *APIClient) ListMetrics(metricPrefix string) ([]string, []string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	values, _, err := c.LabelValues(ctx, "__name__", nil, time.Time{}, time.Time{})
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch Prometheus metric names: %w", err)
+// ListMetrics discovers the metric names starting with metricPrefix. With ChunkedDiscovery the
+// names are fetched in several smaller requests, one per discoveryChunks matcher, and merged.
+// Only the names of series satisfying DiscoveryMatchers and kept by NameFilter are discovered.
+func (c *APIClient) ListMetrics(ctx context.Context, metricPrefix string) (MetricNames, error) {
+	chunks := [][]string{nil}
+	if c.ChunkedDiscovery {
+		chunks = discoveryChunks(metricPrefix, c.DiscoveryMatchers)
+	} else if len(c.DiscoveryMatchers) > 0 {
+		chunks = [][]string{{discoverySelector(regexp.QuoteMeta(metricPrefix)+".*", c.DiscoveryMatchers)}}
 	}
-	buckets := []string{}
-	counts := []string{}
-	for _, v := range values {
-		if !strings.HasPrefix(string(v), metricPrefix) {
-			continue
+
+	seen := map[string]bool{}
+	names := []string{}
+	for i, matches := range chunks {
+		values, err := c.labelValues(ctx, matches)
+		if err != nil {
+			if len(chunks) > 1 {
+				return MetricNames{}, fmt.Errorf("failed to fetch Prometheus metric names (chunk %d of %d): %w", i+1, len(chunks), err)
+			}
+			return MetricNames{}, fmt.Errorf("failed to fetch Prometheus metric names: %w", err)
 		}
-		if strings.HasSuffix(string(v), "_bucket") {
-			buckets = append(buckets, string(v))
-		} else {
-			counts = append(counts, string(v))
+		for _, v := range values {
+			name := string(v)
+			if strings.HasPrefix(name, metricPrefix) && c.NameFilter.Match(name) && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
 		}
 	}
-	return buckets, counts, nil
+	return c.classifier().Classify(names), nil
 }
 
-func (c *APIClient) QueryMetrics(promql string, queryRange promapi.Range) (model.Matrix, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c *APIClient) classifier() Classifier {
+	if c.Classifier == nil {
+		return DefaultClassifier
+	}
+	return c.Classifier
+}
+
+func (c *APIClient) labelValues(ctx context.Context, matches []string) (model.LabelValues, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	result, warnings, err := c.API.QueryRange(ctx, promql, queryRange, promapi.WithTimeout(10*time.Second))
+	values, _, err := c.LabelValues(ctx, "__name__", matches, time.Time{}, time.Time{})
+	return values, err
+}
+
+// discoveryChunkClasses partitions metric names by the first character after the prefix.
+var discoveryChunkClasses = []string{"[0-9]", "[a-f]", "[g-l]", "[m-r]", "[s-z]"}
+
+// discoveryChunks returns one series matcher per chunk, each also requiring matchers.
+// Together the chunks cover every name starting with prefix: the last one matches the prefix
+// itself and names continuing with a character outside of discoveryChunkClasses.
+func discoveryChunks(prefix string, matchers []string) [][]string {
+	quoted := regexp.QuoteMeta(prefix)
+	chunks := make([][]string, 0, len(discoveryChunkClasses)+1)
+	for _, class := range discoveryChunkClasses {
+		chunks = append(chunks, []string{discoverySelector(quoted+class+".*", matchers)})
+	}
+	return append(chunks, []string{discoverySelector(quoted+"([^0-9a-z].*)?", matchers)})
+}
+
+// discoverySelector returns the series selector of the names matching the regular expression
+// name and satisfying matchers.
+func discoverySelector(name string, matchers []string) string {
+	return "{" + strings.Join(append([]string{fmt.Sprintf("__name__=~%q", name)}, matchers...), ",") + "}"
+}
+
+// labelMatcher matches a single PromQL label matcher such as temporal_namespace!="".
+var labelMatcher = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)\s*(?:=|!=|=~|!~)\s*"(?:[^"\\]|\\.)*"$`)
+
+// validateLabelMatcher checks that m is a single label matcher, <label><op>"<value>" with op
+// one of =, !=, =~ and !~, so that it can be added to discovery selectors.
+func validateLabelMatcher(m string) error {
+	match := labelMatcher.FindStringSubmatch(strings.TrimSpace(m))
+	if match == nil {
+		return fmt.Errorf("invalid label matcher %q, expected <label><op>\"<value>\" such as temporal_namespace!=\"\"", m)
+	}
+	if match[1] == model.MetricNameLabel {
+		return fmt.Errorf("invalid label matcher %q, discovery already matches metric names by prefix", m)
+	}
+	return nil
+}
+
+// QueryMetrics runs a range query. The query is bounded by the deadline of ctx, which is
+// also forwarded to Prometheus as the evaluation timeout; without a deadline a default of
+// 10 seconds applies.
+func (c *APIClient) QueryMetrics(ctx context.Context, promql string, queryRange promapi.Range) (model.Matrix, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	result, warnings, err := c.API.QueryRange(ctx, promql, queryRange, promapi.WithTimeout(time.Until(deadline)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query Prometheus: %w", err)
 	}
 	if len(warnings) > 0 {
-		log.Printf("warning while querying Prometheus range: %v\n", warnings)
+		slog.Warn("Warning while querying Prometheus range", "warnings", warnings)
 	}
 	promMatrix, ok := result.(model.Matrix)
 	if !ok {
-		log.Printf("unexpected type %T returned for bucket metric", result)
+		slog.Warn("Unexpected result type returned for range query", "type", fmt.Sprintf("%T", result))
 	}
 	return promMatrix, nil
 }
+
+// QueryInstant evaluates promql at ts, bounded like QueryMetrics.
+func (c *APIClient) QueryInstant(ctx context.Context, promql string, ts time.Time) (model.Vector, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	result, warnings, err := c.API.Query(ctx, promql, ts, promapi.WithTimeout(time.Until(deadline)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Prometheus: %w", err)
+	}
+	if len(warnings) > 0 {
+		slog.Warn("Warning while querying Prometheus instant", "warnings", warnings)
+	}
+	vector, ok := result.(model.Vector)
+	if !ok {
+		slog.Warn("Unexpected result type returned for instant query", "type", fmt.Sprintf("%T", result))
+	}
+	return vector, nil
+}
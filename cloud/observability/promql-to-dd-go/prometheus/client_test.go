@@ -0,0 +1,261 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAPI struct {
+	promapi.API
+	labelValues model.LabelValues
+}
+
+func (a *fakeAPI) LabelValues(_ context.Context, _ string, _ []string, _, _ time.Time) (model.LabelValues, promapi.Warnings, error) {
+	return a.labelValues, nil, nil
+}
+
+func TestListMetricsClassification(t *testing.T) {
+	client := &APIClient{API: &fakeAPI{labelValues: model.LabelValues{
+		"temporal_cloud_v0_service_latency_bucket",
+		"temporal_cloud_v0_frontend_service_request_count",
+		"temporal_cloud_v0_poll_success_total",
+		"temporal_cloud_v0_schedule_count_gauge",
+		"temporal_cloud_v0_pending_tasks",
+		"unrelated_metric_count",
+	}}}
+
+	metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_cloud_v0_service_latency_bucket"}, metrics.Histograms)
+	assert.Equal(t, []string{"temporal_cloud_v0_frontend_service_request_count", "temporal_cloud_v0_poll_success_total"}, metrics.Counters)
+	assert.Equal(t, []string{"temporal_cloud_v0_schedule_count_gauge", "temporal_cloud_v0_pending_tasks"}, metrics.Gauges)
+	assert.Empty(t, metrics.Summaries)
+}
+
+func TestClassifyMetricsSummaries(t *testing.T) {
+	metrics := ClassifyMetrics([]string{
+		"rpc_latency",
+		"rpc_latency_sum",
+		"rpc_latency_count",
+		"request_latency_bucket",
+		"request_latency_sum",
+		"request_latency_count",
+		"orphan_sum",
+	})
+
+	assert.Equal(t, []string{"rpc_latency"}, metrics.Summaries)
+	assert.Equal(t, []string{"request_latency_bucket"}, metrics.Histograms)
+	assert.Equal(t, []string{"request_latency_count"}, metrics.Counters)
+	assert.Equal(t, []string{"request_latency_sum", "orphan_sum"}, metrics.Gauges)
+}
+
+// pagedAPI serves label values filtered by the __name__ matcher of each request, repeating
+// the last name of the previous page to simulate overlapping pages.
+type pagedAPI struct {
+	promapi.API
+	names    []string
+	requests [][]string
+	previous model.LabelValues
+}
+
+func (a *pagedAPI) LabelValues(_ context.Context, _ string, matches []string, _, _ time.Time) (model.LabelValues, promapi.Warnings, error) {
+	a.requests = append(a.requests, matches)
+	pattern, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(matches[0], "{__name__=~"), "}"))
+	if err != nil {
+		return nil, nil, err
+	}
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+
+	page := model.LabelValues{}
+	if len(a.previous) > 0 {
+		page = append(page, a.previous[len(a.previous)-1])
+	}
+	for _, name := range a.names {
+		if re.MatchString(name) {
+			page = append(page, model.LabelValue(name))
+		}
+	}
+	a.previous = page
+	return page, nil, nil
+}
+
+func TestListMetricsChunkedDiscovery(t *testing.T) {
+	api := &pagedAPI{names: []string{
+		"temporal.cloud_2xx_count",
+		"temporal.cloud_frontend_service_request_count",
+		"temporal.cloud_poll_success_total",
+		"temporal.cloud_service_latency_bucket",
+		"temporal.cloud_pending_tasks",
+		"temporal.cloud_Upper_gauge",
+		"temporal.cloud_",
+		"temporalXcloud_not_matching_the_dot",
+	}}
+	client := &APIClient{API: api, ChunkedDiscovery: true}
+
+	metrics, err := client.ListMetrics(context.Background(), "temporal.cloud_")
+	require.NoError(t, err)
+	assert.Len(t, api.requests, len(discoveryChunkClasses)+1)
+	assert.Equal(t, []string{"temporal.cloud_service_latency_bucket"}, metrics.Histograms)
+	assert.Equal(t, []string{
+		"temporal.cloud_2xx_count",
+		"temporal.cloud_frontend_service_request_count",
+		"temporal.cloud_poll_success_total",
+	}, metrics.Counters)
+	assert.Equal(t, []string{"temporal.cloud_pending_tasks", "temporal.cloud_Upper_gauge", "temporal.cloud_"}, metrics.Gauges)
+}
+
+func TestAPIClientHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":["temporal_cloud_v0_pending_tasks"]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(Config{TargetHost: srv.URL})
+	require.NoError(t, err)
+
+	start := time.Now()
+	metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_cloud_v0_pending_tasks"}, metrics.Gauges)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestAPIClientQueryInstant(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "/api/v1/query", r.URL.Path)
+		assert.Equal(t, "temporal_cloud_v0_pending_tasks", r.Form.Get("query"))
+		assert.Equal(t, "1257894000", r.Form.Get("time"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"temporal_namespace":"disneyland"},"value":[1257894000,"42"]}]}}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewAPIClient(Config{TargetHost: srv.URL})
+	require.NoError(t, err)
+
+	vector, err := client.QueryInstant(context.Background(), "temporal_cloud_v0_pending_tasks", time.Unix(1257894000, 0))
+	require.NoError(t, err)
+	assert.Equal(t, model.Vector{&model.Sample{
+		Metric:    model.Metric{"temporal_namespace": "disneyland"},
+		Value:     42,
+		Timestamp: model.TimeFromUnix(1257894000),
+	}}, vector)
+}
+
+func TestAPIClientProxy(t *testing.T) {
+	var proxied atomic.Value
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the target.
+		proxied.Store(r.URL.String())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":["temporal_cloud_v0_pending_tasks"]}`))
+	}))
+	defer proxySrv.Close()
+
+	client, err := NewAPIClient(Config{TargetHost: "http://prometheus.invalid:9090", ProxyURL: proxySrv.URL})
+	require.NoError(t, err)
+
+	metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_cloud_v0_pending_tasks"}, metrics.Gauges)
+	assert.Contains(t, proxied.Load(), "http://prometheus.invalid:9090/api/v1/label/__name__/values")
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	assert.NoError(t, ValidateEndpoint("https://account.tmprl.cloud/prometheus"))
+	assert.NoError(t, ValidateEndpoint("http://localhost:9090"))
+	for _, target := range []string{"", "account.tmprl.cloud/prometheus", "ftp://account.tmprl.cloud", "https://", "https://a b"} {
+		assert.Error(t, ValidateEndpoint(target), target)
+	}
+
+	_, err := NewAPIClient(Config{TargetHost: "localhost:9090"})
+	assert.ErrorContains(t, err, "expected an http or https URL")
+}
+
+// namespacedAPI serves every name, or only the names of metrics with a temporal_namespace
+// label when a request requires one.
+type namespacedAPI struct {
+	promapi.API
+	namespaced map[string]bool
+	requests   [][]string
+}
+
+func (a *namespacedAPI) LabelValues(_ context.Context, _ string, matches []string, _, _ time.Time) (model.LabelValues, promapi.Warnings, error) {
+	a.requests = append(a.requests, matches)
+	required := len(matches) > 0 && strings.Contains(matches[0], `temporal_namespace!=""`)
+	values := model.LabelValues{}
+	for name, namespaced := range a.namespaced {
+		if namespaced || !required {
+			values = append(values, model.LabelValue(name))
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values, nil, nil
+}
+
+func TestListMetricsDiscoveryMatchers(t *testing.T) {
+	names := map[string]bool{
+		"temporal_cloud_v0_poll_success_count":     true,
+		"temporal_cloud_v0_service_latency_bucket": true,
+		"temporal_cloud_v0_account_limit":          false,
+		"temporal_cloud_v0_exporter_up":            false,
+	}
+
+	t.Run("unscoped", func(t *testing.T) {
+		client := &APIClient{API: &namespacedAPI{namespaced: names}}
+		metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_v0_")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"temporal_cloud_v0_account_limit", "temporal_cloud_v0_exporter_up"}, metrics.Gauges)
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		api := &namespacedAPI{namespaced: names}
+		client := &APIClient{API: api, DiscoveryMatchers: []string{`temporal_namespace!=""`}}
+		metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_v0_")
+		require.NoError(t, err)
+		assert.Equal(t, []string{`{__name__=~"temporal_cloud_v0_.*",temporal_namespace!=""}`}, api.requests[0])
+		assert.Equal(t, []string{"temporal_cloud_v0_service_latency_bucket"}, metrics.Histograms)
+		assert.Equal(t, []string{"temporal_cloud_v0_poll_success_count"}, metrics.Counters)
+		assert.Empty(t, metrics.Gauges)
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		matchers := []string{`temporal_namespace!=""`, `region=~"us-.*"`}
+		for _, chunk := range discoveryChunks("temporal_cloud_v0_", matchers) {
+			require.Len(t, chunk, 1)
+			assert.True(t, strings.HasSuffix(chunk[0], `,temporal_namespace!="",region=~"us-.*"}`), chunk[0])
+		}
+	})
+}
+
+func TestValidateLabelMatcher(t *testing.T) {
+	for _, valid := range []string{`temporal_namespace!=""`, `region=~"us-.*"`, ` env = "prod" `, `name!~"a\"b"`} {
+		assert.NoError(t, validateLabelMatcher(valid), valid)
+	}
+	for _, invalid := range []string{"", `temporal_namespace`, `temporal_namespace!=`, `env="prod",region="us"`, `env=prod`, `__name__=~"x.*"`, `1env="prod"`} {
+		assert.Error(t, validateLabelMatcher(invalid), invalid)
+	}
+}
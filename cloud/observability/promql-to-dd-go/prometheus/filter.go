@@ -0,0 +1,56 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// NameFilter selects discovered metric names by regular expressions matched against the whole
+// name, such as .*_latency_.*. A name is kept when it matches an include pattern, or any
+// pattern when there is none, and no exclude pattern: exclude wins. The zero NameFilter keeps
+// every name.
+type NameFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func NewNameFilter(include, exclude []string) (NameFilter, error) {
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric name pattern %q: %w", pattern, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+	var f NameFilter
+	var err error
+	if f.include, err = compile(include); err != nil {
+		return NameFilter{}, err
+	}
+	if f.exclude, err = compile(exclude); err != nil {
+		return NameFilter{}, err
+	}
+	return f, nil
+}
+
+// Match reports whether name is kept.
+func (f NameFilter) Match(name string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
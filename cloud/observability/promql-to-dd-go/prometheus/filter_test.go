@@ -0,0 +1,66 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListMetricsNameFilter(t *testing.T) {
+	names := model.LabelValues{
+		"temporal_cloud_v0_service_latency_bucket",
+		"temporal_cloud_v0_service_latency_count",
+		"temporal_cloud_v0_debug_latency_bucket",
+		"temporal_cloud_v0_debug_queue_size",
+		"temporal_cloud_v0_pending_tasks",
+	}
+	testCases := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{
+			name:    "include only",
+			include: []string{".*_latency_.*"},
+			want:    []string{"temporal_cloud_v0_service_latency_bucket", "temporal_cloud_v0_service_latency_count", "temporal_cloud_v0_debug_latency_bucket"},
+		},
+		{
+			name:    "exclude only",
+			exclude: []string{".*_debug_.*"},
+			want:    []string{"temporal_cloud_v0_service_latency_bucket", "temporal_cloud_v0_service_latency_count", "temporal_cloud_v0_pending_tasks"},
+		},
+		{
+			name:    "exclude wins over include",
+			include: []string{".*_latency_.*", ".*_queue_size"},
+			exclude: []string{".*_debug_.*"},
+			want:    []string{"temporal_cloud_v0_service_latency_bucket", "temporal_cloud_v0_service_latency_count"},
+		},
+		{
+			name:    "patterns match whole names",
+			include: []string{"pending_tasks"},
+			want:    []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := NewNameFilter(tc.include, tc.exclude)
+			require.NoError(t, err)
+			client := &APIClient{API: &fakeAPI{labelValues: names}, NameFilter: filter}
+			metrics, err := client.ListMetrics(context.Background(), "temporal_cloud_v0_")
+			require.NoError(t, err)
+			got := append(append(append([]string{}, metrics.Histograms...), metrics.Counters...), metrics.Gauges...)
+			assert.ElementsMatch(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewNameFilter(t *testing.T) {
+	assert.True(t, NameFilter{}.Match("anything"), "the zero filter keeps every name")
+	_, err := NewNameFilter([]string{"("}, nil)
+	assert.Error(t, err)
+	_, err = NewNameFilter(nil, []string{"[a-"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package prometheus
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// RefreshingQuerier serves ListMetrics from a snapshot refreshed in the background by Run, so
+// cycles do not pay the discovery latency. Only the first ListMetrics call of a prefix
+// discovers its metrics inline; from then on the prefix is refreshed every interval, and a
+// failed refresh keeps serving the previous snapshot. It is safe for concurrent use.
+type RefreshingQuerier struct {
+	Querier
+	interval time.Duration
+
+	mu        sync.RWMutex
+	snapshots map[string]MetricNames
+}
+
+func NewRefreshingQuerier(querier Querier, interval time.Duration) *RefreshingQuerier {
+	if interval <= 0 {
+		interval = DefaultMetricListTTL
+	}
+	return &RefreshingQuerier{
+		Querier:   querier,
+		interval:  interval,
+		snapshots: map[string]MetricNames{},
+	}
+}
+
+func (r *RefreshingQuerier) ListMetrics(ctx context.Context, metricPrefix string) (MetricNames, error) {
+	r.mu.RLock()
+	names, ok := r.snapshots[metricPrefix]
+	r.mu.RUnlock()
+	if ok {
+		return names, nil
+	}
+
+	names, err := r.Querier.ListMetrics(ctx, metricPrefix)
+	if err != nil {
+		return MetricNames{}, err
+	}
+	r.store(metricPrefix, names)
+	return names, nil
+}
+
+func (r *RefreshingQuerier) QueryMetrics(ctx context.Context, promql string, queryRange promapi.Range) (model.Matrix, error) {
+	return r.Querier.QueryMetrics(ctx, promql, queryRange)
+}
+
+func (r *RefreshingQuerier) QueryInstant(ctx context.Context, promql string, ts time.Time) (model.Vector, error) {
+	return r.Querier.QueryInstant(ctx, promql, ts)
+}
+
+// Run refreshes the snapshot of every known prefix each interval until ctx is done.
+func (r *RefreshingQuerier) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *RefreshingQuerier) refresh(ctx context.Context) {
+	r.mu.RLock()
+	prefixes := make([]string, 0, len(r.snapshots))
+	for prefix := range r.snapshots {
+		prefixes = append(prefixes, prefix)
+	}
+	r.mu.RUnlock()
+
+	for _, prefix := range prefixes {
+		names, err := r.Querier.ListMetrics(ctx, prefix)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed refreshing the metric list, keeping the previous one", "prefix", prefix, "error", err)
+			continue
+		}
+		r.store(prefix, names)
+	}
+}
+
+func (r *RefreshingQuerier) store(metricPrefix string, names MetricNames) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshots[metricPrefix] = names
+}
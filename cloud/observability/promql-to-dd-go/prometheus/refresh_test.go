@@ -0,0 +1,104 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// switchingQuerier lists metric names suffixed with the current generation, or fails.
+type switchingQuerier struct {
+	mu         sync.Mutex
+	calls      int
+	generation string
+	err        error
+}
+
+func (q *switchingQuerier) ListMetrics(_ context.Context, metricPrefix string) (MetricNames, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.calls++
+	if q.err != nil {
+		return MetricNames{}, q.err
+	}
+	return MetricNames{Gauges: []string{metricPrefix + q.generation}}, nil
+}
+
+func (q *switchingQuerier) QueryMetrics(context.Context, string, promapi.Range) (model.Matrix, error) {
+	return model.Matrix{}, nil
+}
+
+func (q *switchingQuerier) QueryInstant(context.Context, string, time.Time) (model.Vector, error) {
+	return model.Vector{}, nil
+}
+
+func (q *switchingQuerier) set(generation string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.generation, q.err = generation, err
+}
+
+func (q *switchingQuerier) callCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.calls
+}
+
+func TestRefreshingQuerier(t *testing.T) {
+	inner := &switchingQuerier{generation: "v1"}
+	querier := NewRefreshingQuerier(inner, time.Minute)
+	ctx := context.Background()
+
+	names, err := querier.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_v1"}, names.Gauges)
+	assert.Equal(t, 1, inner.callCount(), "the first call discovers inline")
+
+	inner.set("v2", nil)
+	names, err = querier.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_v1"}, names.Gauges, "served from the snapshot")
+	assert.Equal(t, 1, inner.callCount())
+
+	querier.refresh(ctx)
+	names, err = querier.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temporal_v2"}, names.Gauges)
+}
+
+func TestRefreshingQuerierKeepsSnapshotWhileRefreshFails(t *testing.T) {
+	inner := &switchingQuerier{generation: "v1"}
+	querier := NewRefreshingQuerier(inner, 5*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := querier.ListMetrics(ctx, "temporal_")
+	require.NoError(t, err)
+
+	inner.set("v2", errors.New("prometheus unavailable"))
+	go querier.Run(ctx)
+	require.Eventually(t, func() bool { return inner.callCount() >= 3 }, time.Second, time.Millisecond, "refreshes keep being attempted")
+
+	for i := 0; i < 5; i++ {
+		names, err := querier.ListMetrics(ctx, "temporal_")
+		require.NoError(t, err, "cycles proceed while the refresh fails")
+		assert.Equal(t, []string{"temporal_v1"}, names.Gauges)
+	}
+}
+
+func TestRefreshingQuerierInitialDiscoveryError(t *testing.T) {
+	inner := &switchingQuerier{err: errors.New("prometheus unavailable")}
+	querier := NewRefreshingQuerier(inner, time.Minute)
+
+	_, err := querier.ListMetrics(context.Background(), "temporal_")
+	assert.Error(t, err, "nothing to serve before the first discovery")
+	querier.refresh(context.Background())
+	assert.Equal(t, 1, inner.callCount(), "failed prefixes are not refreshed")
+}
@@ -0,0 +1,72 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StaticQuerier serves a fixed list of metric names instead of discovering them, pinning the
+// exported metrics so that new, possibly expensive, metrics are not picked up unnoticed.
+// QueryMetrics and QueryInstant are passed through.
+type StaticQuerier struct {
+	Querier
+	metrics MetricNames
+}
+
+func NewStaticQuerier(querier Querier, metrics MetricNames) *StaticQuerier {
+	return &StaticQuerier{Querier: querier, metrics: metrics}
+}
+
+// ListMetrics returns the static names starting with metricPrefix, without querying Prometheus.
+func (s *StaticQuerier) ListMetrics(_ context.Context, metricPrefix string) (MetricNames, error) {
+	filter := func(names []string) []string {
+		matching := []string{}
+		for _, name := range names {
+			if strings.HasPrefix(name, metricPrefix) {
+				matching = append(matching, name)
+			}
+		}
+		return matching
+	}
+	return MetricNames{
+		Histograms: filter(s.metrics.Histograms),
+		Counters:   filter(s.metrics.Counters),
+		Gauges:     filter(s.metrics.Gauges),
+		Summaries:  filter(s.metrics.Summaries),
+	}, nil
+}
+
+// ValidateStaticMetrics checks that every name of metrics starts with one of prefixes, since
+// names outside of them would never be queried, and that histograms are named after their
+// _bucket series as discovery reports them.
+func ValidateStaticMetrics(metrics MetricNames, prefixes []string) error {
+	groups := [][]string{metrics.Histograms, metrics.Counters, metrics.Gauges, metrics.Summaries}
+	count := 0
+	for _, names := range groups {
+		for _, name := range names {
+			if !hasAnyPrefix(name, prefixes) {
+				return fmt.Errorf("static metric %q does not start with any of the metric prefixes %q", name, prefixes)
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no static metrics given")
+	}
+	for _, name := range metrics.Histograms {
+		if !strings.HasSuffix(name, "_bucket") {
+			return fmt.Errorf("static histogram %q must be the name of its _bucket series", name)
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
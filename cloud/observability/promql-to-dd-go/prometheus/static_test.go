@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticQuerierSkipsDiscovery(t *testing.T) {
+	inner := &countingQuerier{}
+	static := NewStaticQuerier(inner, MetricNames{
+		Histograms: []string{"temporal_cloud_v0_service_latency_bucket"},
+		Counters:   []string{"temporal_cloud_v0_poll_success_count", "prod_poll_success_count"},
+		Gauges:     []string{"temporal_cloud_v0_pending_tasks"},
+	})
+
+	metrics, err := static.ListMetrics(context.Background(), "temporal_cloud_v0_")
+	require.NoError(t, err)
+	assert.Zero(t, inner.calls, "Prometheus is not asked for metric names")
+	assert.Equal(t, []string{"temporal_cloud_v0_service_latency_bucket"}, metrics.Histograms)
+	assert.Equal(t, []string{"temporal_cloud_v0_poll_success_count"}, metrics.Counters, "only the names of the prefix are returned")
+	assert.Equal(t, []string{"temporal_cloud_v0_pending_tasks"}, metrics.Gauges)
+	assert.Empty(t, metrics.Summaries)
+
+	_, err = static.QueryMetrics(context.Background(), "temporal_cloud_v0_pending_tasks", promapi.Range{})
+	require.NoError(t, err, "queries are passed through")
+}
+
+func TestValidateStaticMetrics(t *testing.T) {
+	prefixes := []string{"temporal_cloud_v0_", "prod_"}
+	assert.NoError(t, ValidateStaticMetrics(MetricNames{
+		Histograms: []string{"temporal_cloud_v0_service_latency_bucket"},
+		Counters:   []string{"prod_poll_success_count"},
+	}, prefixes))
+
+	for name, metrics := range map[string]MetricNames{
+		"empty":               {},
+		"outside prefixes":    {Gauges: []string{"node_cpu_seconds"}},
+		"histogram no bucket": {Histograms: []string{"temporal_cloud_v0_service_latency"}},
+	} {
+		assert.Error(t, ValidateStaticMetrics(metrics, prefixes), name)
+	}
+}
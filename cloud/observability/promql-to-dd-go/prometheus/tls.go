@@ -4,14 +4,19 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
-	"log"
 	"os"
 )
 
+// BuildTLSConfig builds the client TLS configuration. The client certificate is optional, for
+// endpoints authenticated with a bearer token, but the cert and key must be given together.
 func BuildTLSConfig(clientCert, clientKey, serverRootCACert, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
-	cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
-	if err != nil {
-		log.Fatalf("failed load key pairs: %s", err)
+	var certs []tls.Certificate
+	if clientCert != "" || clientKey != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load key pair: %w", err)
+		}
+		certs = append(certs, cert)
 	}
 
 	// Load server CA if given
@@ -27,7 +32,7 @@ func BuildTLSConfig(clientCert, clientKey, serverRootCACert, serverName string,
 	}
 
 	return &tls.Config{
-		Certificates:       []tls.Certificate{cert},
+		Certificates:       certs,
 		RootCAs:            serverCAPool,
 		ServerName:         serverName,
 		InsecureSkipVerify: insecureSkipVerify,
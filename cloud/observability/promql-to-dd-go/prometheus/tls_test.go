@@ -0,0 +1,124 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+}
+
+// newClientCA creates a CA and a client certificate signed by it, writing the client cert
+// and key to dir.
+func newClientCA(t *testing.T, dir string) (*x509.CertPool, string, string) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "promql-to-dd"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	writePEM(t, certFile, "CERTIFICATE", clientDER)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return pool, certFile, keyFile
+}
+
+func TestAPIClientMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCAs, certFile, keyFile := newClientCA(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":["temporal_cloud_v0_frontend_service_requests_count"]}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverCA := filepath.Join(dir, "server-ca.pem")
+	writePEM(t, serverCA, "CERTIFICATE", srv.Certificate().Raw)
+
+	listMetrics := func(cfg Config) (MetricNames, error) {
+		client, err := NewAPIClient(cfg)
+		require.NoError(t, err)
+		return client.ListMetrics(context.Background(), "temporal_cloud_v0")
+	}
+
+	t.Run("with client certificate", func(t *testing.T) {
+		metrics, err := listMetrics(Config{
+			TargetHost:       srv.URL,
+			ServerRootCACert: serverCA,
+			ClientCert:       certFile,
+			ClientKey:        keyFile,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"temporal_cloud_v0_frontend_service_requests_count"}, metrics.Counters)
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		_, err := listMetrics(Config{TargetHost: srv.URL, ServerRootCACert: serverCA})
+		assert.Error(t, err)
+	})
+
+	t.Run("without server CA", func(t *testing.T) {
+		_, err := listMetrics(Config{TargetHost: srv.URL, ClientCert: certFile, ClientKey: keyFile})
+		assert.ErrorContains(t, err, "certificate")
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		_, err := listMetrics(Config{TargetHost: srv.URL, ClientCert: certFile, ClientKey: keyFile, InsecureSkipVerify: true})
+		assert.NoError(t, err)
+	})
+}
+
+func TestBuildTLSConfigRequiresCertAndKeyTogether(t *testing.T) {
+	_, err := BuildTLSConfig("client.pem", "", "", "", false)
+	assert.ErrorContains(t, err, "failed to load key pair")
+}
@@ -0,0 +1,37 @@
+// Package proxy configures the HTTP proxy of outbound clients.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Func returns the proxy function for an http.Transport. An empty rawURL honors the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables; otherwise every request goes
+// through the given proxy.
+func Func(rawURL string) (func(*http.Request) (*url.URL, error), error) {
+	if rawURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", rawURL)
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", rawURL)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// Transport returns a copy of http.DefaultTransport using the proxy of rawURL, see Func.
+func Transport(rawURL string) (*http.Transport, error) {
+	proxyFunc, err := Func(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc
+	return transport, nil
+}
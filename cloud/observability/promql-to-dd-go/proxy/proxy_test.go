@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunc(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.datadoghq.com/api/v2/series", nil)
+	require.NoError(t, err)
+
+	proxyFunc, err := Func("http://proxy.internal:3128")
+	require.NoError(t, err)
+	u, err := proxyFunc(req)
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.internal:3128", u.String())
+
+	for _, invalid := range []string{"proxy.internal:3128", "ftp://proxy.internal", "http://"} {
+		_, err := Func(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,193 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/temporalio/promql-to-dd-go/proxy"
+)
+
+// APIClient mirrors series into a Prometheus compatible store (Prometheus, Mimir, Cortex...)
+// using the remote-write 1.0 protocol. It satisfies the same submitter role as the Datadog
+// client.
+type APIClient struct {
+	url        string
+	cfg        Config
+	httpClient *http.Client
+}
+
+type Config struct {
+	// URL is the remote-write endpoint, e.g. http://mimir:9009/api/v1/push.
+	URL string
+	// BearerToken, if set, is sent as Authorization: Bearer <token>.
+	BearerToken string
+	// Username and Password, if set, are sent as basic auth.
+	Username string
+	Password string
+	// Headers are added to every request, e.g. X-Scope-OrgID for multi-tenant stores.
+	Headers map[string]string
+	// Timeout bounds a single write request. Defaults to 10 seconds.
+	Timeout time.Duration
+	// ProxyURL routes requests through a proxy. When empty HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY are honored.
+	ProxyURL string
+}
+
+func NewAPIClient(cfg Config) (*APIClient, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote-write URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid remote-write URL %q: scheme must be http or https", cfg.URL)
+	}
+	if cfg.BearerToken != "" && cfg.Username != "" {
+		return nil, fmt.Errorf("bearer token and basic auth are mutually exclusive")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	transport, err := proxy.Transport(cfg.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIClient{
+		url:        u.String(),
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+func (c *APIClient) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build remote-write request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "promql-to-dd")
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case c.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	case c.cfg.Username != "":
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to remote-write metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to remote-write metrics: %s: %s", resp.Status, respBody)
+	}
+	return nil
+}
+
+type label struct {
+	name, value string
+}
+
+// seriesLabels returns the sorted label set of a series: __name__, the Prometheus labels
+// carried as resources and the key:value tags. The Datadog form of the metric name (e.g.
+// temporal.latency.p99) is not a valid Prometheus name, so it is sanitized.
+func seriesLabels(s datadogV2.MetricSeries) []label {
+	labels := map[string]string{}
+	for _, r := range s.Resources {
+		if r.Type != nil && r.Name != nil {
+			labels[*r.Type] = *r.Name
+		}
+	}
+	for _, tag := range s.Tags {
+		if key, value, ok := strings.Cut(tag, ":"); ok {
+			labels[key] = value
+		}
+	}
+	labels["__name__"] = metricName(s.Metric)
+
+	sorted := make([]label, 0, len(labels))
+	for name, value := range labels {
+		sorted = append(sorted, label{name: name, value: value})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+// metricName replaces the characters Prometheus does not allow in a metric name
+// ([a-zA-Z_:][a-zA-Z0-9_:]*) with underscores.
+func metricName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z':
+			b.WriteRune(r)
+		case '0' <= r && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// encodeWriteRequest encodes series as a prometheus.WriteRequest protobuf message:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []datadogV2.MetricSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range seriesLabels(s) {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+		for _, p := range s.Points {
+			if p.Timestamp == nil || p.Value == nil {
+				continue
+			}
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(*p.Value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(time.Unix(*p.Timestamp, 0).UnixMilli()))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
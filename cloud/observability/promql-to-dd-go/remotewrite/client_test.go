@@ -0,0 +1,171 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+type sample struct {
+	value       float64
+	timestampMs int64
+}
+
+type timeSeries struct {
+	labels  map[string]string
+	samples []sample
+}
+
+// forEachField calls fn for every field of a protobuf message.
+func forEachField(t *testing.T, b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, u uint64)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, typ, v, 0)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, typ, nil, v)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			require.GreaterOrEqual(t, n, 0)
+			fn(num, typ, nil, v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) []timeSeries {
+	series := []timeSeries{}
+	forEachField(t, b, func(_ protowire.Number, _ protowire.Type, tsBytes []byte, _ uint64) {
+		ts := timeSeries{labels: map[string]string{}}
+		forEachField(t, tsBytes, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name, value string
+				forEachField(t, v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				ts.labels[name] = value
+			case 2:
+				var s sample
+				forEachField(t, v, func(num protowire.Number, _ protowire.Type, _ []byte, u uint64) {
+					if num == 1 {
+						s.value = math.Float64frombits(u)
+					} else {
+						s.timestampMs = int64(u)
+					}
+				})
+				ts.samples = append(ts.samples, s)
+			}
+		})
+		series = append(series, ts)
+	})
+	return series
+}
+
+func TestSubmitMetricsRemoteWritePayload(t *testing.T) {
+	var (
+		gotHeaders http.Header
+		gotSeries  []timeSeries
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		raw, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		gotSeries = decodeWriteRequest(t, raw)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := NewAPIClient(Config{URL: server.URL + "/api/v1/push", BearerToken: "secret", Headers: map[string]string{"X-Scope-OrgID": "tenant"}})
+	require.NoError(t, err)
+
+	series := []datadogV2.MetricSeries{
+		{
+			Metric: "latency_P99",
+			Points: []datadogV2.MetricPoint{
+				{Timestamp: Ptr(int64(1257894000)), Value: Ptr(0.25)},
+				{Timestamp: Ptr(int64(1257894060)), Value: Ptr(0.5)},
+			},
+			Resources: []datadogV2.MetricResource{{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")}},
+			Tags:      []string{"env:prod"},
+		},
+	}
+	require.NoError(t, client.SubmitMetrics(context.Background(), series))
+
+	assert.Equal(t, "snappy", gotHeaders.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", gotHeaders.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", gotHeaders.Get("Authorization"))
+	assert.Equal(t, "tenant", gotHeaders.Get("X-Scope-OrgID"))
+
+	require.Len(t, gotSeries, 1)
+	assert.Equal(t, map[string]string{
+		"__name__":           "latency_P99",
+		"temporal_namespace": "disneyland",
+		"env":                "prod",
+	}, gotSeries[0].labels)
+	assert.Equal(t, []sample{
+		{value: 0.25, timestampMs: 1257894000000},
+		{value: 0.5, timestampMs: 1257894060000},
+	}, gotSeries[0].samples)
+}
+
+func TestSeriesLabelsAreSorted(t *testing.T) {
+	labels := seriesLabels(datadogV2.MetricSeries{
+		Metric:    "m",
+		Resources: []datadogV2.MetricResource{{Type: Ptr("zone"), Name: Ptr("a")}, {Type: Ptr("app"), Name: Ptr("b")}},
+	})
+	assert.Equal(t, []label{{"__name__", "m"}, {"app", "b"}, {"zone", "a"}}, labels)
+}
+
+func TestSeriesLabelsSanitizeMetricName(t *testing.T) {
+	for _, tc := range []struct{ metric, name string }{
+		{"temporal.latency.p99", "temporal_latency_p99"},
+		{"temporal_requests:rate", "temporal_requests:rate"},
+		{"5xx.errors", "_5xx_errors"},
+		{"latency-µs", "latency__s"},
+	} {
+		labels := seriesLabels(datadogV2.MetricSeries{Metric: tc.metric})
+		assert.Equal(t, []label{{"__name__", tc.name}}, labels, tc.metric)
+	}
+}
+
+func TestSubmitMetricsRemoteWriteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client, err := NewAPIClient(Config{URL: server.URL, Username: "user", Password: "pass"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, client.SubmitMetrics(context.Background(), nil), "out of order sample")
+}
@@ -0,0 +1,98 @@
+// Package retryafter honors HTTP 429 responses carrying a Retry-After header.
+package retryafter
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of times Transport repeats a rate limited request.
+	DefaultMaxRetries = 3
+	// DefaultMaxDelay is the longest Retry-After Transport waits for. Longer delays are left
+	// to the caller, which gets the 429 response back.
+	DefaultMaxDelay = time.Minute
+)
+
+// Parse returns the delay requested by the Retry-After header of resp, given either in
+// seconds or as an HTTP date.
+func Parse(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// Transport repeats requests answered with 429 Too Many Requests after exactly the delay of
+// their Retry-After header. It is independent of any retry policy of the caller: once
+// MaxRetries is exhausted, for a 429 without a usable Retry-After, or when waiting would
+// overrun the deadline of the request, the response is returned as is, leaving it to the
+// caller to back off.
+type Transport struct {
+	Next       http.RoundTripper
+	MaxRetries int
+	MaxDelay   time.Duration
+}
+
+func NewTransport(next http.RoundTripper) *Transport {
+	return &Transport{Next: next, MaxRetries: DefaultMaxRetries, MaxDelay: DefaultMaxDelay}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.Next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= t.MaxRetries {
+			return resp, err
+		}
+		delay, ok := Parse(resp, time.Now())
+		if !ok || delay > t.MaxDelay {
+			return resp, nil
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return resp, nil
+		}
+		retry, err := rewind(req)
+		if err != nil {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		req = retry
+	}
+}
+
+// rewind returns a copy of req with a fresh body, so it can be sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be replayed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry.Body = body
+	return retry, nil
+}
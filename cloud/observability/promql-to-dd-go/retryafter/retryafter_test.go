@@ -0,0 +1,116 @@
+package retryafter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	header := func(v string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{v}}}
+	}
+
+	d, ok := Parse(header("3"), now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = Parse(header(now.Add(time.Minute).Format(http.TimeFormat)), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+
+	d, ok = Parse(header(now.Add(-time.Minute).Format(http.TimeFormat)), now)
+	assert.True(t, ok)
+	assert.Zero(t, d)
+
+	_, ok = Parse(header("soon"), now)
+	assert.False(t, ok)
+	_, ok = Parse(&http.Response{Header: http.Header{}}, now)
+	assert.False(t, ok)
+	_, ok = Parse(nil, now)
+	assert.False(t, ok)
+}
+
+// rateLimitedServer answers the first limited requests with 429 and Retry-After, then 200.
+func rateLimitedServer(t *testing.T, limited int32, retryAfter string) (*httptest.Server, *atomic.Int32, *[]string) {
+	var calls atomic.Int32
+	bodies := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if calls.Add(1) <= limited {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls, &bodies
+}
+
+func TestTransportRetriesAfterDelay(t *testing.T) {
+	srv, calls, bodies := rateLimitedServer(t, 1, "1")
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+
+	start := time.Now()
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, []string{"payload", "payload"}, *bodies, "the body is replayed")
+}
+
+func TestTransportGivesUp(t *testing.T) {
+	t.Run("after max retries", func(t *testing.T) {
+		srv, calls, _ := rateLimitedServer(t, 10, "0")
+		client := &http.Client{Transport: &Transport{Next: http.DefaultTransport, MaxRetries: 2, MaxDelay: time.Second}}
+
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("on a delay over the maximum", func(t *testing.T) {
+		srv, calls, _ := rateLimitedServer(t, 10, "120")
+		client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("on a delay past the request deadline", func(t *testing.T) {
+		srv, calls, _ := rateLimitedServer(t, 10, "15")
+		client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "15", resp.Header.Get("Retry-After"))
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Less(t, time.Since(start), time.Second, "the 429 is returned without waiting")
+	})
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// filterSamples drops the samples of matrix before oldest, unless oldest is zero, and returns
+// the matrix along with the number of samples dropped. Streams left without a sample are
+// dropped. The input matrix is not modified. Staleness markers are not told apart: the HTTP
+// API decodes them to a plain NaN, which NonFinite handles.
+func filterSamples(matrix model.Matrix, oldest time.Time) (filtered model.Matrix, old int) {
+	cutoff := model.TimeFromUnixNano(oldest.UnixNano())
+	filtered = make(model.Matrix, 0, len(matrix))
+	for _, stream := range matrix {
+		if stream == nil {
+			continue
+		}
+		values := make([]model.SamplePair, 0, len(stream.Values))
+		for _, pair := range stream.Values {
+			if !oldest.IsZero() && pair.Timestamp.Before(cutoff) {
+				old++
+				continue
+			}
+			values = append(values, pair)
+		}
+		if len(values) == 0 && len(stream.Histograms) == 0 {
+			continue
+		}
+		filtered = append(filtered, &model.SampleStream{Metric: stream.Metric, Values: values, Histograms: stream.Histograms})
+	}
+	return filtered, old
+}
+
+// oldestSample returns the oldest sample time kept at now, zero when MaxSampleAge is not set.
+func (w *Worker) oldestSample(now time.Time) time.Time {
+	if w.MaxSampleAge <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-w.MaxSampleAge)
+}
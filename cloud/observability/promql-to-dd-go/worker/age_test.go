@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestFilterSamples(t *testing.T) {
+	oldest := time.Unix(600, 0)
+	matrix := model.Matrix{
+		&model.SampleStream{Metric: model.Metric{"temporal_namespace": "ns-a"}, Values: []model.SamplePair{
+			{Timestamp: model.TimeFromUnix(540), Value: 1},
+			{Timestamp: model.TimeFromUnix(600), Value: 2},
+			{Timestamp: model.TimeFromUnix(720), Value: model.SampleValue(math.NaN())},
+		}},
+		&model.SampleStream{Metric: model.Metric{"temporal_namespace": "ns-b"}, Values: []model.SamplePair{
+			{Timestamp: model.TimeFromUnix(540), Value: 1},
+		}},
+		nil,
+	}
+
+	filtered, old := filterSamples(matrix, oldest)
+	assert.Equal(t, 2, old)
+	require.Len(t, filtered, 1, "streams left without a sample are dropped")
+	require.Len(t, filtered[0].Values, 2, "samples at the cutoff and NaNs are kept")
+	assert.Equal(t, model.TimeFromUnix(600), filtered[0].Values[0].Timestamp)
+	assert.True(t, math.IsNaN(float64(filtered[0].Values[1].Value)))
+	assert.Len(t, matrix[0].Values, 3, "the input matrix is not modified")
+
+	_, old = filterSamples(matrix, time.Time{})
+	assert.Zero(t, old, "no age limit without a cutoff")
+}
+
+func TestWorkerMaxSampleAge(t *testing.T) {
+	now := time.Now()
+	sample := func(age time.Duration, v float64) model.SamplePair {
+		return model.SamplePair{Timestamp: model.TimeFromUnixNano(now.Add(-age).UnixNano()), Value: model.SampleValue(v)}
+	}
+	registry := promclient.NewRegistry()
+	var submitted []datadogV2.MetricSeries
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				// The range overlaps far back, past the maximum age.
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{"temporal_namespace": "ns-a"}, Values: []model.SamplePair{
+					sample(3*time.Hour, 1),
+					sample(90*time.Minute, 2),
+					sample(30*time.Minute, 3),
+					sample(10*time.Minute, 4),
+				}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration: time.Minute,
+		MaxSampleAge: time.Hour,
+		Metrics:      NewMetrics(registry),
+	}
+	require.NoError(t, w.RunOnce(context.Background()))
+
+	require.Len(t, submitted, 1)
+	values := []float64{}
+	for _, p := range submitted[0].Points {
+		values = append(values, p.GetValue())
+		assert.GreaterOrEqual(t, p.GetTimestamp(), now.Add(-time.Hour).Unix())
+	}
+	assert.Equal(t, []float64{3, 4}, values, "old samples are excluded")
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `exporter_points_dropped_total{reason="age"} 2`)
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// Backfill replays the metrics of a past range, from and to aligned to the step, in
+// consecutive sub-ranges of QueryInterval so that no single query grows unbounded. With
+// AdaptiveStepPoints, the step derives from the whole range and sub-ranges span at least
+// AdaptiveStepPoints steps. Points keep
+// their historical timestamps. When maxAge is positive, the part of the range older than
+// maxAge, which the output would reject, is skipped with a warning. Backfill stops at the
+// first failed sub-range and reports it, so it can be resumed from there.
+func (w *Worker) Backfill(ctx context.Context, from, to time.Time, maxAge time.Duration) error {
+	if !from.Before(to) {
+		return fmt.Errorf("backfill start %s is not before its end %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	w.checkConfig()
+
+	if maxAge > 0 {
+		if oldest := time.Now().Add(-maxAge); from.Before(oldest) {
+			w.logger().Warn("Backfill starts before the oldest accepted point, skipping the older part",
+				"from", from, "oldest", oldest, "max_age", model.Duration(maxAge))
+			from = oldest
+			if !from.Before(to) {
+				return errors.New("the whole backfill range is older than the oldest accepted point")
+			}
+		}
+	}
+
+	step, chunk := w.stepFor(to.Sub(from)), w.QueryInterval
+	if w.AdaptiveStepPoints > 0 {
+		chunk = max(chunk, step*time.Duration(w.AdaptiveStepPoints))
+	}
+	ranges := splitRange(from, to, chunk, step)
+	for i, queryRange := range ranges {
+		w.logger().Info("Backfilling range", "start", queryRange.Start, "end", queryRange.End, "index", i+1, "total", len(ranges))
+		if _, err := w.process(ctx, queryRange); err != nil {
+			return fmt.Errorf("backfilling %s to %s: %w", queryRange.Start.Format(time.RFC3339), queryRange.End.Format(time.RFC3339), err)
+		}
+	}
+	return nil
+}
+
+// splitRange splits from..to into consecutive ranges spanning at most chunk each, rounded down
+// to whole steps. The ends are aligned to the step and every step is covered exactly once:
+// each range starts one step after the previous end.
+func splitRange(from, to time.Time, chunk, step time.Duration) []promapi.Range {
+	maxSteps := max(int(chunk/step), 1)
+	return splitSteps(promapi.Range{Start: alignToStep(from, step), End: alignToStep(to, step), Step: step}, maxSteps)
+}
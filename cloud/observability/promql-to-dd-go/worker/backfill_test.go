@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestSplitRange(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	testCases := []struct {
+		name  string
+		from  time.Time
+		to    time.Time
+		chunk time.Duration
+		want  []promapi.Range
+	}{
+		{
+			name:  "even split",
+			from:  at(0),
+			to:    at(29),
+			chunk: 10 * time.Minute,
+			want: []promapi.Range{
+				{Start: at(0), End: at(9), Step: time.Minute},
+				{Start: at(10), End: at(19), Step: time.Minute},
+				{Start: at(20), End: at(29), Step: time.Minute},
+			},
+		},
+		{
+			name:  "shorter last range",
+			from:  at(0),
+			to:    at(14),
+			chunk: 10 * time.Minute,
+			want: []promapi.Range{
+				{Start: at(0), End: at(9), Step: time.Minute},
+				{Start: at(10), End: at(14), Step: time.Minute},
+			},
+		},
+		{
+			name:  "unaligned ends",
+			from:  at(0).Add(30 * time.Second),
+			to:    at(5).Add(59 * time.Second),
+			chunk: 10 * time.Minute,
+			want:  []promapi.Range{{Start: at(0), End: at(5), Step: time.Minute}},
+		},
+		{
+			name:  "chunk rounded to the step",
+			from:  at(0),
+			to:    at(3),
+			chunk: 90 * time.Second,
+			want: []promapi.Range{
+				{Start: at(0), End: at(0), Step: time.Minute},
+				{Start: at(1), End: at(1), Step: time.Minute},
+				{Start: at(2), End: at(2), Step: time.Minute},
+				{Start: at(3), End: at(3), Step: time.Minute},
+			},
+		},
+		{
+			name: "chunk unset",
+			from: at(0),
+			to:   at(1),
+			want: []promapi.Range{
+				{Start: at(0), End: at(0), Step: time.Minute},
+				{Start: at(1), End: at(1), Step: time.Minute},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, splitRange(tc.from, tc.to, tc.chunk, time.Minute))
+		})
+	}
+}
+
+func TestWorkerBackfill(t *testing.T) {
+	var ranges []promapi.Range
+	var submitted []datadogV2.MetricSeries
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"temporal_cloud_v0_pending_tasks"}}, nil
+			},
+			queryMetrics: func(_ context.Context, _ string, queryRange promapi.Range) (model.Matrix, error) {
+				ranges = append(ranges, queryRange)
+				return model.Matrix{&model.SampleStream{
+					Metric: model.Metric{},
+					Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(queryRange.Start.Unix()), Value: 1}},
+				}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = append(submitted, series...)
+				return nil
+			},
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+	}
+
+	to := time.Now().Truncate(time.Minute)
+	from := to.Add(-3 * time.Hour)
+
+	t.Run("whole range", func(t *testing.T) {
+		require.NoError(t, w.Backfill(context.Background(), from, to, 0))
+		require.Len(t, ranges, 19)
+		assert.Equal(t, from, ranges[0].Start)
+		assert.Equal(t, to, ranges[18].End)
+		require.Len(t, submitted, 19)
+		assert.Equal(t, from.Unix(), *submitted[0].Points[0].Timestamp, "points keep their historical timestamps")
+	})
+
+	t.Run("older than the maximum age", func(t *testing.T) {
+		ranges, submitted = nil, nil
+		require.NoError(t, w.Backfill(context.Background(), from, to, time.Hour))
+		require.NotEmpty(t, ranges)
+		assert.False(t, ranges[0].Start.Before(to.Add(-time.Hour-time.Minute)))
+	})
+
+	t.Run("entirely older than the maximum age", func(t *testing.T) {
+		assert.Error(t, w.Backfill(context.Background(), from, from.Add(time.Hour), time.Hour))
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		assert.Error(t, w.Backfill(context.Background(), to, from, 0))
+	})
+
+	t.Run("adaptive step", func(t *testing.T) {
+		ranges, submitted = nil, nil
+		w.AdaptiveStepPoints = 30
+		require.NoError(t, w.Backfill(context.Background(), from, to, 0))
+		require.NotEmpty(t, ranges)
+		assert.LessOrEqual(t, len(ranges), 2, "sub-ranges stretch to hold the target points")
+		for _, r := range ranges {
+			assert.Equal(t, 6*time.Minute, r.Step)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultRetryBackoffBase = 3 * time.Second
+	DefaultRetryBackoffMax  = 2 * time.Minute
+)
+
+// backoff computes exponential retry delays with full jitter: the n-th consecutive
+// failure sleeps a random duration in [0, min(max, base*2^n)].
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+	jitter  func(ceiling time.Duration) time.Duration
+}
+
+func newBackoff(base, max time.Duration) *backoff {
+	if base <= 0 {
+		base = DefaultRetryBackoffBase
+	}
+	if max < base {
+		max = base
+	}
+	return &backoff{base: base, max: max, jitter: fullJitter}
+}
+
+func fullJitter(ceiling time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Next returns the delay before the next retry and advances the attempt counter.
+func (b *backoff) Next() time.Duration {
+	ceiling := b.base
+	for i := 0; i < b.attempt && ceiling < b.max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > b.max {
+		ceiling = b.max
+	}
+	b.attempt++
+	return b.jitter(ceiling)
+}
+
+// Reset starts the sequence over, used after a successful cycle.
+func (b *backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffGrowsAndIsCapped(t *testing.T) {
+	b := newBackoff(time.Second, 10*time.Second)
+	b.jitter = func(ceiling time.Duration) time.Duration { return ceiling }
+
+	got := []time.Duration{}
+	for i := 0; i < 6; i++ {
+		got = append(got, b.Next())
+	}
+	assert.Equal(t, []time.Duration{
+		1 * time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	}, got)
+
+	b.Reset()
+	assert.Equal(t, time.Second, b.Next())
+}
+
+func TestBackoffFullJitterStaysWithinCeiling(t *testing.T) {
+	b := newBackoff(time.Millisecond, 100*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		d := b.Next()
+		assert.GreaterOrEqual(t, d, time.Duration(0))
+		assert.LessOrEqual(t, d, 100*time.Millisecond)
+	}
+	// Many failures later the shift must not overflow.
+	assert.LessOrEqual(t, b.Next(), 100*time.Millisecond)
+}
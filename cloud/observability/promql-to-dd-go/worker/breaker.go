@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// ErrCircuitOpen is returned instead of submitting while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open, submission skipped")
+
+// DefaultBreakerOpenDuration is used when BreakerOpenDuration is not set.
+const DefaultBreakerOpenDuration = time.Minute
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is a circuit breaker around submissions. It opens after threshold consecutive
+// failures and rejects submissions for openDuration, then lets a single probe through: the
+// probe closes it on success and opens it again on failure. It is safe for concurrent use.
+type breaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a submission may be attempted at now, moving an expired open breaker
+// to half-open for the probe.
+func (b *breaker) allow(now time.Time, openDuration time.Duration) (bool, breakerState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < openDuration {
+			return false, b.state
+		}
+		b.state = breakerHalfOpen
+		return true, b.state
+	case breakerHalfOpen:
+		// The probe is still in flight.
+		return false, b.state
+	default:
+		return true, b.state
+	}
+}
+
+// record accounts the outcome of an allowed submission and returns the resulting state.
+func (b *breaker) record(err error, now time.Time, threshold int) breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.state = breakerClosed
+		b.failures = 0
+		return b.state
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+	return b.state
+}
+
+// abandon accounts an allowed submission that was cancelled before its outcome was known. An
+// abandoned probe puts the breaker back to open since openedAt, so that the next submission
+// probes again instead of waiting forever for its outcome. It returns the resulting state.
+func (b *breaker) abandon() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+	return b.state
+}
+
+func (w *Worker) breakerOpenDuration() time.Duration {
+	if w.BreakerOpenDuration <= 0 {
+		return DefaultBreakerOpenDuration
+	}
+	return w.BreakerOpenDuration
+}
+
+// submit submits the series through the circuit breaker, when BreakerFailureThreshold is set.
+func (w *Worker) submit(ctx context.Context, series []datadogV2.MetricSeries) error {
+	if w.BreakerFailureThreshold <= 0 {
+		return w.SubmitMetrics(ctx, series)
+	}
+
+	allowed, state := w.breaker.allow(time.Now(), w.breakerOpenDuration())
+	w.Metrics.setBreakerState(state)
+	if !allowed {
+		return ErrCircuitOpen
+	}
+
+	err := w.SubmitMetrics(ctx, series)
+	var next breakerState
+	if ctx.Err() != nil {
+		// A cancelled submission says nothing about the health of the output.
+		next = w.breaker.abandon()
+	} else {
+		next = w.breaker.record(err, time.Now(), w.BreakerFailureThreshold)
+	}
+	if next != state {
+		w.logger().Warn("Circuit breaker changed state", "from", state, "to", next)
+		w.Metrics.setBreakerState(next)
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	errRejected := errors.New("rejected")
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := &breaker{}
+
+	allowed, state := b.allow(now, time.Minute)
+	assert.True(t, allowed)
+	assert.Equal(t, breakerClosed, state)
+	assert.Equal(t, breakerClosed, b.record(errRejected, now, 2), "below the threshold")
+	assert.Equal(t, breakerOpen, b.record(errRejected, now, 2), "threshold reached")
+
+	allowed, state = b.allow(now.Add(30*time.Second), time.Minute)
+	assert.False(t, allowed, "open breaker fails fast")
+	assert.Equal(t, breakerOpen, state)
+
+	allowed, state = b.allow(now.Add(time.Minute), time.Minute)
+	assert.True(t, allowed, "probe after the open duration")
+	assert.Equal(t, breakerHalfOpen, state)
+	allowed, _ = b.allow(now.Add(time.Minute), time.Minute)
+	assert.False(t, allowed, "single probe at a time")
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, breakerOpen, b.record(errRejected, now, 2), "failed probe opens again")
+	allowed, _ = b.allow(now.Add(30*time.Second), time.Minute)
+	assert.False(t, allowed)
+
+	allowed, state = b.allow(now.Add(time.Minute), time.Minute)
+	require.True(t, allowed)
+	assert.Equal(t, breakerHalfOpen, state)
+	assert.Equal(t, breakerClosed, b.record(nil, now.Add(time.Minute), 2), "successful probe closes")
+
+	assert.Equal(t, breakerClosed, b.record(errRejected, now, 2), "failures are counted anew")
+}
+
+func TestWorkerCircuitBreaker(t *testing.T) {
+	registry := promclient.NewRegistry()
+	calls := 0
+	var submitErr error
+	w := Worker{
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				calls++
+				return submitErr
+			},
+		},
+		BreakerFailureThreshold: 2,
+		BreakerOpenDuration:     20 * time.Millisecond,
+		Metrics:                 NewMetrics(registry),
+	}
+	breakerGauge := func() string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+	ctx := context.Background()
+	series := []datadogV2.MetricSeries{{Metric: "pending_tasks"}}
+
+	submitErr = errors.New("datadog unavailable")
+	assert.ErrorIs(t, w.submit(ctx, series), submitErr)
+	assert.ErrorIs(t, w.submit(ctx, series), submitErr)
+	assert.ErrorIs(t, w.submit(ctx, series), ErrCircuitOpen)
+	assert.Equal(t, 2, calls, "no submission while open")
+	assert.Contains(t, breakerGauge(), "exporter_circuit_breaker_state 1")
+
+	time.Sleep(30 * time.Millisecond)
+	submitErr = nil
+	require.NoError(t, w.submit(ctx, series))
+	assert.Equal(t, 3, calls)
+	assert.Contains(t, breakerGauge(), "exporter_circuit_breaker_state 0")
+}
+
+func TestWorkerCircuitBreakerCancelledProbe(t *testing.T) {
+	calls := 0
+	var submitErr error
+	w := Worker{
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(ctx context.Context, _ []datadogV2.MetricSeries) error {
+				calls++
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return submitErr
+			},
+		},
+		BreakerFailureThreshold: 1,
+		BreakerOpenDuration:     20 * time.Millisecond,
+	}
+	series := []datadogV2.MetricSeries{{Metric: "pending_tasks"}}
+
+	submitErr = errors.New("datadog unavailable")
+	assert.ErrorIs(t, w.submit(context.Background(), series), submitErr)
+	time.Sleep(30 * time.Millisecond)
+
+	// The probe is cancelled, by a shutdown or the cycle deadline.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, w.submit(cancelled, series), context.Canceled)
+	assert.Equal(t, 2, calls)
+
+	submitErr = nil
+	require.NoError(t, w.submit(context.Background(), series), "the next submission probes again")
+	assert.Equal(t, 3, calls)
+	allowed, state := w.breaker.allow(time.Now(), w.breakerOpenDuration())
+	assert.True(t, allowed)
+	assert.Equal(t, breakerClosed, state)
+}
+
+func TestWorkerCircuitBreakerDisabled(t *testing.T) {
+	calls := 0
+	w := Worker{
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				calls++
+				return errors.New("datadog unavailable")
+			},
+		},
+	}
+	for i := 0; i < 5; i++ {
+		assert.Error(t, w.submit(context.Background(), []datadogV2.MetricSeries{{Metric: "pending_tasks"}}))
+	}
+	assert.Equal(t, 5, calls)
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"sync"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/prometheus/common/model"
+)
+
+// pointBudget bounds the points converted within a cycle, see MaxPointsPerCycle. A nil
+// *pointBudget is unlimited. It is safe for concurrent use.
+type pointBudget struct {
+	mu        sync.Mutex
+	remaining int
+	dropped   int
+}
+
+func newPointBudget(limit int) *pointBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &pointBudget{remaining: limit}
+}
+
+// exhausted reports whether no point is left. The samples of matrix are then counted as
+// dropped, so that the caller can skip converting it.
+func (b *pointBudget) exhausted(matrix model.Matrix) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining > 0 {
+		return false
+	}
+	for _, s := range matrix {
+		b.dropped += len(s.Values) + len(s.Histograms)
+	}
+	return true
+}
+
+// take keeps the points of series that fit in the remaining budget, truncating the series
+// crossing it and dropping the following ones.
+func (b *pointBudget) take(series []datadogV2.MetricSeries) []datadogV2.MetricSeries {
+	if b == nil {
+		return series
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept, dropped := series[:0], 0
+	for _, s := range series {
+		if b.remaining <= 0 {
+			dropped += len(s.Points)
+			continue
+		}
+		if len(s.Points) > b.remaining {
+			dropped += len(s.Points) - b.remaining
+			s.Points = s.Points[:b.remaining]
+		}
+		b.remaining -= len(s.Points)
+		kept = append(kept, s)
+	}
+	b.dropped += dropped
+	return kept
+}
+
+// overflow returns the number of points dropped so far.
+func (b *pointBudget) overflow() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
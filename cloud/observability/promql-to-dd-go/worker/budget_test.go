@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerMaxPointsPerCycle(t *testing.T) {
+	// workflow_count returns 10 series of 100 points, four times the cap.
+	oversized := model.Matrix{}
+	for i := 0; i < 10; i++ {
+		stream := &model.SampleStream{Metric: model.Metric{"temporal_namespace": model.LabelValue(fmt.Sprintf("ns-%d", i))}}
+		for j := 0; j < 100; j++ {
+			stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.Time(j * 60_000), Value: 1})
+		}
+		oversized = append(oversized, stream)
+	}
+	registry := promclient.NewRegistry()
+	var submitted []datadogV2.MetricSeries
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"workflow_count", "pending_tasks"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				if promql == "workflow_count" {
+					return oversized, nil
+				}
+				return model.Matrix{&model.SampleStream{Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration:      time.Minute,
+		QueryInterval:     10 * time.Minute,
+		QueryConcurrency:  1,
+		MaxPointsPerCycle: 250,
+		Metrics:           NewMetrics(registry),
+	}
+	require.NoError(t, w.RunOnce(context.Background()))
+
+	assert.Equal(t, 250, countPoints(submitted))
+	require.Len(t, submitted, 3)
+	for _, s := range submitted {
+		assert.Equal(t, "workflow_count", s.Metric)
+	}
+	assert.Len(t, submitted[2].Points, 50)
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `exporter_points_dropped_total{reason="point_limit"} 751`)
+}
+
+func TestPointBudgetUnlimited(t *testing.T) {
+	budget := newPointBudget(0)
+	series := []datadogV2.MetricSeries{{Points: make([]datadogV2.MetricPoint, 5)}}
+	assert.False(t, budget.exhausted(model.Matrix{}))
+	assert.Equal(t, series, budget.take(series))
+	assert.Zero(t, budget.overflow())
+}
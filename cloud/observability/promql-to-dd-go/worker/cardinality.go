@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// CardinalityAction is what happens to a metric exceeding MaxSeriesPerMetric.
+type CardinalityAction string
+
+const (
+	// CardinalityWarn logs the metric and submits it anyway. This is the default.
+	CardinalityWarn CardinalityAction = "warn"
+	// CardinalityDrop logs the metric and drops all its series.
+	CardinalityDrop CardinalityAction = "drop"
+)
+
+func ParseCardinalityAction(s string) (CardinalityAction, error) {
+	switch a := CardinalityAction(s); a {
+	case "", CardinalityWarn:
+		return CardinalityWarn, nil
+	case CardinalityDrop:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown cardinality action %q, want %q or %q", s, CardinalityWarn, CardinalityDrop)
+	}
+}
+
+// highCardinality returns the number of distinct tag sets of every metric of results that has
+// more than limit of them.
+func highCardinality(results [][]datadogV2.MetricSeries, limit int) map[string]int {
+	tagSets := map[string]map[string]bool{}
+	for _, series := range results {
+		for _, s := range series {
+			if tagSets[s.Metric] == nil {
+				tagSets[s.Metric] = map[string]bool{}
+			}
+			tagSets[s.Metric][seriesKey(s)] = true
+		}
+	}
+	offending := map[string]int{}
+	for metric, keys := range tagSets {
+		if len(keys) > limit {
+			offending[metric] = len(keys)
+		}
+	}
+	return offending
+}
+
+// guardCardinality estimates the cardinality of every metric of a cycle's results and, when
+// MaxSeriesPerMetric is set, reports the metrics exceeding it, dropping their series in place
+// with CardinalityDrop. It returns the number of offending metrics.
+func (w *Worker) guardCardinality(source Source, results [][]datadogV2.MetricSeries) int {
+	if w.MaxSeriesPerMetric <= 0 {
+		return 0
+	}
+	offending := highCardinality(results, w.MaxSeriesPerMetric)
+	names := make([]string, 0, len(offending))
+	for metric := range offending {
+		names = append(names, metric)
+	}
+	sort.Strings(names)
+
+	drop := w.CardinalityAction == CardinalityDrop
+	msg := "High cardinality metric"
+	if drop {
+		msg = "Dropping high cardinality metric"
+	}
+	for _, metric := range names {
+		w.logger().Warn(msg, "source", source.name(), "metric", metric, "tag_sets", offending[metric], "limit", w.MaxSeriesPerMetric)
+	}
+	if drop && len(offending) > 0 {
+		for i, series := range results {
+			kept := series[:0]
+			for _, s := range series {
+				if _, ok := offending[s.Metric]; !ok {
+					kept = append(kept, s)
+					continue
+				}
+				w.Metrics.addPointsDropped(dropReasonCardinality, len(s.Points))
+			}
+			results[i] = kept
+		}
+	}
+	return len(offending)
+}
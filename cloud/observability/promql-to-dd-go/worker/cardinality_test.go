@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerCardinalityGuard(t *testing.T) {
+	// operations_total explodes with 50 operations for each of 4 namespaces.
+	explosive := model.Matrix{}
+	for ns := 0; ns < 4; ns++ {
+		for op := 0; op < 50; op++ {
+			explosive = append(explosive, &model.SampleStream{Metric: model.Metric{
+				"temporal_namespace": model.LabelValue(fmt.Sprintf("ns-%d", ns)),
+				"operation":          model.LabelValue(fmt.Sprintf("Operation%d", op)),
+			}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}})
+		}
+	}
+	newWorker := func(action CardinalityAction, registry *promclient.Registry, submitted *[]datadogV2.MetricSeries) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Gauges: []string{"operations_total", "pending_tasks"}}, nil
+				},
+				queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+					if promql == "operations_total" {
+						return explosive, nil
+					}
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{"temporal_namespace": "ns-0"}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+					*submitted = series
+					return nil
+				},
+			},
+			StepDuration:       time.Minute,
+			QueryInterval:      10 * time.Minute,
+			MaxSeriesPerMetric: 100,
+			CardinalityAction:  action,
+			Metrics:            NewMetrics(registry),
+		}
+	}
+	gauge := func(registry *promclient.Registry) string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	t.Run("warn", func(t *testing.T) {
+		registry := promclient.NewRegistry()
+		var submitted []datadogV2.MetricSeries
+		require.NoError(t, newWorker(CardinalityWarn, registry, &submitted).RunOnce(context.Background()))
+		assert.Len(t, submitted, 201)
+		assert.Contains(t, gauge(registry), `exporter_high_cardinality_metrics{source=""} 1`)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		registry := promclient.NewRegistry()
+		var submitted []datadogV2.MetricSeries
+		require.NoError(t, newWorker(CardinalityDrop, registry, &submitted).RunOnce(context.Background()))
+		require.Len(t, submitted, 1)
+		assert.Equal(t, "pending_tasks", submitted[0].Metric)
+		assert.Contains(t, gauge(registry), `exporter_high_cardinality_metrics{source=""} 1`)
+		assert.Contains(t, gauge(registry), `exporter_points_dropped_total{reason="cardinality"} 200`)
+	})
+}
+
+func TestHighCardinalityCountsDistinctTagSets(t *testing.T) {
+	series := func(metric string, tags ...string) datadogV2.MetricSeries {
+		return datadogV2.MetricSeries{Metric: metric, Tags: tags}
+	}
+	results := [][]datadogV2.MetricSeries{
+		{series("a", "x:1"), series("a", "x:2"), series("a", "x:1")},
+		{series("b", "x:1"), series("a", "x:3")},
+	}
+	assert.Equal(t, map[string]int{"a": 3}, highCardinality(results, 2))
+	assert.Empty(t, highCardinality(results, 3))
+}
+
+func TestParseCardinalityAction(t *testing.T) {
+	for s, want := range map[string]CardinalityAction{"": CardinalityWarn, "warn": CardinalityWarn, "drop": CardinalityDrop} {
+		got, err := ParseCardinalityAction(s)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseCardinalityAction("sample")
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CheckpointStore persists the end of the last fully submitted range across restarts.
+type CheckpointStore interface {
+	// Load returns the stored end, or the zero time when nothing was stored yet.
+	Load() (time.Time, error)
+	Save(end time.Time) error
+}
+
+// FileCheckpoint stores the checkpoint as an RFC 3339 timestamp in the file at Path.
+type FileCheckpoint struct {
+	Path string
+}
+
+func (f FileCheckpoint) Load() (time.Time, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed reading checkpoint: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("corrupt checkpoint %s: %w", f.Path, err)
+	}
+	return end, nil
+}
+
+// Save replaces the file through a rename, so that a crash never leaves a partial checkpoint.
+func (f FileCheckpoint) Save(end time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(end.UTC().Format(time.RFC3339Nano) + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return fmt.Errorf("failed writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+// restoreCheckpoint seeds the coverage from the Checkpoint once, so that the first range
+// after a restart resumes from the last submitted end. A missing or unreadable checkpoint
+// falls back to the sliding window, and one older than CheckpointMaxAge resumes from
+// CheckpointMaxAge ago.
+func (w *Worker) restoreCheckpoint(now time.Time) {
+	if w.Checkpoint == nil || !w.coverage.restore() {
+		return
+	}
+	end, err := w.Checkpoint.Load()
+	if err != nil {
+		w.logger().Warn("Ignoring checkpoint, resuming from the query window", "error", err)
+		return
+	}
+	if end.IsZero() {
+		return
+	}
+	if w.CheckpointMaxAge > 0 {
+		if oldest := now.Add(-w.CheckpointMaxAge); end.Before(oldest) {
+			w.logger().Warn("Checkpoint is older than the maximum age, resuming from the maximum age",
+				"checkpoint", end, "max_age", w.CheckpointMaxAge)
+			end = oldest
+		}
+	}
+	w.logger().Info("Resuming from checkpoint", "checkpoint", end)
+	w.coverage.advance(end)
+}
+
+// saveCheckpoint persists end, logging failures: the next save retries and in the meantime
+// the in-memory coverage is used.
+func (w *Worker) saveCheckpoint(end time.Time) {
+	if w.Checkpoint == nil {
+		return
+	}
+	if err := w.Checkpoint.Save(end); err != nil {
+		w.logger().Warn("Failed saving checkpoint", "error", err)
+	}
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func checkpointWorker(checkpoint CheckpointStore) *Worker {
+	return &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		Checkpoint:    checkpoint,
+	}
+}
+
+func TestWorkerResumesFromCheckpoint(t *testing.T) {
+	checkpoint := FileCheckpoint{Path: filepath.Join(t.TempDir(), "checkpoint")}
+
+	result, err := checkpointWorker(checkpoint).Reconcile(context.Background())
+	require.NoError(t, err)
+	saved, err := checkpoint.Load()
+	require.NoError(t, err)
+	assert.True(t, saved.Equal(result.Range.End), "the end of the submitted range is saved")
+
+	// The previous process stopped half an hour ago, past the query window of a fresh start.
+	stoppedAt := time.Now().Add(-30 * time.Minute).Truncate(time.Minute)
+	require.NoError(t, checkpoint.Save(stoppedAt))
+
+	restarted := checkpointWorker(checkpoint)
+	result, err = restarted.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.True(t, stoppedAt.Add(-time.Minute).Equal(result.Range.Start), "resumes one step before the checkpoint, got %s", result.Range.Start)
+
+	result, err = restarted.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, restarted.QueryWindow(), result.Range.End.Sub(result.Range.Start), "the checkpoint is only restored once")
+}
+
+func TestWorkerCheckpointFallback(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := FileCheckpoint{Path: filepath.Join(dir, "corrupt")}
+	require.NoError(t, os.WriteFile(corrupt.Path, []byte("yesterday"), 0o600))
+	_, err := corrupt.Load()
+	assert.ErrorContains(t, err, "corrupt checkpoint")
+
+	for name, checkpoint := range map[string]FileCheckpoint{
+		"missing": {Path: filepath.Join(dir, "missing")},
+		"corrupt": corrupt,
+	} {
+		w := checkpointWorker(checkpoint)
+		result, err := w.Reconcile(context.Background())
+		require.NoError(t, err, name)
+		assert.Equal(t, w.QueryWindow(), result.Range.End.Sub(result.Range.Start), name)
+		saved, err := checkpoint.Load()
+		require.NoError(t, err, name)
+		assert.True(t, saved.Equal(result.Range.End), "%s checkpoint is replaced", name)
+	}
+}
+
+func TestWorkerCheckpointMaxAge(t *testing.T) {
+	checkpoint := FileCheckpoint{Path: filepath.Join(t.TempDir(), "checkpoint")}
+	require.NoError(t, checkpoint.Save(time.Now().Add(-48*time.Hour)))
+
+	w := checkpointWorker(checkpoint)
+	w.CheckpointMaxAge = time.Hour
+	result, err := w.Reconcile(context.Background())
+	require.NoError(t, err)
+	span := result.Range.End.Sub(result.Range.Start)
+	assert.Greater(t, span, w.QueryWindow())
+	assert.LessOrEqual(t, span, time.Hour+2*time.Minute)
+}
@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// coverage records the end of the last range that was fully submitted, so the next range
+// resumes from there instead of being derived from the current time alone. It is safe for
+// concurrent use.
+type coverage struct {
+	mu      sync.Mutex
+	lastEnd time.Time
+	// queries holds the ends past lastEnd submitted by queries that succeeded while others of
+	// their cycle failed, so that they resume from there instead of submitting again the range
+	// the failures stretch back to. They are not checkpointed.
+	queries  map[queryKey]time.Time
+	restored bool
+}
+
+// queryKey identifies a query across cycles.
+type queryKey struct {
+	source string
+	promql string
+}
+
+// restore reports whether the coverage still has to be restored from a checkpoint, marking
+// it restored.
+func (c *coverage) restore() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.restored {
+		return false
+	}
+	c.restored = true
+	return true
+}
+
+func (c *coverage) end() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastEnd
+}
+
+func (c *coverage) advance(end time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if end.After(c.lastEnd) {
+		c.lastEnd = end
+	}
+	for key, queryEnd := range c.queries {
+		if !queryEnd.After(c.lastEnd) {
+			delete(c.queries, key)
+		}
+	}
+}
+
+// advanceQuery records that the query of key was submitted up to end.
+func (c *coverage) advanceQuery(key queryKey, end time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !end.After(c.lastEnd) || !end.After(c.queries[key]) {
+		return
+	}
+	if c.queries == nil {
+		c.queries = map[queryKey]time.Time{}
+	}
+	c.queries[key] = end
+}
+
+// queryEnd returns the end submitted by the query of key past lastEnd, zero if none.
+func (c *coverage) queryEnd(key queryKey) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queries[key]
+}
+
+func (w *Worker) step() time.Duration {
+	if w.StepDuration <= 0 {
+		return time.Minute
+	}
+	return w.StepDuration
+}
+
+// stepFor returns the step of a range spanning span. With AdaptiveStepPoints, the step is span
+// divided by AdaptiveStepPoints, rounded up to whole seconds and bounded by MinStepDuration
+// and MaxStepDuration, so that every query returns about the same number of points per
+// series. Otherwise it is the fixed StepDuration.
+func (w *Worker) stepFor(span time.Duration) time.Duration {
+	if w.AdaptiveStepPoints <= 0 {
+		return w.step()
+	}
+	step := (span/time.Duration(w.AdaptiveStepPoints) + time.Second - 1).Truncate(time.Second)
+	return min(max(step, w.minStep()), w.maxStep())
+}
+
+func (w *Worker) minStep() time.Duration {
+	if w.MinStepDuration <= 0 {
+		return DefaultMinStepDuration
+	}
+	return w.MinStepDuration
+}
+
+func (w *Worker) maxStep() time.Duration {
+	if w.MaxStepDuration <= 0 {
+		return DefaultMaxStepDuration
+	}
+	return w.MaxStepDuration
+}
+
+// alignToStep rounds t down to a multiple of step since the Unix epoch, the boundaries
+// Prometheus and Datadog align steps and rollups to. Unlike time.Truncate, which counts from
+// the zero time, this also holds for steps that do not divide a day, such as adaptive ones.
+func alignToStep(t time.Time, step time.Duration) time.Time {
+	if step <= 0 {
+		return t.Round(0)
+	}
+	offset := time.Duration(t.UnixNano() % int64(step))
+	if offset < 0 {
+		offset += step
+	}
+	return t.Round(0).Add(-offset)
+}
+
+// calcRange returns the range queried by a cycle starting at now. Both ends are aligned to
+// the step and the end is the last complete step before now minus QueryDelay, so no partial
+// step is submitted. The range spans at least QueryWindow and, once a cycle succeeded, starts
+// at least one step before the previous end: consecutive ranges always overlap by one step or
+// more, and a range following failed cycles stretches back to cover them. The adaptive step
+// is chosen for the span actually queried, including that stretch.
+func (w *Worker) calcRange(now time.Time) promapi.Range {
+	start, end := w.stretchRange(now, w.stepFor(w.QueryWindow()))
+	step := w.stepFor(end.Sub(start))
+	start, end = w.stretchRange(now, step)
+	return promapi.Range{Start: start, End: end, Step: step}
+}
+
+// stretchRange returns the ends of the range calcRange queries at now with step.
+func (w *Worker) stretchRange(now time.Time, step time.Duration) (start, end time.Time) {
+	end = alignToStep(now.Add(-w.QueryDelay), step)
+	start = alignToStep(end.Add(-w.QueryWindow()), step)
+	if lastEnd := w.coverage.end(); !lastEnd.IsZero() {
+		if resume := alignToStep(lastEnd.Add(-step), step); resume.Before(start) {
+			start = resume
+		}
+	}
+	return start, end
+}
+
+// queryRange returns the range q of source is queried over: queryRange, starting instead one
+// step before the end q already submitted when it succeeded in a cycle where others failed.
+func (w *Worker) queryRange(source string, q query, queryRange promapi.Range) promapi.Range {
+	end := w.coverage.queryEnd(queryKey{source: source, promql: q.promql})
+	if end.IsZero() {
+		return queryRange
+	}
+	if resume := alignToStep(end.Add(-queryRange.Step), queryRange.Step); resume.After(queryRange.Start) {
+		queryRange.Start = resume
+	}
+	return queryRange
+}
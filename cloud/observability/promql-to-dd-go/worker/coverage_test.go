@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalcRangeAlignment(t *testing.T) {
+	w := &Worker{StepDuration: time.Minute, QueryInterval: 10 * time.Minute}
+	now := time.Date(2024, time.March, 1, 12, 30, 42, 0, time.UTC)
+
+	r := w.calcRange(now)
+	assert.Equal(t, time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC), r.End, "end is the last complete step")
+	assert.Equal(t, time.Date(2024, time.March, 1, 12, 18, 0, 0, time.UTC), r.Start, "start is one query window before the end")
+	assert.Equal(t, time.Minute, r.Step)
+}
+
+func TestCalcRangeAlignsToStep(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 33, 42, 0, time.UTC)
+	for _, tc := range []struct {
+		step       time.Duration
+		start, end time.Time
+	}{
+		{
+			step:  15 * time.Second,
+			end:   time.Date(2024, time.March, 1, 12, 33, 30, 0, time.UTC),
+			start: time.Date(2024, time.March, 1, 12, 21, 30, 0, time.UTC),
+		},
+		{
+			step:  5 * time.Minute,
+			end:   time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC),
+			start: time.Date(2024, time.March, 1, 12, 15, 0, 0, time.UTC),
+		},
+	} {
+		w := &Worker{StepDuration: tc.step, QueryInterval: 10 * time.Minute}
+		r := w.calcRange(now)
+		assert.Equal(t, tc.step, r.Step)
+		assert.Equal(t, tc.end, r.End, tc.step)
+		assert.Equal(t, tc.start, r.Start, tc.step)
+		assert.Zero(t, r.Start.Unix()%int64(tc.step.Seconds()), tc.step)
+	}
+}
+
+func TestAlignToStepUsesUnixEpoch(t *testing.T) {
+	// 101s does not divide a day, time.Truncate would align it to the zero time instead.
+	step := 101 * time.Second
+	aligned := alignToStep(time.Date(2024, time.March, 1, 12, 33, 42, 0, time.UTC), step)
+	assert.Zero(t, aligned.Unix()%101)
+	assert.Equal(t, time.UTC, aligned.Location())
+	assert.Less(t, time.Date(2024, time.March, 1, 12, 33, 42, 0, time.UTC).Sub(aligned), step)
+}
+
+func TestCalcRangeQueryDelay(t *testing.T) {
+	w := &Worker{StepDuration: time.Minute, QueryInterval: 10 * time.Minute, QueryDelay: 90 * time.Second}
+	now := time.Date(2024, time.March, 1, 12, 30, 42, 0, time.UTC)
+
+	r := w.calcRange(now)
+	assert.Equal(t, time.Date(2024, time.March, 1, 12, 29, 0, 0, time.UTC), r.End, "end is the last complete step before now minus the delay")
+	assert.Equal(t, time.Date(2024, time.March, 1, 12, 17, 0, 0, time.UTC), r.Start, "start is one query window before the delayed end")
+}
+
+func TestStepForAdaptive(t *testing.T) {
+	fixed := &Worker{StepDuration: 30 * time.Second}
+	assert.Equal(t, 30*time.Second, fixed.stepFor(30*24*time.Hour), "fixed step mode ignores the range")
+
+	w := &Worker{StepDuration: time.Minute, AdaptiveStepPoints: 100, MinStepDuration: 30 * time.Second, MaxStepDuration: 10 * time.Minute}
+	for _, tc := range []struct {
+		span time.Duration
+		want time.Duration
+	}{
+		{span: 0, want: 30 * time.Second},
+		{span: 10 * time.Minute, want: 30 * time.Second},
+		{span: 2 * time.Hour, want: 72 * time.Second},
+		{span: 3 * time.Hour, want: 108 * time.Second},
+		{span: 1001 * time.Second, want: 30 * time.Second},
+		{span: 10001 * time.Second, want: 101 * time.Second},
+		{span: 16 * time.Hour, want: 576 * time.Second},
+		{span: 24 * time.Hour, want: 10 * time.Minute},
+		{span: 30 * 24 * time.Hour, want: 10 * time.Minute},
+	} {
+		step := w.stepFor(tc.span)
+		assert.GreaterOrEqual(t, step, w.MinStepDuration, tc.span)
+		assert.LessOrEqual(t, step, w.MaxStepDuration, tc.span)
+		assert.Equal(t, step.Truncate(time.Second), step, "step %s is not whole seconds", step)
+		assert.Equal(t, tc.want, step, tc.span)
+	}
+
+	defaults := &Worker{AdaptiveStepPoints: 100}
+	assert.Equal(t, DefaultMinStepDuration, defaults.stepFor(time.Minute))
+	assert.Equal(t, DefaultMaxStepDuration, defaults.stepFor(365*24*time.Hour))
+}
+
+func TestCalcRangeAdaptiveStep(t *testing.T) {
+	w := &Worker{QueryInterval: 2 * time.Hour, OverlapFactor: 1, AdaptiveStepPoints: 60}
+	now := time.Date(2024, time.March, 1, 12, 30, 42, 0, time.UTC)
+
+	r := w.calcRange(now)
+	assert.Equal(t, 2*time.Minute, r.Step)
+	assert.Equal(t, time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC), r.End)
+	assert.Equal(t, 60, int(r.End.Sub(r.Start)/r.Step))
+
+	// After six hours of failed cycles the range stretches back to the last end and the step
+	// grows with it, instead of querying 180 points at the window step.
+	lastEnd := r.End
+	w.coverage.advance(lastEnd)
+	r = w.calcRange(now.Add(6 * time.Hour))
+	assert.Equal(t, 362*time.Second, r.Step, "6h2m over 60 points")
+	assert.Equal(t, time.Date(2024, time.March, 1, 18, 27, 44, 0, time.UTC), r.End)
+	assert.Equal(t, time.Date(2024, time.March, 1, 12, 19, 42, 0, time.UTC), r.Start)
+	assert.Zero(t, r.Start.Unix()%int64(r.Step.Seconds()))
+	assert.False(t, r.Start.After(lastEnd.Add(-r.Step)), "the range overlaps the last end by a step")
+}
+
+func TestCalcRangeCyclesAreContiguous(t *testing.T) {
+	w := &Worker{StepDuration: time.Minute, QueryInterval: 2 * time.Minute, OverlapFactor: 1}
+	now := time.Date(2024, time.March, 1, 12, 0, 17, 0, time.UTC)
+
+	// Cycles drift from the interval and one of them fails, which leaves a range uncovered
+	// unless the next range resumes from the last successful end.
+	cycles := []struct {
+		after  time.Duration
+		failed bool
+	}{
+		{after: 0},
+		{after: 2*time.Minute + 40*time.Second},
+		{after: 2 * time.Minute, failed: true},
+		{after: 5 * time.Minute},
+		{after: 90 * time.Second},
+		{after: 2 * time.Minute},
+	}
+
+	var covered []struct{ start, end time.Time }
+	for i, c := range cycles {
+		now = now.Add(c.after)
+		r := w.calcRange(now)
+		require.False(t, r.End.After(now), "cycle %d must not query the future", i)
+		require.True(t, r.Start.Before(r.End), "cycle %d has an empty range", i)
+		if c.failed {
+			continue
+		}
+		if n := len(covered); n > 0 {
+			previousEnd := covered[n-1].end
+			assert.False(t, r.Start.After(previousEnd.Add(-w.StepDuration)),
+				"cycle %d starts at %s, leaving a gap after %s", i, r.Start, previousEnd)
+		}
+		covered = append(covered, struct{ start, end time.Time }{r.Start, r.End})
+		w.coverage.advance(r.End)
+	}
+	assert.Len(t, covered, len(cycles)-1)
+}
@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// seriesKey identifies a series by metric name, type and its full tag set.
+func seriesKey(s datadogV2.MetricSeries) string {
+	tags := make([]string, 0, len(s.Resources)+len(s.Tags))
+	for _, r := range s.Resources {
+		tags = append(tags, r.GetType()+"="+r.GetName())
+	}
+	tags = append(tags, s.Tags...)
+	sort.Strings(tags)
+	return s.Metric + "|" + string(s.GetType()) + "|" + strings.Join(tags, ",")
+}
+
+// dedupSeries merges series sharing the same metric name and tag set and collapses points
+// sharing a timestamp, keeping the last value seen. Points of a merged series are sorted by
+// timestamp; the order of series is preserved by first appearance.
+func dedupSeries(series []datadogV2.MetricSeries) []datadogV2.MetricSeries {
+	index := map[string]int{}
+	merged := []datadogV2.MetricSeries{}
+	points := []map[int64]*float64{}
+
+	for _, s := range series {
+		key := seriesKey(s)
+		i, ok := index[key]
+		if !ok {
+			i = len(merged)
+			index[key] = i
+			merged = append(merged, s)
+			points = append(points, map[int64]*float64{})
+		}
+		for _, p := range s.Points {
+			if p.Timestamp != nil {
+				points[i][*p.Timestamp] = p.Value
+			}
+		}
+	}
+
+	for i := range merged {
+		timestamps := make([]int64, 0, len(points[i]))
+		for ts := range points[i] {
+			timestamps = append(timestamps, ts)
+		}
+		sort.Slice(timestamps, func(a, b int) bool { return timestamps[a] < timestamps[b] })
+
+		deduped := make([]datadogV2.MetricPoint, len(timestamps))
+		for j, ts := range timestamps {
+			ts := ts
+			deduped[j] = datadogV2.MetricPoint{Timestamp: &ts, Value: points[i][ts]}
+		}
+		merged[i].Points = deduped
+	}
+	return merged
+}
+
+// orderPoints sorts the points of every series by timestamp and collapses points sharing a
+// timestamp, keeping the last one like dedupSeries, so that timestamps strictly increase as
+// Datadog expects. It returns the number of points dropped.
+func orderPoints(series []datadogV2.MetricSeries) int {
+	dropped := 0
+	for i := range series {
+		points := series[i].Points
+		if strictlyIncreasing(points) {
+			continue
+		}
+		sort.SliceStable(points, func(a, b int) bool { return points[a].GetTimestamp() < points[b].GetTimestamp() })
+		kept := points[:0]
+		for _, p := range points {
+			if n := len(kept); n > 0 && kept[n-1].GetTimestamp() == p.GetTimestamp() {
+				kept[n-1] = p
+				dropped++
+				continue
+			}
+			kept = append(kept, p)
+		}
+		series[i].Points = kept
+	}
+	return dropped
+}
+
+func strictlyIncreasing(points []datadogV2.MetricPoint) bool {
+	for j := 1; j < len(points); j++ {
+		if points[j].GetTimestamp() <= points[j-1].GetTimestamp() {
+			return false
+		}
+	}
+	return true
+}
+
+// countPoints returns the number of points of series.
+func countPoints(series []datadogV2.MetricSeries) int {
+	n := 0
+	for _, s := range series {
+		n += len(s.Points)
+	}
+	return n
+}
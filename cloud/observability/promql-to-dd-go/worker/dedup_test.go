@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupSeries(t *testing.T) {
+	resources := func(ns string) []datadogV2.MetricResource {
+		return []datadogV2.MetricResource{
+			{Type: Ptr("operation"), Name: Ptr("StartWorkflowExecution")},
+			{Type: Ptr("temporal_namespace"), Name: Ptr(ns)},
+		}
+	}
+	series := []datadogV2.MetricSeries{
+		{
+			Metric:    "latency_P99",
+			Type:      datadogV2.METRICINTAKETYPE_GAUGE.Ptr(),
+			Resources: resources("disneyland"),
+			Points: []datadogV2.MetricPoint{
+				{Timestamp: Ptr(int64(120)), Value: Ptr(2.0)},
+				{Timestamp: Ptr(int64(60)), Value: Ptr(1.0)},
+			},
+		},
+		{
+			// Same series from the overlapping part of the window, resources in another order.
+			Metric:    "latency_P99",
+			Type:      datadogV2.METRICINTAKETYPE_GAUGE.Ptr(),
+			Resources: []datadogV2.MetricResource{resources("disneyland")[1], resources("disneyland")[0]},
+			Points: []datadogV2.MetricPoint{
+				{Timestamp: Ptr(int64(120)), Value: Ptr(2.5)},
+				{Timestamp: Ptr(int64(180)), Value: Ptr(3.0)},
+			},
+		},
+		{
+			Metric:    "latency_P99",
+			Type:      datadogV2.METRICINTAKETYPE_GAUGE.Ptr(),
+			Resources: resources("epcot"),
+			Points:    []datadogV2.MetricPoint{{Timestamp: Ptr(int64(120)), Value: Ptr(9.0)}},
+		},
+	}
+
+	got := dedupSeries(series)
+	require.Len(t, got, 2)
+	assert.Equal(t, []datadogV2.MetricPoint{
+		{Timestamp: Ptr(int64(60)), Value: Ptr(1.0)},
+		{Timestamp: Ptr(int64(120)), Value: Ptr(2.5)},
+		{Timestamp: Ptr(int64(180)), Value: Ptr(3.0)},
+	}, got[0].Points)
+	assert.Equal(t, []datadogV2.MetricPoint{{Timestamp: Ptr(int64(120)), Value: Ptr(9.0)}}, got[1].Points)
+	assert.Len(t, series[0].Points, 2, "input series must not be modified")
+}
+
+func TestOrderPoints(t *testing.T) {
+	point := func(ts int64, v float64) datadogV2.MetricPoint {
+		return datadogV2.MetricPoint{Timestamp: Ptr(ts), Value: Ptr(v)}
+	}
+	series := []datadogV2.MetricSeries{
+		{Metric: "pending_tasks", Points: []datadogV2.MetricPoint{
+			point(180, 3), point(60, 1), point(120, 2), point(60, 1.5), point(240, 4), point(180, 3.5),
+		}},
+		{Metric: "sorted", Points: []datadogV2.MetricPoint{point(60, 1), point(120, 2)}},
+		{Metric: "empty"},
+	}
+
+	assert.Equal(t, 2, orderPoints(series))
+	timestamps, values := []int64{}, []float64{}
+	for _, p := range series[0].Points {
+		timestamps = append(timestamps, p.GetTimestamp())
+		values = append(values, p.GetValue())
+	}
+	assert.Equal(t, []int64{60, 120, 180, 240}, timestamps, "timestamps strictly increase")
+	assert.Equal(t, []float64{1.5, 2, 3.5, 4}, values, "the last point of a timestamp wins")
+	assert.Len(t, series[1].Points, 2)
+	assert.Empty(t, series[2].Points)
+}
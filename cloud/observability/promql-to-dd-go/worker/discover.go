@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Discover lists the metrics of every source with the classification used by the cycles,
+// without querying or submitting anything, and writes them to out.
+func (w *Worker) Discover(ctx context.Context, out io.Writer) error {
+	for _, source := range w.sources() {
+		metrics, err := source.ListMetrics(ctx, source.MetricPrefix)
+		if err != nil {
+			return fmt.Errorf("source %s: %w", source.name(), err)
+		}
+
+		fmt.Fprintf(out, "Source %q, prefix %q\n", source.name(), source.MetricPrefix)
+		for _, group := range []struct {
+			kind  string
+			names []string
+		}{
+			{"histograms", metrics.Histograms},
+			{"counters", metrics.Counters},
+			{"gauges", metrics.Gauges},
+			{"summaries", metrics.Summaries},
+		} {
+			fmt.Fprintf(out, "  %s (%d)\n", group.kind, len(group.names))
+			for _, name := range group.names {
+				fmt.Fprintf(out, "    %s\n", name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerDiscover(t *testing.T) {
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(_ context.Context, prefix string) (prometheus.MetricNames, error) {
+				assert.Equal(t, "temporal_cloud_v0_", prefix)
+				return prometheus.ClassifyMetrics([]string{
+					"temporal_cloud_v0_service_latency_bucket",
+					"temporal_cloud_v0_frontend_service_request_count",
+					"temporal_cloud_v0_pending_tasks",
+				}), nil
+			},
+		},
+		MetricPrefix: "temporal_cloud_v0_",
+	}
+
+	var out strings.Builder
+	require.NoError(t, w.Discover(context.Background(), &out))
+	assert.Equal(t, `Source "temporal_cloud_v0_", prefix "temporal_cloud_v0_"
+  histograms (1)
+    temporal_cloud_v0_service_latency_bucket
+  counters (1)
+    temporal_cloud_v0_frontend_service_request_count
+  gauges (1)
+    temporal_cloud_v0_pending_tasks
+  summaries (0)
+`, out.String())
+}
+
+func TestWorkerDiscoverError(t *testing.T) {
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{}, errors.New("prometheus unavailable")
+			},
+		},
+	}
+	assert.ErrorContains(t, w.Discover(context.Background(), &strings.Builder{}), "prometheus unavailable")
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// flush submits series. When ctx is cancelled before or during the submission and
+// DrainTimeout is set, the series are submitted once more, detached from ctx and bounded by
+// DrainTimeout, so that a shutdown does not lose the series of a cycle already converted.
+func (w *Worker) flush(ctx context.Context, series []datadogV2.MetricSeries) error {
+	if ctx.Err() == nil || w.DrainTimeout <= 0 {
+		err := w.submit(ctx, series)
+		if err == nil || ctx.Err() == nil || w.DrainTimeout <= 0 {
+			return err
+		}
+	}
+
+	w.logger().Info("Draining converted series before stopping", "count", len(series), "timeout", w.DrainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.DrainTimeout)
+	defer cancel()
+	return w.submit(drainCtx, series)
+}
+
+// awaitDrain waits for the cycle in flight to report on errs, at most DrainTimeout.
+func (w *Worker) awaitDrain(errs <-chan error) {
+	if w.DrainTimeout <= 0 {
+		return
+	}
+	select {
+	case <-errs:
+	case <-time.After(w.DrainTimeout):
+		w.logger().Warn("Cycle did not drain in time", "timeout", w.DrainTimeout)
+	}
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func gaugeQuerier(gauge string) *fakeQuerier {
+	return &fakeQuerier{
+		listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+			return prometheus.MetricNames{Gauges: []string{gauge}}, nil
+		},
+		queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+			return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+		},
+	}
+}
+
+// drainSubmitter records the series submitted with a live context.
+type drainSubmitter struct {
+	mu        sync.Mutex
+	calls     int
+	submitted []string
+	submit    func(ctx context.Context, call int) error
+}
+
+func (s *drainSubmitter) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	s.mu.Lock()
+	s.calls++
+	call := s.calls
+	s.mu.Unlock()
+	if s.submit != nil {
+		if err := s.submit(ctx, call); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ser := range series {
+		s.submitted = append(s.submitted, ser.Metric)
+	}
+	return nil
+}
+
+func TestWorkerDrainsOnShutdown(t *testing.T) {
+	t.Run("shutdown after conversion", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		submitter := &drainSubmitter{}
+		stopping := gaugeQuerier("unused")
+		stopping.listMetrics = func(context.Context, string) (prometheus.MetricNames, error) {
+			// The interrupt arrives once the first source was converted.
+			cancel()
+			return prometheus.MetricNames{}, context.Canceled
+		}
+		w := &Worker{
+			Sources: []Source{
+				{Querier: gaugeQuerier("pending_tasks"), MetricPrefix: "a_"},
+				{Querier: stopping, MetricPrefix: "b_"},
+			},
+			Submitter:     submitter,
+			StepDuration:  time.Minute,
+			QueryInterval: 10 * time.Minute,
+			SleepDuration: time.Hour,
+			DrainTimeout:  time.Second,
+		}
+
+		require.NoError(t, w.Run(ctx))
+		assert.Equal(t, []string{"pending_tasks"}, submitter.submitted, "the converted series are flushed before Run returns")
+	})
+
+	t.Run("shutdown during submission", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		submitter := &drainSubmitter{submit: func(_ context.Context, call int) error {
+			if call == 1 {
+				cancel()
+				return context.Canceled
+			}
+			return nil
+		}}
+		w := &Worker{
+			Querier:       gaugeQuerier("pending_tasks"),
+			Submitter:     submitter,
+			StepDuration:  time.Minute,
+			QueryInterval: 10 * time.Minute,
+			SleepDuration: time.Hour,
+			DrainTimeout:  time.Second,
+		}
+
+		require.NoError(t, w.Run(ctx))
+		assert.Equal(t, 2, submitter.calls)
+		assert.Equal(t, []string{"pending_tasks"}, submitter.submitted)
+	})
+
+	t.Run("bounded by the drain timeout", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		submitter := &drainSubmitter{submit: func(ctx context.Context, call int) error {
+			if call == 1 {
+				cancel()
+				return context.Canceled
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}}
+		w := &Worker{
+			Querier:       gaugeQuerier("pending_tasks"),
+			Submitter:     submitter,
+			StepDuration:  time.Minute,
+			QueryInterval: 10 * time.Minute,
+			SleepDuration: time.Hour,
+			DrainTimeout:  50 * time.Millisecond,
+		}
+
+		start := time.Now()
+		require.NoError(t, w.Run(ctx))
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Empty(t, submitter.submitted)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		submitter := &drainSubmitter{submit: func(context.Context, int) error {
+			cancel()
+			return context.Canceled
+		}}
+		w := &Worker{
+			Querier:       gaugeQuerier("pending_tasks"),
+			Submitter:     submitter,
+			StepDuration:  time.Minute,
+			QueryInterval: 10 * time.Minute,
+		}
+
+		_, err := w.Reconcile(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, submitter.calls)
+	})
+}
@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultEmptyQueryCycles is used when EmptyQueryCycles is not set.
+const DefaultEmptyQueryCycles = 3
+
+// emptyMetrics counts, per source and discovered metric, the consecutive cycles in which every
+// query of the metric succeeded without returning a single series. It is safe for concurrent
+// use.
+type emptyMetrics struct {
+	mu     sync.Mutex
+	cycles map[string]map[string]int
+}
+
+// record updates the counts of source with the stats of a cycle. It returns the metrics that
+// just reached threshold empty cycles, the ones that returned series again after reaching it,
+// and the number of metrics at or above threshold. Metrics whose queries all failed keep their
+// count; metrics no longer queried are forgotten.
+func (e *emptyMetrics) record(source string, stats []QueryStats, threshold int) (reached, recovered []string, empty int) {
+	queried := map[string]bool{}
+	returned := map[string]bool{}
+	for _, st := range stats {
+		if st.Err != nil {
+			continue
+		}
+		queried[st.Metric] = true
+		if st.Series > 0 {
+			returned[st.Metric] = true
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cycles == nil {
+		e.cycles = map[string]map[string]int{}
+	}
+	prev := e.cycles[source]
+	next := map[string]int{}
+	for metric := range queried {
+		if returned[metric] {
+			if prev[metric] >= threshold {
+				recovered = append(recovered, metric)
+			}
+			continue
+		}
+		next[metric] = prev[metric] + 1
+		if next[metric] == threshold {
+			reached = append(reached, metric)
+		}
+	}
+	for _, st := range stats {
+		if n, ok := prev[st.Metric]; ok && !queried[st.Metric] {
+			next[st.Metric] = n
+		}
+	}
+	for _, n := range next {
+		if n >= threshold {
+			empty++
+		}
+	}
+	e.cycles[source] = next
+	sort.Strings(reached)
+	sort.Strings(recovered)
+	return reached, recovered, empty
+}
+
+func (w *Worker) emptyQueryCycles() int {
+	if w.EmptyQueryCycles <= 0 {
+		return DefaultEmptyQueryCycles
+	}
+	return w.EmptyQueryCycles
+}
+
+// trackEmptyMetrics warns about the discovered metrics of source whose queries returned no
+// series for EmptyQueryCycles cycles in a row, usually a broken query template, a filter
+// excluding everything or a renamed metric, and returns how many there currently are.
+func (w *Worker) trackEmptyMetrics(source Source, stats []QueryStats) int {
+	threshold := w.emptyQueryCycles()
+	reached, recovered, empty := w.empty.record(source.name(), stats, threshold)
+	for _, metric := range reached {
+		w.logger().Warn("Metric returned no series for consecutive cycles, check its query template and filters or whether it was renamed",
+			"source", source.name(), "metric", metric, "cycles", threshold)
+	}
+	for _, metric := range recovered {
+		w.logger().Info("Metric returns series again", "source", source.name(), "metric", metric)
+	}
+	return empty
+}
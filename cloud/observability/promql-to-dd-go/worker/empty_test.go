@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerEmptyQueryMetrics(t *testing.T) {
+	renamed := false
+	registry := promclient.NewRegistry()
+	var logs bytes.Buffer
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks", "replication_lag"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				if promql == "replication_lag" && !renamed {
+					return model.Matrix{}, nil
+				}
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter:        &fakeSubmitter{submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil }},
+		StepDuration:     time.Minute,
+		QueryInterval:    10 * time.Minute,
+		EmptyQueryCycles: 2,
+		Metrics:          NewMetrics(registry),
+		Logger:           slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	gauge := func() string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	require.NoError(t, w.RunOnce(context.Background()))
+	assert.Contains(t, gauge(), `exporter_empty_query_metrics{source=""} 0`)
+	assert.NotContains(t, logs.String(), "Metric returned no series")
+
+	require.NoError(t, w.RunOnce(context.Background()))
+	assert.Contains(t, gauge(), `exporter_empty_query_metrics{source=""} 1`)
+	assert.Contains(t, logs.String(), "Metric returned no series")
+	assert.Contains(t, logs.String(), "metric=replication_lag")
+	assert.NotContains(t, logs.String(), "metric=pending_tasks")
+
+	renamed = true
+	require.NoError(t, w.RunOnce(context.Background()))
+	assert.Contains(t, gauge(), `exporter_empty_query_metrics{source=""} 0`)
+	assert.Contains(t, logs.String(), "Metric returns series again")
+}
+
+func TestEmptyMetricsRecord(t *testing.T) {
+	var e emptyMetrics
+	empty := []QueryStats{{Metric: "latency_bucket"}, {Metric: "latency_bucket"}}
+	partial := []QueryStats{{Metric: "latency_bucket"}, {Metric: "latency_bucket", Series: 3}}
+	failed := []QueryStats{{Metric: "latency_bucket", Err: errors.New("timeout")}}
+
+	reached, _, n := e.record("cloud", empty, 2)
+	assert.Empty(t, reached)
+	assert.Equal(t, 0, n)
+	_, _, n = e.record("cloud", failed, 2)
+	assert.Equal(t, 0, n, "failed queries neither count as empty nor reset the count")
+	reached, _, n = e.record("cloud", empty, 2)
+	assert.Equal(t, []string{"latency_bucket"}, reached)
+	assert.Equal(t, 1, n)
+	reached, _, n = e.record("cloud", empty, 2)
+	assert.Empty(t, reached, "a metric is reported once when it reaches the threshold")
+	assert.Equal(t, 1, n)
+	_, _, n = e.record("other", empty, 2)
+	assert.Equal(t, 0, n, "sources are tracked separately")
+
+	_, recovered, n := e.record("cloud", partial, 2)
+	assert.Equal(t, []string{"latency_bucket"}, recovered, "a single query with series is enough")
+	assert.Equal(t, 0, n)
+	_, _, n = e.record("cloud", nil, 2)
+	assert.Equal(t, 0, n)
+}
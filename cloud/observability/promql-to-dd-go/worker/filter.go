@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// NamespaceLabel is the label NamespaceAllow and NamespaceDeny match against.
+	NamespaceLabel = "temporal_namespace"
+	// OperationLabel is the label OperationFilter matches against.
+	OperationLabel = "operation"
+)
+
+// ValidatePatterns checks that every pattern is a valid regular expression. Patterns are
+// anchored by Prometheus, so "prod-.*" matches namespaces starting with "prod-".
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// labelMatchers returns the label matchers injected into every query. With both
+// NamespaceAllow and NamespaceDeny set, a namespace must match an allow pattern and no deny
+// pattern, so deny takes precedence. OperationFilter combines with the namespace matchers,
+// a series has to pass all of them.
+func (w *Worker) labelMatchers() []string {
+	matchers := []string{}
+	if len(w.NamespaceAllow) > 0 {
+		matchers = append(matchers, regexMatcher(NamespaceLabel, "=~", w.NamespaceAllow))
+	}
+	if len(w.NamespaceDeny) > 0 {
+		matchers = append(matchers, regexMatcher(NamespaceLabel, "!~", w.NamespaceDeny))
+	}
+	if len(w.OperationFilter) > 0 {
+		matchers = append(matchers, regexMatcher(OperationLabel, "!~", w.OperationFilter))
+	}
+	return matchers
+}
+
+func regexMatcher(label, op string, patterns []string) string {
+	return fmt.Sprintf("%s%s%q", label, op, strings.Join(patterns, "|"))
+}
+
+// selector returns the series selector for name with the label matchers applied.
+func (w *Worker) selector(name string) string {
+	matchers := w.labelMatchers()
+	if len(matchers) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(matchers, ",") + "}"
+}
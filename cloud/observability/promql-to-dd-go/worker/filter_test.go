@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerNamespaceFilter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		allow         []string
+		deny          []string
+		wantHistogram string
+		wantRate      string
+		wantSelector  string
+	}{
+		{
+			name:          "no filter",
+			wantHistogram: "histogram_quantile(0.99, sum(rate(latency_bucket[1m])) by (temporal_namespace,operation,le))",
+			wantRate:      "rate(requests_count[1m])",
+			wantSelector:  "pending_tasks",
+		},
+		{
+			name:          "allow",
+			allow:         []string{"prod-a", "prod-b"},
+			wantHistogram: `histogram_quantile(0.99, sum(rate(latency_bucket{temporal_namespace=~"prod-a|prod-b"}[1m])) by (temporal_namespace,operation,le))`,
+			wantRate:      `rate(requests_count{temporal_namespace=~"prod-a|prod-b"}[1m])`,
+			wantSelector:  `pending_tasks{temporal_namespace=~"prod-a|prod-b"}`,
+		},
+		{
+			name:          "deny with regex",
+			deny:          []string{`load-test\..*`},
+			wantHistogram: `histogram_quantile(0.99, sum(rate(latency_bucket{temporal_namespace!~"load-test\\..*"}[1m])) by (temporal_namespace,operation,le))`,
+			wantRate:      `rate(requests_count{temporal_namespace!~"load-test\\..*"}[1m])`,
+			wantSelector:  `pending_tasks{temporal_namespace!~"load-test\\..*"}`,
+		},
+		{
+			name:          "deny takes precedence over allow",
+			allow:         []string{"prod-.*"},
+			deny:          []string{"prod-noisy"},
+			wantHistogram: `histogram_quantile(0.99, sum(rate(latency_bucket{temporal_namespace=~"prod-.*",temporal_namespace!~"prod-noisy"}[1m])) by (temporal_namespace,operation,le))`,
+			wantRate:      `rate(requests_count{temporal_namespace=~"prod-.*",temporal_namespace!~"prod-noisy"}[1m])`,
+			wantSelector:  `pending_tasks{temporal_namespace=~"prod-.*",temporal_namespace!~"prod-noisy"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			w := Worker{NamespaceAllow: tc.allow, NamespaceDeny: tc.deny}
+			assert.Equal(t, tc.wantHistogram, w.histogramPromQL(0.99, "latency_bucket"))
+			assert.Equal(t, tc.wantRate, w.ratePromQL("requests_count"))
+			assert.Equal(t, tc.wantSelector, w.selector("pending_tasks"))
+		})
+	}
+}
+
+func TestWorkerOperationFilter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		allow         []string
+		operations    []string
+		wantHistogram string
+		wantRate      string
+	}{
+		{
+			name:          "operations only",
+			operations:    []string{"PollWorkflowTaskQueue", "PollActivityTaskQueue"},
+			wantHistogram: `histogram_quantile(0.99, sum(rate(latency_bucket{operation!~"PollWorkflowTaskQueue|PollActivityTaskQueue"}[1m])) by (temporal_namespace,operation,le))`,
+			wantRate:      `rate(requests_count{operation!~"PollWorkflowTaskQueue|PollActivityTaskQueue"}[1m])`,
+		},
+		{
+			name:          "combined with namespace",
+			allow:         []string{"prod-.*"},
+			operations:    []string{"Poll.*"},
+			wantHistogram: `histogram_quantile(0.99, sum(rate(latency_bucket{temporal_namespace=~"prod-.*",operation!~"Poll.*"}[1m])) by (temporal_namespace,operation,le))`,
+			wantRate:      `rate(requests_count{temporal_namespace=~"prod-.*",operation!~"Poll.*"}[1m])`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			w := Worker{NamespaceAllow: tc.allow, OperationFilter: tc.operations}
+			assert.Equal(t, tc.wantHistogram, w.histogramPromQL(0.99, "latency_bucket"))
+			assert.Equal(t, tc.wantRate, w.ratePromQL("requests_count"))
+		})
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	assert.NoError(t, ValidatePatterns([]string{"prod-.*", "staging"}))
+	assert.ErrorContains(t, ValidatePatterns([]string{"prod-("}), `invalid pattern "prod-("`)
+}
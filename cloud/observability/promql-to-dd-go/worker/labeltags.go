@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// maxTagLength is the length, in characters, Datadog truncates tags to.
+const maxTagLength = 200
+
+// sanitizeTagPart applies Datadog's tag rules to a key or value: lowercase, with every
+// character other than letters, digits and _-./: replaced by an underscore.
+func sanitizeTagPart(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-./:", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// labelTag converts a label to a key:value tag. Tags must start with a letter, so leading
+// characters of the key that are not are dropped; ok is false when nothing is left. A colon
+// in the key would move the key:value split, so it is replaced by an underscore, and the tag
+// is truncated to maxTagLength characters, never inside a multi-byte character.
+func labelTag(key, value string) (tag string, ok bool) {
+	key = strings.ReplaceAll(sanitizeTagPart(key), ":", "_")
+	key = strings.TrimLeftFunc(key, func(r rune) bool { return !unicode.IsLetter(r) })
+	if key == "" {
+		return "", false
+	}
+	tag = key + ":" + sanitizeTagPart(value)
+	chars := 0
+	for i := range tag {
+		if chars == maxTagLength {
+			return tag[:i], true
+		}
+		chars++
+	}
+	return tag, true
+}
+
+// labelsAsTags adds a tag for every label of the series, carried as resources, in place.
+func labelsAsTags(series []datadogV2.MetricSeries) {
+	for i := range series {
+		for _, r := range series[i].Resources {
+			if r.Type == nil || r.Name == nil {
+				continue
+			}
+			if tag, ok := labelTag(*r.Type, *r.Name); ok {
+				series[i].Tags = append(series[i].Tags, tag)
+			}
+		}
+	}
+}
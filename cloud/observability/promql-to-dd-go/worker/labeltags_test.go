@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestLabelTag(t *testing.T) {
+	testCases := []struct {
+		key, value string
+		want       string
+		wantOK     bool
+	}{
+		{key: "temporal_namespace", value: "disneyland.a1b2c", want: "temporal_namespace:disneyland.a1b2c", wantOK: true},
+		{key: "Operation", value: "StartWorkflowExecution", want: "operation:startworkflowexecution", wantOK: true},
+		{key: "region", value: "us east #1", want: "region:us_east__1", wantOK: true},
+		{key: "path", value: "/api/v1:query", want: "path:/api/v1:query", wantOK: true},
+		{key: "_9le", value: "0.5", want: "le:0.5", wantOK: true},
+		{key: "__42", value: "x"},
+		{key: "scope:name", value: "x", want: "scope_name:x", wantOK: true},
+		{key: ":scope", value: "x", want: "scope:x", wantOK: true},
+	}
+
+	for _, tc := range testCases {
+		got, ok := labelTag(tc.key, tc.value)
+		assert.Equal(t, tc.wantOK, ok, tc.key)
+		assert.Equal(t, tc.want, got, tc.key)
+	}
+
+	long, ok := labelTag("key", strings.Repeat("v", 300))
+	require.True(t, ok)
+	assert.Len(t, long, maxTagLength)
+
+	multibyte, ok := labelTag("key", strings.Repeat("é", 300))
+	require.True(t, ok)
+	assert.True(t, utf8.ValidString(multibyte), "truncation must not split a character")
+	assert.Equal(t, maxTagLength, utf8.RuneCountInString(multibyte))
+	assert.Equal(t, "key:"+strings.Repeat("é", maxTagLength-4), multibyte)
+}
+
+func TestWorkerAllLabelsAsTags(t *testing.T) {
+	var submitted []datadogV2.MetricSeries
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{
+					"temporal_namespace": "disneyland",
+					"task_queue":         "Payments Queue",
+					"region":             "aws-us-east-1",
+				}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration:    time.Minute,
+		QueryInterval:   10 * time.Minute,
+		AllLabelsAsTags: true,
+	}
+
+	require.NoError(t, w.RunOnce(context.Background()))
+	require.Len(t, submitted, 1)
+	assert.ElementsMatch(t, []string{
+		"temporal_namespace:disneyland",
+		"task_queue:payments_queue",
+		"region:aws-us-east-1",
+	}, submitted[0].Tags)
+	assert.Len(t, submitted[0].Resources, 3, "resources are kept")
+}
@@ -0,0 +1,184 @@
+package worker
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons of exporter_points_dropped_total.
+const (
+	// dropReasonNaN counts NaN and ±Inf samples skipped by NonFiniteSkip.
+	dropReasonNaN = "nan"
+	// dropReasonCardinality counts the points of series removed by CardinalityDrop.
+	dropReasonCardinality = "cardinality"
+	// dropReasonDedup counts the points collapsed by Deduplicate.
+	dropReasonDedup = "dedup"
+	// dropReasonDuplicate counts the points of a series sharing a timestamp with a later one.
+	dropReasonDuplicate = "duplicate"
+	// dropReasonPointLimit counts the points beyond MaxPointsPerCycle.
+	dropReasonPointLimit = "point_limit"
+	// dropReasonAge counts the samples older than MaxSampleAge.
+	dropReasonAge = "age"
+)
+
+// Metrics instruments the worker itself. A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	queries         *prometheus.CounterVec
+	queryRetries    *prometheus.CounterVec
+	seriesSubmitted *prometheus.CounterVec
+	submitErrors    prometheus.Counter
+	pointsDropped   *prometheus.CounterVec
+	cycleDuration   prometheus.Histogram
+	breakerState    prometheus.Gauge
+	lastSuccess     prometheus.Gauge
+	highCardinality *prometheus.GaugeVec
+	emptyQuery      *prometheus.GaugeVec
+	paused          prometheus.Gauge
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exporter_queries_total",
+			Help: "Number of Prometheus queries issued, by series kind.",
+		}, []string{"kind"}),
+		queryRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exporter_query_retries_total",
+			Help: "Number of Prometheus queries repeated after a transient failure, by series kind.",
+		}, []string{"kind"}),
+		seriesSubmitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exporter_series_submitted_total",
+			Help: "Number of series successfully submitted, by series kind.",
+		}, []string{"kind"}),
+		submitErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_submit_errors_total",
+			Help: "Number of failed submissions.",
+		}),
+		pointsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "exporter_points_dropped_total",
+			Help: "Number of points dropped before submission, by reason: nan, age, cardinality, dedup, duplicate or point_limit.",
+		}, []string{"reason"}),
+		cycleDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "exporter_cycle_duration_seconds",
+			Help:    "Duration of a full query-and-submit cycle.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+		}),
+		breakerState: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_circuit_breaker_state",
+			Help: "State of the submission circuit breaker: 0 closed, 1 open, 2 half-open.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful submission.",
+		}),
+		highCardinality: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "exporter_high_cardinality_metrics",
+			Help: "Number of metrics exceeding the series per metric limit in the last cycle, by source.",
+		}, []string{"source"}),
+		emptyQuery: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "exporter_empty_query_metrics",
+			Help: "Number of discovered metrics whose queries returned no series for several cycles in a row, by source.",
+		}, []string{"source"}),
+		paused: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_submission_paused",
+			Help: "Whether submission is paused: 1 paused, 0 running.",
+		}),
+	}
+	reg.MustRegister(m.queries, m.queryRetries, m.seriesSubmitted, m.submitErrors, m.pointsDropped, m.cycleDuration, m.breakerState, m.lastSuccess, m.highCardinality, m.emptyQuery, m.paused)
+	return m
+}
+
+// RegisterBuildInfo registers the exporter_build_info gauge, always 1, labelled with the
+// version and commit the binary was built from and the Go version it was built with.
+func RegisterBuildInfo(reg prometheus.Registerer, version, commit string) {
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "exporter_build_info",
+		Help:        "Build information of the exporter, always 1.",
+		ConstLabels: prometheus.Labels{"version": version, "commit": commit, "go_version": runtime.Version()},
+	})
+	info.Set(1)
+	reg.MustRegister(info)
+}
+
+func (m *Metrics) incQueries(kind string) {
+	if m == nil {
+		return
+	}
+	m.queries.WithLabelValues(kind).Inc()
+}
+
+func (m *Metrics) incQueryRetries(kind string) {
+	if m == nil {
+		return
+	}
+	m.queryRetries.WithLabelValues(kind).Inc()
+}
+
+func (m *Metrics) addSeriesSubmitted(kind string, n int) {
+	if m == nil {
+		return
+	}
+	m.seriesSubmitted.WithLabelValues(kind).Add(float64(n))
+}
+
+func (m *Metrics) incSubmitErrors() {
+	if m == nil {
+		return
+	}
+	m.submitErrors.Inc()
+}
+
+func (m *Metrics) addPointsDropped(reason string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.pointsDropped.WithLabelValues(reason).Add(float64(n))
+}
+
+func (m *Metrics) observeCycleDuration(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.cycleDuration.Observe(d.Seconds())
+}
+
+func (m *Metrics) setBreakerState(state breakerState) {
+	if m == nil {
+		return
+	}
+	m.breakerState.Set(float64(state))
+}
+
+func (m *Metrics) setLastSuccess(t time.Time) {
+	if m == nil {
+		return
+	}
+	m.lastSuccess.Set(float64(t.UnixNano()) / 1e9)
+}
+
+func (m *Metrics) setHighCardinality(source string, n int) {
+	if m == nil {
+		return
+	}
+	m.highCardinality.WithLabelValues(source).Set(float64(n))
+}
+
+func (m *Metrics) setEmptyQueryMetrics(source string, n int) {
+	if m == nil {
+		return
+	}
+	m.emptyQuery.WithLabelValues(source).Set(float64(n))
+}
+
+func (m *Metrics) setPaused(paused bool) {
+	if m == nil {
+		return
+	}
+	if paused {
+		m.paused.Set(1)
+		return
+	}
+	m.paused.Set(0)
+}
@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestMetricsPointsDroppedByReason(t *testing.T) {
+	// Two replicas report the same pending_tasks stream, one of them with a NaN sample.
+	labels := model.Metric{"temporal_namespace": "ns-0"}
+	matrix := model.Matrix{
+		&model.SampleStream{Metric: labels, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 2}}},
+		&model.SampleStream{Metric: labels, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 2}, {Timestamp: 180_000, Value: model.SampleValue(math.NaN())}}},
+	}
+	registry := promclient.NewRegistry()
+	var submitted []datadogV2.MetricSeries
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return matrix, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		Deduplicate:   true,
+		Metrics:       NewMetrics(registry),
+	}
+	require.NoError(t, w.RunOnce(context.Background()))
+	require.Len(t, submitted, 1)
+	assert.Len(t, submitted[0].Points, 2)
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `exporter_points_dropped_total{reason="nan"} 1`)
+	assert.Contains(t, rec.Body.String(), `exporter_points_dropped_total{reason="dedup"} 2`)
+	assert.NotContains(t, rec.Body.String(), `reason="cardinality"`)
+}
+
+func TestWorkerSubmitsMonotonicPoints(t *testing.T) {
+	// A stream returned out of order with a repeated timestamp, as overlapping sub-queries may.
+	matrix := model.Matrix{&model.SampleStream{Metric: model.Metric{"temporal_namespace": "ns-0"}, Values: []model.SamplePair{
+		{Timestamp: 180_000, Value: 3}, {Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 2}, {Timestamp: 120_000, Value: 2.5},
+	}}}
+	registry := promclient.NewRegistry()
+	var submitted []datadogV2.MetricSeries
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return matrix, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration: time.Minute,
+		Metrics:      NewMetrics(registry),
+	}
+	require.NoError(t, w.RunOnce(context.Background()))
+	require.Len(t, submitted, 1)
+	timestamps := []int64{}
+	for _, p := range submitted[0].Points {
+		timestamps = append(timestamps, p.GetTimestamp())
+	}
+	assert.Equal(t, []int64{60, 120, 180}, timestamps)
+	assert.Equal(t, 2.5, submitted[0].Points[1].GetValue())
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `exporter_points_dropped_total{reason="duplicate"} 1`)
+}
+
+func TestRegisterBuildInfo(t *testing.T) {
+	registry := promclient.NewRegistry()
+	RegisterBuildInfo(registry, "1.2.3", "abc1234")
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, "exporter_build_info", families[0].GetName())
+	require.Len(t, families[0].GetMetric(), 1)
+	metric := families[0].GetMetric()[0]
+	labels := map[string]string{}
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	assert.Equal(t, map[string]string{"version": "1.2.3", "commit": "abc1234", "go_version": runtime.Version()}, labels)
+	assert.Equal(t, 1.0, metric.GetGauge().GetValue())
+}
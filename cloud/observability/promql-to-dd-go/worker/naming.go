@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// NameTransform rewrites the Datadog metric names produced by the converters, for example to
+// map temporal_cloud_v0_ onto a temporal. namespace. StripPrefix is removed first, then
+// Pattern is replaced with Replacement, then AddPrefix is prepended. The zero value keeps
+// names unchanged.
+type NameTransform struct {
+	StripPrefix string
+	Pattern     *regexp.Regexp
+	Replacement string
+	AddPrefix   string
+	// OriginalNameTag, when set, tags every renamed series with its original name under
+	// this key.
+	OriginalNameTag string
+}
+
+// NewNameTransform compiles pattern, which may be empty, into a NameTransform.
+func NewNameTransform(stripPrefix, addPrefix, pattern, replacement, originalNameTag string) (NameTransform, error) {
+	t := NameTransform{
+		StripPrefix:     stripPrefix,
+		Replacement:     replacement,
+		AddPrefix:       addPrefix,
+		OriginalNameTag: originalNameTag,
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return NameTransform{}, fmt.Errorf("invalid metric name pattern %q: %w", pattern, err)
+		}
+		t.Pattern = re
+	}
+	return t, nil
+}
+
+func (t NameTransform) Apply(name string) string {
+	name = strings.TrimPrefix(name, t.StripPrefix)
+	if t.Pattern != nil {
+		name = t.Pattern.ReplaceAllString(name, t.Replacement)
+	}
+	return t.AddPrefix + name
+}
+
+// applySeries renames series in place.
+func (t NameTransform) applySeries(series []datadogV2.MetricSeries) {
+	for i := range series {
+		original := series[i].Metric
+		series[i].Metric = t.Apply(original)
+		if t.OriginalNameTag != "" && series[i].Metric != original {
+			series[i].Tags = append(series[i].Tags, t.OriginalNameTag+":"+original)
+		}
+	}
+}
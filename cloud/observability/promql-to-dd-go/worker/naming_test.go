@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameTransform(t *testing.T) {
+	testCases := []struct {
+		name      string
+		transform NameTransform
+		want      string
+	}{
+		{
+			name: "unchanged",
+			want: "temporal_cloud_v0_service_latency_P99",
+		},
+		{
+			name:      "strip",
+			transform: NameTransform{StripPrefix: "temporal_cloud_v0_"},
+			want:      "service_latency_P99",
+		},
+		{
+			name:      "add",
+			transform: NameTransform{AddPrefix: "acme."},
+			want:      "acme.temporal_cloud_v0_service_latency_P99",
+		},
+		{
+			name:      "strip and add",
+			transform: NameTransform{StripPrefix: "temporal_cloud_v0_", AddPrefix: "temporal."},
+			want:      "temporal.service_latency_P99",
+		},
+		{
+			name:      "regex",
+			transform: NameTransform{Pattern: regexp.MustCompile(`^temporal_cloud_v(\d+)_`), Replacement: "temporal.v$1."},
+			want:      "temporal.v0.service_latency_P99",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, tc.transform.Apply("temporal_cloud_v0_service_latency_P99"))
+		})
+	}
+}
+
+func TestNameTransformOriginalNameTag(t *testing.T) {
+	transform := NameTransform{StripPrefix: "temporal_cloud_v0_", AddPrefix: "temporal.", OriginalNameTag: "prom_name"}
+	series := []datadogV2.MetricSeries{
+		{Metric: "temporal_cloud_v0_pending_tasks"},
+		{Metric: "other_metric", Tags: []string{"env:prod"}},
+	}
+	transform.applySeries(series)
+
+	assert.Equal(t, "temporal.pending_tasks", series[0].Metric)
+	assert.Equal(t, []string{"prom_name:temporal_cloud_v0_pending_tasks"}, series[0].Tags)
+	assert.Equal(t, "temporal.other_metric", series[1].Metric)
+	assert.Equal(t, []string{"env:prod", "prom_name:other_metric"}, series[1].Tags)
+}
+
+func TestNewNameTransform(t *testing.T) {
+	transform, err := NewNameTransform("temporal_cloud_", "temporal.", `^v\d+_`, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "temporal.pending_tasks", transform.Apply("temporal_cloud_v0_pending_tasks"))
+
+	_, err = NewNameTransform("", "", "(", "", "")
+	assert.ErrorContains(t, err, "invalid metric name pattern")
+}
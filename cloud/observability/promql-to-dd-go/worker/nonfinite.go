@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prometheus/common/model"
+)
+
+// NonFinitePolicy controls what happens to NaN and ±Inf samples, which histogram_quantile
+// returns for empty buckets and rate/division queries return for idle series.
+type NonFinitePolicy string
+
+const (
+	// NonFiniteSkip drops the sample. This is the default.
+	NonFiniteSkip NonFinitePolicy = "skip"
+	// NonFiniteZero submits the sample as 0.
+	NonFiniteZero NonFinitePolicy = "zero"
+)
+
+func ParseNonFinitePolicy(s string) (NonFinitePolicy, error) {
+	switch p := NonFinitePolicy(s); p {
+	case "", NonFiniteSkip:
+		return NonFiniteSkip, nil
+	case NonFiniteZero:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown non-finite policy %q, want %q or %q", s, NonFiniteSkip, NonFiniteZero)
+	}
+}
+
+func isFinite(v model.SampleValue) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
+
+// sanitize applies the policy and returns the matrix along with the number of dropped samples.
+// Streams left without a sample are dropped, so that they are not submitted as empty series.
+// The input matrix is not modified.
+func (p NonFinitePolicy) sanitize(matrix model.Matrix) (model.Matrix, int) {
+	dropped := 0
+	out := make(model.Matrix, 0, len(matrix))
+	for _, stream := range matrix {
+		values := make([]model.SamplePair, 0, len(stream.Values))
+		for _, pair := range stream.Values {
+			if !isFinite(pair.Value) {
+				if p != NonFiniteZero {
+					dropped++
+					continue
+				}
+				pair.Value = 0
+			}
+			values = append(values, pair)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		out = append(out, &model.SampleStream{Metric: stream.Metric, Values: values})
+	}
+	return out, dropped
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nonFiniteMatrix() model.Matrix {
+	return model.Matrix{
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland"},
+			Values: []model.SamplePair{
+				{Timestamp: model.TimeFromUnix(60), Value: model.SampleValue(math.NaN())},
+				{Timestamp: model.TimeFromUnix(120), Value: 1.5},
+				{Timestamp: model.TimeFromUnix(180), Value: model.SampleValue(math.Inf(1))},
+				{Timestamp: model.TimeFromUnix(240), Value: model.SampleValue(math.Inf(-1))},
+			},
+		},
+	}
+}
+
+func TestConvertersSkipNonFinite(t *testing.T) {
+	want := []datadogV2.MetricPoint{{Timestamp: Ptr(int64(120)), Value: Ptr(1.5)}}
+	converters := map[string][]datadogV2.MetricSeries{
+		"histogram": PromHistogramToDatadogGauge("latency_bucket", 0.99, nonFiniteMatrix()),
+		"rate":      PromCountToDatadogRate("requests_count", time.Minute, nonFiniteMatrix()),
+	}
+	for name, series := range converters {
+		require.Len(t, series, 1, name)
+		assert.Equal(t, want, series[0].Points, name)
+	}
+
+	counter := nonFiniteMatrix()
+	counter[0].Values = append(counter[0].Values, model.SamplePair{Timestamp: model.TimeFromUnix(300), Value: 4})
+	series := PromCountToDatadogCount("requests_count", counter)
+	require.Len(t, series, 1)
+	assert.Equal(t, []datadogV2.MetricPoint{{Timestamp: Ptr(int64(300)), Value: Ptr(2.5)}}, series[0].Points, "counts skip non-finite samples")
+}
+
+func TestNonFinitePolicy(t *testing.T) {
+	matrix := nonFiniteMatrix()
+
+	skipped, dropped := NonFiniteSkip.sanitize(matrix)
+	assert.Equal(t, 3, dropped)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, []model.SamplePair{{Timestamp: model.TimeFromUnix(120), Value: 1.5}}, skipped[0].Values)
+
+	zeroed, dropped := NonFiniteZero.sanitize(matrix)
+	assert.Equal(t, 0, dropped)
+	require.Len(t, zeroed, 1)
+	assert.Equal(t, []model.SamplePair{
+		{Timestamp: model.TimeFromUnix(60), Value: 0},
+		{Timestamp: model.TimeFromUnix(120), Value: 1.5},
+		{Timestamp: model.TimeFromUnix(180), Value: 0},
+		{Timestamp: model.TimeFromUnix(240), Value: 0},
+	}, zeroed[0].Values)
+	assert.True(t, math.IsNaN(float64(matrix[0].Values[0].Value)), "input matrix must not be modified")
+
+	series := PromHistogramToDatadogGauge("latency_bucket", 0.5, zeroed)
+	require.Len(t, series, 1)
+	assert.Len(t, series[0].Points, 4)
+}
+
+func TestNonFiniteSkipDropsEmptyStreams(t *testing.T) {
+	// The quantiles of an idle namespace are all NaN.
+	matrix := append(nonFiniteMatrix(), &model.SampleStream{
+		Metric: model.Metric{"temporal_namespace": "tomorrowland"},
+		Values: []model.SamplePair{
+			{Timestamp: model.TimeFromUnix(60), Value: model.SampleValue(math.NaN())},
+			{Timestamp: model.TimeFromUnix(120), Value: model.SampleValue(math.NaN())},
+		},
+	})
+
+	skipped, dropped := NonFiniteSkip.sanitize(matrix)
+	assert.Equal(t, 5, dropped)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, model.LabelValue("disneyland"), skipped[0].Metric["temporal_namespace"])
+
+	series := PromHistogramToDatadogGauge("latency_bucket", 0.99, skipped)
+	require.Len(t, series, 1, "no series is submitted without points")
+	assert.NotEmpty(t, series[0].Points)
+	assert.Empty(t, PromHistogramToDatadogGauge("latency_bucket", 0.99, matrix[1:]), "converters skip streams without a finite sample")
+}
+
+func TestParseNonFinitePolicy(t *testing.T) {
+	p, err := ParseNonFinitePolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, NonFiniteSkip, p)
+
+	p, err = ParseNonFinitePolicy("zero")
+	require.NoError(t, err)
+	assert.Equal(t, NonFiniteZero, p)
+
+	_, err = ParseNonFinitePolicy("drop")
+	assert.ErrorContains(t, err, "unknown non-finite policy")
+}
@@ -0,0 +1,24 @@
+package worker
+
+// Pause stops submissions until Resume, for instance during an incident on the receiving end.
+// Cycles keep querying and converting, so that Resume submits the next cycle right away, but
+// their series are dropped and the covered range advances as if they were submitted.
+func (w *Worker) Pause() {
+	if !w.paused.Swap(true) {
+		w.logger().Warn("Submission paused, series are no longer submitted until resumed")
+		w.Metrics.setPaused(true)
+	}
+}
+
+// Resume undoes Pause, from the next submission on.
+func (w *Worker) Resume() {
+	if w.paused.Swap(false) {
+		w.logger().Info("Submission resumed")
+		w.Metrics.setPaused(false)
+	}
+}
+
+// Paused reports whether submissions are paused.
+func (w *Worker) Paused() bool {
+	return w.paused.Load()
+}
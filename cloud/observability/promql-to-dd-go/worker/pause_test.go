@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerPauseSkipsSubmission(t *testing.T) {
+	submissions := 0
+	registry := promclient.NewRegistry()
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{&model.SampleStream{Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				submissions++
+				return nil
+			},
+		},
+		StepDuration:     time.Minute,
+		QueryInterval:    time.Minute,
+		QueryConcurrency: 1,
+		Metrics:          NewMetrics(registry),
+	}
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	w.Pause()
+	assert.True(t, w.Paused())
+	assert.Contains(t, scrape(), "exporter_submission_paused 1")
+	for i := 0; i < 2; i++ {
+		result, err := w.Reconcile(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, SubmissionPaused, result.Status)
+		assert.Zero(t, result.Submitted)
+	}
+	assert.Zero(t, submissions, "SubmitMetrics must not be called while paused")
+	assert.True(t, w.LastSubmission().IsZero())
+
+	w.Resume()
+	assert.False(t, w.Paused())
+	assert.Contains(t, scrape(), "exporter_submission_paused 0")
+	result, err := w.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, SubmissionSucceeded, result.Status)
+	assert.Equal(t, 1, submissions)
+
+	w.Pause()
+	require.NoError(t, w.RunOnce(context.Background()))
+	assert.Equal(t, 1, submissions)
+}
@@ -0,0 +1,249 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/prometheus/common/model"
+)
+
+// ParseQuantiles parses a comma separated list of quantiles such as "0.5,0.95,0.99".
+// Every value must pass ValidateQuantile; duplicates are dropped keeping the first
+// occurrence.
+func ParseQuantiles(s string) ([]float64, error) {
+	quantiles := []float64{}
+	seen := map[float64]bool{}
+	for _, raw := range strings.Split(s, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		q, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantile %q: not a number", raw)
+		}
+		if err := ValidateQuantile(q); err != nil {
+			return nil, fmt.Errorf("invalid quantile %q: %w", raw, err)
+		}
+		if seen[q] {
+			continue
+		}
+		seen[q] = true
+		quantiles = append(quantiles, q)
+	}
+	if len(quantiles) == 0 {
+		return nil, fmt.Errorf("no quantiles given")
+	}
+	return quantiles, nil
+}
+
+// ValidateQuantile checks that q lies strictly between 0 and 1. histogram_quantile yields
+// -Inf or +Inf, or the bounds of the lowest or highest bucket, for 0 and 1, which are never
+// what was meant; 0.5, 0.9, 0.95 and 0.99 are the typical values.
+func ValidateQuantile(q float64) error {
+	if !(q > 0 && q < 1) {
+		return fmt.Errorf("must be between 0 and 1 exclusive")
+	}
+	return nil
+}
+
+// ValidateQuantiles checks every quantile with ValidateQuantile.
+func ValidateQuantiles(quantiles []float64) error {
+	for _, q := range quantiles {
+		if err := ValidateQuantile(q); err != nil {
+			return fmt.Errorf("invalid quantile %v: %w", q, err)
+		}
+	}
+	return nil
+}
+
+// quantiles returns the valid Quantiles, so that a worker configured without ParseQuantiles
+// never queries the degenerate 0 and 1 quantiles.
+func (w *Worker) quantiles() []float64 {
+	return validQuantiles(w.Quantiles)
+}
+
+// quantilesFor returns the valid quantiles computed for the histogram metric: those of the
+// first matching QuantileOverrides, or else Quantiles.
+func (w *Worker) quantilesFor(metric string) []float64 {
+	for _, o := range w.QuantileOverrides {
+		if o.Pattern.MatchString(metric) {
+			return validQuantiles(o.Quantiles)
+		}
+	}
+	return w.quantiles()
+}
+
+func validQuantiles(quantiles []float64) []float64 {
+	valid := make([]float64, 0, len(quantiles))
+	for _, q := range quantiles {
+		if ValidateQuantile(q) == nil {
+			valid = append(valid, q)
+		}
+	}
+	return valid
+}
+
+// QuantileOverride computes Quantiles instead of the global quantiles for the histograms whose
+// name matches Pattern, for instance only the median of an expensive histogram.
+type QuantileOverride struct {
+	Pattern   *regexp.Regexp
+	Quantiles []float64
+}
+
+// QuantileOverrides is an ordered list of overrides, the first override whose pattern matches
+// a histogram wins. Histograms matching none use the global quantiles.
+type QuantileOverrides []QuantileOverride
+
+// ParseQuantileOverride parses an override of the form <pattern>=<quantiles>, the pattern
+// being a regular expression matched against the whole histogram name, such as
+// .*_latency_bucket, and the quantiles a list accepted by ParseQuantiles.
+func ParseQuantileOverride(s string) (QuantileOverride, error) {
+	pattern, list, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" {
+		return QuantileOverride{}, fmt.Errorf("invalid quantile override %q, expected <pattern>=<quantiles>", s)
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return QuantileOverride{}, fmt.Errorf("invalid quantile override pattern %q: %w", pattern, err)
+	}
+	quantiles, err := ParseQuantiles(list)
+	if err != nil {
+		return QuantileOverride{}, fmt.Errorf("invalid quantile override %q: %w", s, err)
+	}
+	return QuantileOverride{Pattern: re, Quantiles: quantiles}, nil
+}
+
+// String returns the override in the <pattern>=<quantiles> form accepted by
+// ParseQuantileOverride.
+func (o QuantileOverride) String() string {
+	pattern := strings.TrimSuffix(strings.TrimPrefix(o.Pattern.String(), "^(?:"), ")$")
+	quantiles := make([]string, len(o.Quantiles))
+	for i, q := range o.Quantiles {
+		quantiles[i] = strconv.FormatFloat(q, 'f', -1, 64)
+	}
+	return pattern + "=" + strings.Join(quantiles, ",")
+}
+
+// QuantileStyle selects how the quantile of histogram and summary gauges is encoded in the
+// Datadog metric name.
+type QuantileStyle string
+
+const (
+	// QuantileStyleSuffix appends _P99, the default.
+	QuantileStyleSuffix QuantileStyle = "suffix"
+	// QuantileStyleDotted appends .p99, the Datadog convention.
+	QuantileStyleDotted QuantileStyle = "dotted"
+	// QuantileStyleNone keeps the name unchanged and requires QuantileNaming.Tag.
+	QuantileStyleNone QuantileStyle = "none"
+)
+
+// QuantileNaming controls the metric names and tags of quantile gauges. The zero value uses
+// QuantileStyleSuffix without a tag.
+type QuantileNaming struct {
+	Style QuantileStyle
+	// Tag adds a quantile:<q> tag, instead of or in addition to the name suffix.
+	Tag bool
+}
+
+func ParseQuantileNaming(style string, tag bool) (QuantileNaming, error) {
+	n := QuantileNaming{Style: QuantileStyle(style), Tag: tag}
+	switch n.Style {
+	case "", QuantileStyleSuffix, QuantileStyleDotted:
+	case QuantileStyleNone:
+		if !tag {
+			return QuantileNaming{}, fmt.Errorf("quantile style %q requires the quantile tag, quantiles would be indistinguishable", style)
+		}
+	default:
+		return QuantileNaming{}, fmt.Errorf("unknown quantile style %q, want %q, %q or %q", style, QuantileStyleSuffix, QuantileStyleDotted, QuantileStyleNone)
+	}
+	return n, nil
+}
+
+// percentile returns the digits of a quantile as a percentile: 99 for 0.99, 50 for 0.5,
+// 999 for 0.999, 0 for 0 and 100 for 1, so that non-standard quantiles neither round nor
+// collide.
+func percentile(quantile float64) string {
+	switch quantile {
+	case 0:
+		return "0"
+	case 1:
+		return "100"
+	}
+	digits := strings.TrimPrefix(strconv.FormatFloat(quantile, 'f', -1, 64), "0.")
+	if len(digits) == 1 {
+		digits += "0"
+	}
+	return digits
+}
+
+func (n QuantileNaming) name(base string, quantile float64) string {
+	switch n.Style {
+	case QuantileStyleDotted:
+		return base + ".p" + percentile(quantile)
+	case QuantileStyleNone:
+		return base
+	default:
+		return base + "_P" + percentile(quantile)
+	}
+}
+
+func (n QuantileNaming) series(base string, quantile float64, matrix model.Matrix) []datadogV2.MetricSeries {
+	series := matrixToSeries(n.name(base, quantile), datadogV2.METRICINTAKETYPE_GAUGE, matrix)
+	if n.Tag {
+		tag := "quantile:" + strconv.FormatFloat(quantile, 'f', -1, 64)
+		for i := range series {
+			series[i].Tags = append(series[i].Tags, tag)
+		}
+	}
+	return series
+}
+
+// HistogramToGauge is PromHistogramToDatadogGauge with this naming.
+func (n QuantileNaming) HistogramToGauge(name string, quantile float64, matrix model.Matrix) []datadogV2.MetricSeries {
+	return n.series(strings.TrimSuffix(name, "_bucket"), quantile, matrix)
+}
+
+// QuantilePartLabel holds the quantile of every stream of a combined quantile query, see
+// Worker.CombineQuantiles.
+const QuantilePartLabel = "promql_to_dd_quantile"
+
+// CombinedHistogramToGauge converts the result of a combined quantile query, splitting its
+// streams by QuantilePartLabel into the series HistogramToGauge would return for each
+// quantile. Streams without a valid quantile label are skipped.
+func (n QuantileNaming) CombinedHistogramToGauge(name string, matrix model.Matrix) []datadogV2.MetricSeries {
+	series := []datadogV2.MetricSeries{}
+	for _, stream := range matrix {
+		if stream == nil {
+			continue
+		}
+		quantile, err := strconv.ParseFloat(string(stream.Metric[QuantilePartLabel]), 64)
+		if err != nil {
+			continue
+		}
+		metric := stream.Metric.Clone()
+		delete(metric, QuantilePartLabel)
+		stream := &model.SampleStream{Metric: metric, Values: stream.Values}
+		series = append(series, n.HistogramToGauge(name, quantile, model.Matrix{stream})...)
+	}
+	return series
+}
+
+// SummaryToGauge is PromSummaryToDatadogGauge with this naming.
+func (n QuantileNaming) SummaryToGauge(name string, matrix model.Matrix) []datadogV2.MetricSeries {
+	series := []datadogV2.MetricSeries{}
+	for _, stream := range matrix {
+		quantile, err := strconv.ParseFloat(string(stream.Metric[model.QuantileLabel]), 64)
+		if err != nil {
+			continue
+		}
+		metric := stream.Metric.Clone()
+		delete(metric, model.QuantileLabel)
+		stream := &model.SampleStream{Metric: metric, Values: stream.Values}
+		series = append(series, n.series(name, quantile, model.Matrix{stream})...)
+	}
+	return series
+}
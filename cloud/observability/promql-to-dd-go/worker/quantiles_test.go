@@ -0,0 +1,276 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestParseQuantiles(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    []float64
+		wantErr string
+	}{
+		{name: "valid", input: "0.5,0.95,0.99", want: []float64{0.5, 0.95, 0.99}},
+		{name: "whitespace and empty entries", input: " 0.5 , ,0.9", want: []float64{0.5, 0.9}},
+		{name: "duplicates", input: "0.5,0.99,0.50,0.99", want: []float64{0.5, 0.99}},
+		{name: "zero", input: "0,0.5", wantErr: "between 0 and 1"},
+		{name: "one", input: "0.5,1", wantErr: "between 0 and 1"},
+		{name: "negative", input: "-0.5", wantErr: "between 0 and 1"},
+		{name: "percentile instead of quantile", input: "95", wantErr: "between 0 and 1"},
+		{name: "NaN", input: "NaN", wantErr: "between 0 and 1"},
+		{name: "one as decimal", input: "1.0", wantErr: "between 0 and 1"},
+		{name: "negative zero", input: "-0", wantErr: "between 0 and 1"},
+		{name: "infinity", input: "+Inf", wantErr: "between 0 and 1"},
+		{name: "just below one", input: "0.9999", want: []float64{0.9999}},
+		{name: "just above zero", input: "0.0001", want: []float64{0.0001}},
+		{name: "malformed", input: "0.5,p99", wantErr: `"p99": not a number`},
+		{name: "empty", input: "", wantErr: "no quantiles"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseQuantiles(tc.input)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestQuantileNaming(t *testing.T) {
+	testCases := []struct {
+		name     string
+		naming   QuantileNaming
+		quantile float64
+		wantName string
+		wantTags []string
+	}{
+		{name: "suffix", quantile: 0.99, wantName: "latency_P99"},
+		{name: "suffix median", quantile: 0.5, wantName: "latency_P50"},
+		{name: "suffix three nines", quantile: 0.999, wantName: "latency_P999"},
+		{name: "suffix minimum", quantile: 0, wantName: "latency_P0"},
+		{name: "suffix maximum", quantile: 1, wantName: "latency_P100"},
+		{name: "suffix tenth", quantile: 0.1, wantName: "latency_P10"},
+		{name: "dotted", naming: QuantileNaming{Style: QuantileStyleDotted}, quantile: 0.95, wantName: "latency.p95"},
+		{name: "dotted three nines", naming: QuantileNaming{Style: QuantileStyleDotted}, quantile: 0.999, wantName: "latency.p999"},
+		{name: "dotted low quantile", naming: QuantileNaming{Style: QuantileStyleDotted}, quantile: 0.05, wantName: "latency.p05"},
+		{name: "dotted with tag", naming: QuantileNaming{Style: QuantileStyleDotted, Tag: true}, quantile: 0.99, wantName: "latency.p99", wantTags: []string{"quantile:0.99"}},
+		{name: "tag only", naming: QuantileNaming{Style: QuantileStyleNone, Tag: true}, quantile: 0.999, wantName: "latency", wantTags: []string{"quantile:0.999"}},
+	}
+
+	matrix := model.Matrix{&model.SampleStream{
+		Metric: model.Metric{"temporal_namespace": "disneyland"},
+		Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(60), Value: 1}},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			series := tc.naming.HistogramToGauge("latency_bucket", tc.quantile, matrix)
+			require.Len(t, series, 1)
+			assert.Equal(t, tc.wantName, series[0].Metric)
+			assert.Equal(t, tc.wantTags, series[0].Tags)
+		})
+	}
+}
+
+func TestParseQuantileNaming(t *testing.T) {
+	n, err := ParseQuantileNaming("dotted", true)
+	require.NoError(t, err)
+	assert.Equal(t, QuantileNaming{Style: QuantileStyleDotted, Tag: true}, n)
+
+	_, err = ParseQuantileNaming("none", false)
+	assert.ErrorContains(t, err, "requires the quantile tag")
+	_, err = ParseQuantileNaming("camel", false)
+	assert.ErrorContains(t, err, "unknown quantile style")
+}
+
+func TestHistogramPromQLKeepsQuantilePrecision(t *testing.T) {
+	w := Worker{}
+	assert.Contains(t, w.histogramPromQL(0.999, "latency_bucket"), "histogram_quantile(0.999, ")
+}
+
+func TestValidateQuantiles(t *testing.T) {
+	assert.NoError(t, ValidateQuantiles(nil))
+	assert.NoError(t, ValidateQuantiles([]float64{0.5, 0.9, 0.95, 0.99}))
+	for _, q := range []float64{0, 1, -0.5, 1.5, math.NaN(), math.Inf(1)} {
+		assert.ErrorContains(t, ValidateQuantiles([]float64{0.5, q}), "between 0 and 1", q)
+	}
+}
+
+func TestWorkerIgnoresInvalidQuantiles(t *testing.T) {
+	w := Worker{Quantiles: []float64{0, 0.5, 1, 0.99}}
+	queries := w.buildQueries(prometheus.MetricNames{Histograms: []string{"latency_bucket"}}, w.step())
+	promql := []string{}
+	for _, q := range queries {
+		promql = append(promql, q.promql)
+	}
+	assert.Equal(t, []string{w.histogramPromQL(0.5, "latency_bucket"), w.histogramPromQL(0.99, "latency_bucket")}, promql)
+}
+
+func TestHistogramToGaugeSkipsInfinity(t *testing.T) {
+	matrix := model.Matrix{&model.SampleStream{
+		Metric: model.Metric{"temporal_namespace": "disneyland"},
+		Values: []model.SamplePair{
+			{Timestamp: model.TimeFromUnix(60), Value: model.SampleValue(math.Inf(1))},
+			{Timestamp: model.TimeFromUnix(120), Value: 2.5},
+			{Timestamp: model.TimeFromUnix(180), Value: model.SampleValue(math.Inf(-1))},
+		},
+	}}
+	series := QuantileNaming{}.HistogramToGauge("latency_bucket", 0.99, matrix)
+	require.Len(t, series, 1)
+	require.Len(t, series[0].Points, 1)
+	assert.Equal(t, 2.5, series[0].Points[0].GetValue())
+}
+
+func TestParseQuantileOverride(t *testing.T) {
+	o, err := ParseQuantileOverride(".*_latency_bucket=0.5, 0.99")
+	require.NoError(t, err)
+	assert.True(t, o.Pattern.MatchString("service_latency_bucket"))
+	assert.False(t, o.Pattern.MatchString("service_latency_bucket_total"), "the pattern is anchored")
+	assert.Equal(t, []float64{0.5, 0.99}, o.Quantiles)
+	assert.Equal(t, ".*_latency_bucket=0.5,0.99", o.String())
+
+	for _, invalid := range []string{"", "=0.5", ".*_bucket", ".*_bucket=", "(=0.5", ".*_bucket=1.5", ".*_bucket=p99"} {
+		_, err := ParseQuantileOverride(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWorkerQuantileOverrides(t *testing.T) {
+	w := Worker{Quantiles: []float64{0.5, 0.95, 0.99}}
+	for _, raw := range []string{"service_latency_bucket=0.5", ".*_latency_bucket=0.9,0.99"} {
+		o, err := ParseQuantileOverride(raw)
+		require.NoError(t, err)
+		w.QuantileOverrides = append(w.QuantileOverrides, o)
+	}
+	metrics := prometheus.MetricNames{Histograms: []string{"service_latency_bucket", "poll_latency_bucket", "payload_size_bucket"}}
+	quantiles := map[string][]string{}
+	for _, q := range w.buildQueries(metrics, w.step()) {
+		quantiles[q.metric] = append(quantiles[q.metric], q.promql)
+	}
+	assert.Equal(t, []string{w.histogramPromQL(0.5, "service_latency_bucket")}, quantiles["service_latency_bucket"], "the first matching override wins")
+	assert.Equal(t, []string{w.histogramPromQL(0.9, "poll_latency_bucket"), w.histogramPromQL(0.99, "poll_latency_bucket")}, quantiles["poll_latency_bucket"])
+	assert.Equal(t, []string{
+		w.histogramPromQL(0.5, "payload_size_bucket"),
+		w.histogramPromQL(0.95, "payload_size_bucket"),
+		w.histogramPromQL(0.99, "payload_size_bucket"),
+	}, quantiles["payload_size_bucket"], "unmatched histograms use the global quantiles")
+}
+
+func TestWorkerCombineQuantiles(t *testing.T) {
+	// evaluate serves histogram_quantile(q, ...) for two namespaces, and the union of combined
+	// queries as Prometheus would: every part with its quantile label added.
+	quantilePart := regexp.MustCompile(`^label_replace\((.*), "` + QuantilePartLabel + `", "([^"]+)", "", ""\)$`)
+	evaluate := func(promql string) model.Matrix {
+		var quantile float64
+		_, err := fmt.Sscanf(promql, "histogram_quantile(%g,", &quantile)
+		require.NoError(t, err, promql)
+		matrix := model.Matrix{}
+		for i, ns := range []model.LabelValue{"ns-a", "ns-b"} {
+			matrix = append(matrix, &model.SampleStream{
+				Metric: model.Metric{"temporal_namespace": ns, "operation": "PollWorkflowTaskQueue"},
+				Values: []model.SamplePair{{Timestamp: 60_000, Value: model.SampleValue(quantile * float64(i+1))}},
+			})
+		}
+		return matrix
+	}
+	run := func(combine bool) ([]string, []string) {
+		var mu sync.Mutex
+		queries, submitted := []string{}, []string{}
+		w := &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Histograms: []string{"service_latency_bucket"}}, nil
+				},
+				queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+					mu.Lock()
+					queries = append(queries, promql)
+					mu.Unlock()
+					if !combine {
+						return evaluate(promql), nil
+					}
+					matrix := model.Matrix{}
+					for _, part := range strings.Split(promql, " or ") {
+						match := quantilePart.FindStringSubmatch(part)
+						require.NotNil(t, match, part)
+						for _, stream := range evaluate(match[1]) {
+							stream.Metric[QuantilePartLabel] = model.LabelValue(match[2])
+							matrix = append(matrix, stream)
+						}
+					}
+					return matrix, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+					for _, s := range series {
+						submitted = append(submitted, describeSeries(s))
+					}
+					return nil
+				},
+			},
+			Quantiles:        []float64{0.5, 0.9, 0.95, 0.99, 0.999},
+			StepDuration:     time.Minute,
+			CombineQuantiles: combine,
+		}
+		require.NoError(t, w.RunOnce(context.Background()))
+		return queries, submitted
+	}
+
+	perQuantileQueries, perQuantile := run(false)
+	combinedQueries, combined := run(true)
+	assert.Len(t, perQuantileQueries, 5)
+	assert.Len(t, combinedQueries, 1)
+	assert.Len(t, perQuantile, 10)
+	assert.ElementsMatch(t, perQuantile, combined, "combined quantiles yield the same series")
+}
+
+func TestCombinedHistogramToGaugeSkipsUnlabeledStreams(t *testing.T) {
+	matrix := model.Matrix{
+		&model.SampleStream{Metric: model.Metric{QuantilePartLabel: "0.99"}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}},
+		&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 2}}},
+		nil,
+	}
+	series := QuantileNaming{}.CombinedHistogramToGauge("latency_bucket", matrix)
+	require.Len(t, series, 1)
+	assert.Equal(t, "latency_P99", series[0].Metric)
+	assert.Empty(t, series[0].Resources, "the quantile label is removed")
+}
+
+// describeSeries renders the metric, tags, resources and points of s, independently of the
+// order of its resources.
+func describeSeries(s datadogV2.MetricSeries) string {
+	resources := []string{}
+	for _, r := range s.Resources {
+		resources = append(resources, r.GetType()+"="+r.GetName())
+	}
+	sort.Strings(resources)
+	points := []string{}
+	for _, p := range s.Points {
+		points = append(points, fmt.Sprintf("%d:%g", p.GetTimestamp(), p.GetValue()))
+	}
+	return fmt.Sprintf("%s %v %v %v", s.Metric, s.Tags, resources, points)
+}
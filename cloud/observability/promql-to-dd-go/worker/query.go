@@ -0,0 +1,393 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+const (
+	SeriesKindHistogram = "histogram"
+	SeriesKindRate      = "rate"
+	SeriesKindCount     = "count"
+	SeriesKindGauge     = "gauge"
+	SeriesKindSummary   = "summary"
+	SeriesKindAverage   = "average"
+)
+
+var seriesKinds = []string{SeriesKindHistogram, SeriesKindRate, SeriesKindCount, SeriesKindGauge, SeriesKindSummary, SeriesKindAverage}
+
+// query is a single PromQL query together with the conversion applied to its result.
+type query struct {
+	kind string
+	// metric is the discovered metric name the query was built for.
+	metric  string
+	promql  string
+	convert func(model.Matrix) []datadogV2.MetricSeries
+	// instant evaluates promql once at the end of the range instead of at every step.
+	instant bool
+	// derivesRates marks a counter query also converted to rates, which are accounted as
+	// SeriesKindRate.
+	derivesRates bool
+}
+
+// merge combines the values of streams merged by relabeling. Quantiles do not add up, and the
+// quantile of merged streams is at most the largest of theirs; the other kinds, including the
+// sum and count parts of averages, add up.
+func (q query) merge(a, b model.SampleValue) model.SampleValue {
+	if q.kind == SeriesKindHistogram || q.kind == SeriesKindSummary {
+		return max(a, b)
+	}
+	return a + b
+}
+
+// seriesKind returns the kind s is accounted for.
+func (q query) seriesKind(s datadogV2.MetricSeries) string {
+	if q.derivesRates && s.GetType() == datadogV2.METRICINTAKETYPE_RATE {
+		return SeriesKindRate
+	}
+	return q.kind
+}
+
+// buildQueries returns the queries of metrics for ranges of the given step, which rates are
+// converted with.
+func (w *Worker) buildQueries(metrics prometheus.MetricNames, step time.Duration) []query {
+	queries := []query{}
+	if w.DisableHistograms {
+		metrics.Histograms = nil
+	}
+	if w.DisableCounters {
+		metrics.Counters = nil
+	}
+	for _, bucketName := range metrics.Histograms {
+		quantiles := w.quantilesFor(bucketName)
+		if w.CombineQuantiles && len(quantiles) > 1 {
+			bucketName := bucketName
+			queries = append(queries, query{
+				kind:   SeriesKindHistogram,
+				metric: bucketName,
+				promql: w.histogramQuantilesPromQL(quantiles, bucketName),
+				convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+					return w.HistogramUnits.convert(bucketName, w.QuantileNaming.CombinedHistogramToGauge(bucketName, matrix))
+				},
+			})
+			continue
+		}
+		for _, quantile := range quantiles {
+			quantile, bucketName := quantile, bucketName
+			queries = append(queries, query{
+				kind:   SeriesKindHistogram,
+				metric: bucketName,
+				promql: w.histogramPromQL(quantile, bucketName),
+				convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+					return w.HistogramUnits.convert(bucketName, w.QuantileNaming.HistogramToGauge(bucketName, quantile, matrix))
+				},
+			})
+		}
+	}
+	if w.HistogramAverage {
+		for _, bucketName := range metrics.Histograms {
+			bucketName := bucketName
+			queries = append(queries, query{
+				kind:   SeriesKindAverage,
+				metric: bucketName,
+				promql: w.histogramAveragePromQL(bucketName),
+				convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+					return w.HistogramUnits.convert(bucketName, PromHistogramToDatadogAverage(bucketName, matrix))
+				},
+			})
+		}
+	}
+	forwarded := map[string]bool{}
+	if w.HistogramCountSum {
+		for _, bucketName := range metrics.Histograms {
+			base := strings.TrimSuffix(bucketName, "_bucket")
+			countName, sumName := base+"_count", base+"_sum"
+			forwarded[countName], forwarded[sumName] = true, true
+			queries = append(queries,
+				query{
+					kind:   SeriesKindCount,
+					metric: bucketName,
+					promql: w.selector(countName),
+					convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+						return PromCountToDatadogCount(countName, matrix)
+					},
+				},
+				query{
+					kind:   SeriesKindGauge,
+					metric: bucketName,
+					promql: w.selector(sumName),
+					convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+						return PromGaugeToDatadogGauge(sumName, matrix)
+					},
+				},
+			)
+		}
+	}
+	for _, counterName := range metrics.Counters {
+		if forwarded[counterName] {
+			continue
+		}
+		counterName := counterName
+		if w.DeriveCounterRates {
+			queries = append(queries, query{
+				kind:         SeriesKindCount,
+				metric:       counterName,
+				promql:       w.selector(counterName),
+				derivesRates: true,
+				convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+					return append(PromCountToDatadogCount(counterName, matrix), PromCountToDatadogDerivedRate(counterName, step, matrix)...)
+				},
+			})
+			continue
+		}
+		queries = append(queries,
+			query{
+				kind:   SeriesKindRate,
+				metric: counterName,
+				promql: w.ratePromQL(counterName),
+				convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+					return PromCountToDatadogRate(counterName, step, matrix)
+				},
+			},
+			query{
+				kind:   SeriesKindCount,
+				metric: counterName,
+				promql: w.selector(counterName),
+				convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+					return PromCountToDatadogCount(counterName, matrix)
+				},
+			},
+		)
+	}
+	for _, gaugeName := range metrics.Gauges {
+		if forwarded[gaugeName] {
+			continue
+		}
+		gaugeName := gaugeName
+		queries = append(queries, query{
+			kind:    SeriesKindGauge,
+			metric:  gaugeName,
+			promql:  w.promql(gaugeName, 0, w.selector(gaugeName)),
+			instant: w.InstantGauges,
+			convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+				return PromGaugeToDatadogGauge(gaugeName, matrix)
+			},
+		})
+	}
+	for _, summaryName := range metrics.Summaries {
+		summaryName := summaryName
+		queries = append(queries, query{
+			kind:   SeriesKindSummary,
+			metric: summaryName,
+			promql: w.promql(summaryName, 0, w.selector(summaryName)),
+			convert: func(matrix model.Matrix) []datadogV2.MetricSeries {
+				return w.QuantileNaming.SummaryToGauge(summaryName, matrix)
+			},
+		})
+	}
+	return queries
+}
+
+func (w *Worker) queryTimeout() time.Duration {
+	if w.QueryTimeout <= 0 {
+		return DefaultQueryTimeout
+	}
+	return w.QueryTimeout
+}
+
+func (w *Worker) queryConcurrency() int {
+	if w.QueryConcurrency <= 0 {
+		return 1
+	}
+	return w.QueryConcurrency
+}
+
+func (w *Worker) maxQuerySteps() int {
+	if w.MaxQuerySteps <= 0 {
+		return DefaultMaxQuerySteps
+	}
+	return w.MaxQuerySteps
+}
+
+// splitSteps splits a range evaluating more than maxSteps steps into consecutive ranges of at
+// most maxSteps steps. Each range starts one step after the previous end, so the evaluation
+// timestamps are those of the whole range, without duplicates or gaps at the seams.
+func splitSteps(queryRange promapi.Range, maxSteps int) []promapi.Range {
+	ranges := []promapi.Range{}
+	span := time.Duration(maxSteps-1) * queryRange.Step
+	for start := queryRange.Start; !start.After(queryRange.End); {
+		end := start.Add(span)
+		if end.After(queryRange.End) {
+			end = queryRange.End
+		}
+		ranges = append(ranges, promapi.Range{Start: start, End: end, Step: queryRange.Step})
+		start = end.Add(queryRange.Step)
+	}
+	return ranges
+}
+
+// mergeMatrices concatenates the streams of matrices queried over consecutive ranges, joining
+// the streams of identical label sets.
+func mergeMatrices(matrices []model.Matrix) model.Matrix {
+	if len(matrices) == 1 {
+		return matrices[0]
+	}
+	merged := model.Matrix{}
+	byLabels := map[model.Fingerprint]*model.SampleStream{}
+	for _, matrix := range matrices {
+		for _, stream := range matrix {
+			fp := stream.Metric.Fingerprint()
+			if s, ok := byLabels[fp]; ok {
+				s.Values = append(s.Values, stream.Values...)
+				continue
+			}
+			s := &model.SampleStream{Metric: stream.Metric, Values: append([]model.SamplePair{}, stream.Values...)}
+			byLabels[fp] = s
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// vectorToMatrix turns the result of an instant query into single sample streams, so that it
+// is converted like the result of a range query.
+func vectorToMatrix(vector model.Vector) model.Matrix {
+	matrix := make(model.Matrix, 0, len(vector))
+	for _, sample := range vector {
+		matrix = append(matrix, &model.SampleStream{
+			Metric: sample.Metric,
+			Values: []model.SamplePair{{Timestamp: sample.Timestamp, Value: sample.Value}},
+		})
+	}
+	return matrix
+}
+
+// query runs a single query, split into sub-queries of at most MaxQuerySteps steps, each
+// bounded by QueryTimeout and retried after transient failures, see QueryRetries. A timed out
+// sub-query fails with context.DeadlineExceeded. An instant query is evaluated once, at the
+// end of the range.
+func (w *Worker) query(ctx context.Context, querier prometheus.Querier, q query, queryRange promapi.Range) (model.Matrix, error) {
+	if q.instant {
+		var matrix model.Matrix
+		err := w.retryQuery(ctx, q, func(qctx context.Context) error {
+			vector, err := querier.QueryInstant(qctx, q.promql, queryRange.End)
+			matrix = vectorToMatrix(vector)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return matrix, nil
+	}
+	ranges := splitSteps(queryRange, w.maxQuerySteps())
+	matrices := make([]model.Matrix, 0, len(ranges))
+	for _, subRange := range ranges {
+		var matrix model.Matrix
+		err := w.retryQuery(ctx, q, func(qctx context.Context) error {
+			var err error
+			matrix, err = querier.QueryMetrics(qctx, q.promql, subRange)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		matrices = append(matrices, matrix)
+	}
+	return mergeMatrices(matrices), nil
+}
+
+// withQueryTimeout runs fn bounded by QueryTimeout, making sure a timeout is reported as
+// context.DeadlineExceeded whatever error the querier returns.
+func (w *Worker) withQueryTimeout(ctx context.Context, fn func(ctx context.Context) error) error {
+	qctx, cancel := context.WithTimeout(ctx, w.queryTimeout())
+	defer cancel()
+	err := fn(qctx)
+	if err != nil && qctx.Err() == context.DeadlineExceeded && !errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// runQueries executes the queries with at most QueryConcurrency in flight and returns the
+// converted series of each query, indexed like the input, along with the stats of every
+// query issued. The first failure cancels the remaining queries, unless BestEffortQueries is
+// set: then every failure is collected and returned together with the series of the queries
+// that succeeded. Queries resume after the range they already submitted, see queryRange. A
+// query exceeding QueryTimeout only fails the cycle when AbortOnQueryTimeout is set,
+// otherwise its range is left uncovered for the next cycle. Converted points beyond budget
+// are dropped, and queries returning once it is exhausted are not converted at all.
+func (w *Worker) runQueries(ctx context.Context, source Source, queries []query, queryRange promapi.Range, budget *pointBudget) ([][]datadogV2.MetricSeries, []QueryStats, error) {
+	results := make([][]datadogV2.MetricSeries, len(queries))
+	stats := make([]QueryStats, len(queries))
+	queryErrs := make([]error, len(queries))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(w.queryConcurrency())
+
+	for i, q := range queries {
+		if gctx.Err() != nil {
+			break
+		}
+		i, q := i, q
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			w.Metrics.incQueries(q.kind)
+			start := time.Now()
+			matrix, err := w.query(gctx, source.Querier, q, w.queryRange(source.name(), q, queryRange))
+			stats[i] = newQueryStats(q, time.Since(start), matrix, err)
+			w.logger().Debug("Query finished", "promql", q.promql, "kind", q.kind, "duration", stats[i].Duration,
+				"series", stats[i].Series, "samples", stats[i].Samples, "error", err)
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) && gctx.Err() == nil && !w.AbortOnQueryTimeout {
+					w.logger().Warn("Query timed out, skipping", "timeout", w.queryTimeout(), "promql", q.promql)
+					return nil
+				}
+				if w.BestEffortQueries && gctx.Err() == nil {
+					w.logger().Error("Query failed, submitting the other series", "promql", q.promql, "error", err)
+					queryErrs[i] = fmt.Errorf("query %s: %w", q.promql, err)
+					return nil
+				}
+				return err
+			}
+			matrix, old := filterSamples(matrix, w.oldestSample(time.Now()))
+			w.Metrics.addPointsDropped(dropReasonAge, old)
+			matrix, dropped := w.NonFinite.sanitize(matrix)
+			w.Metrics.addPointsDropped(dropReasonNaN, dropped)
+			if budget.exhausted(matrix) {
+				return nil
+			}
+			results[i] = budget.take(q.convert(w.relabeling().ApplyMatrix(matrix, q.merge)))
+			w.Naming.applySeries(results[i])
+			if w.AllLabelsAsTags {
+				labelsAsTags(results[i])
+			}
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	issued := []QueryStats{}
+	for _, st := range stats {
+		if st.PromQL != "" {
+			issued = append(issued, st)
+		}
+	}
+	if err != nil {
+		return nil, issued, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, issued, err
+	}
+	return results, issued, errors.Join(queryErrs...)
+}
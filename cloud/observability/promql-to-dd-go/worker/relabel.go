@@ -0,0 +1,181 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+type RelabelAction string
+
+const (
+	RelabelKeep   RelabelAction = "keep"
+	RelabelDrop   RelabelAction = "drop"
+	RelabelRename RelabelAction = "rename"
+)
+
+// RelabelRule maps a single Prometheus label onto the tags of the Datadog series.
+type RelabelRule struct {
+	Action RelabelAction
+	Source string
+	// Target is the new tag name, only used by RelabelRename.
+	Target string
+}
+
+// Relabeling is an ordered list of rules applied to the labels of every queried stream
+// before conversion.
+//
+// Precedence: for each label the first rule with a matching Source wins and later rules
+// for the same label are ignored. Labels without a matching rule are kept as they are,
+// unless the list contains at least one keep rule, in which case unmatched labels are
+// dropped (a rename also counts as keeping the label). A renamed label overwrites an
+// existing label with the target name.
+type Relabeling []RelabelRule
+
+// ParseRelabeling parses comma separated rules of the form keep:<label>, drop:<label> and
+// rename:<label>:<tag>.
+func ParseRelabeling(s string) (Relabeling, error) {
+	rules := Relabeling{}
+	for _, raw := range strings.Split(s, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		parts := strings.Split(raw, ":")
+		rule := RelabelRule{Action: RelabelAction(parts[0])}
+		switch {
+		case (rule.Action == RelabelKeep || rule.Action == RelabelDrop) && len(parts) == 2 && parts[1] != "":
+			rule.Source = parts[1]
+		case rule.Action == RelabelRename && len(parts) == 3 && parts[1] != "" && parts[2] != "":
+			rule.Source, rule.Target = parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("invalid relabel rule %q, expected keep:<label>, drop:<label> or rename:<label>:<tag>", raw)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r Relabeling) rule(label string) (RelabelRule, bool) {
+	for _, rule := range r {
+		if rule.Source == label {
+			return rule, true
+		}
+	}
+	return RelabelRule{}, false
+}
+
+func (r Relabeling) hasKeep() bool {
+	for _, rule := range r {
+		if rule.Action == RelabelKeep {
+			return true
+		}
+	}
+	return false
+}
+
+// withRename returns r renaming label to target, unless r already drops or renames label.
+// A label kept explicitly is renamed instead, and a label dropped by keep rules stays
+// dropped.
+func (r Relabeling) withRename(label, target string) Relabeling {
+	if target == "" || target == label {
+		return r
+	}
+	rename := RelabelRule{Action: RelabelRename, Source: label, Target: target}
+	for i, rule := range r {
+		if rule.Source != label {
+			continue
+		}
+		if rule.Action != RelabelKeep {
+			return r
+		}
+		renamed := append(Relabeling{}, r...)
+		renamed[i] = rename
+		return renamed
+	}
+	if r.hasKeep() {
+		return r
+	}
+	return append(append(Relabeling{}, r...), rename)
+}
+
+// Apply returns the relabeled copy of metric.
+func (r Relabeling) Apply(metric model.Metric) model.Metric {
+	if len(r) == 0 {
+		return metric
+	}
+
+	keepOnly := r.hasKeep()
+	relabeled := make(model.Metric, len(metric))
+	renamed := model.Metric{}
+	for name, value := range metric {
+		if name == AveragePartLabel || name == QuantilePartLabel || name == model.QuantileLabel {
+			// Internal to histogram averages and combined quantiles, or the quantile of a
+			// summary, all removed on conversion.
+			relabeled[name] = value
+			continue
+		}
+		rule, ok := r.rule(string(name))
+		switch {
+		case !ok && keepOnly, ok && rule.Action == RelabelDrop:
+			continue
+		case ok && rule.Action == RelabelRename:
+			renamed[model.LabelName(rule.Target)] = value
+		default:
+			relabeled[name] = value
+		}
+	}
+	for name, value := range renamed {
+		relabeled[name] = value
+	}
+	return relabeled
+}
+
+// ApplyMatrix returns a copy of matrix with the rules applied to every stream. Streams left
+// with the same labels, once a rule removed the label telling them apart, are merged into a
+// single stream, merge combining their values sharing a timestamp: their series would carry
+// the same tags and Datadog keeps only the last one submitted.
+func (r Relabeling) ApplyMatrix(matrix model.Matrix, merge func(a, b model.SampleValue) model.SampleValue) model.Matrix {
+	if len(r) == 0 {
+		return matrix
+	}
+
+	relabeled := make(model.Matrix, 0, len(matrix))
+	byLabels := map[model.Fingerprint]*model.SampleStream{}
+	for _, stream := range matrix {
+		metric := r.Apply(stream.Metric)
+		fp := metric.Fingerprint()
+		if s, ok := byLabels[fp]; ok {
+			s.Values = mergeValues(s.Values, stream.Values, merge)
+			continue
+		}
+		s := &model.SampleStream{Metric: metric, Values: stream.Values, Histograms: stream.Histograms}
+		byLabels[fp] = s
+		relabeled = append(relabeled, s)
+	}
+	return relabeled
+}
+
+// mergeValues returns the samples of a and b sorted by timestamp, combining those sharing a
+// timestamp with merge.
+func mergeValues(a, b []model.SamplePair, merge func(a, b model.SampleValue) model.SampleValue) []model.SamplePair {
+	byTime := make(map[model.Time]model.SampleValue, len(a)+len(b))
+	for _, pair := range a {
+		byTime[pair.Timestamp] = pair.Value
+	}
+	for _, pair := range b {
+		if v, ok := byTime[pair.Timestamp]; ok {
+			byTime[pair.Timestamp] = merge(v, pair.Value)
+			continue
+		}
+		byTime[pair.Timestamp] = pair.Value
+	}
+	merged := make([]model.SamplePair, 0, len(byTime))
+	for ts, v := range byTime {
+		merged = append(merged, model.SamplePair{Timestamp: ts, Value: v})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+	return merged
+}
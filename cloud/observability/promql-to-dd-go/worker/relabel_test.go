@@ -0,0 +1,230 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestRelabelingApply(t *testing.T) {
+	metric := model.Metric{
+		"temporal_namespace": "disneyland",
+		"operation":          "StartWorkflowExecution",
+		"instance":           "10.0.0.1:9090",
+	}
+
+	testCases := []struct {
+		name  string
+		rules Relabeling
+		want  model.Metric
+	}{
+		{
+			name: "no rules",
+			want: metric,
+		},
+		{
+			name:  "rename",
+			rules: Relabeling{{Action: RelabelRename, Source: "temporal_namespace", Target: "namespace"}},
+			want:  model.Metric{"namespace": "disneyland", "operation": "StartWorkflowExecution", "instance": "10.0.0.1:9090"},
+		},
+		{
+			name:  "drop",
+			rules: Relabeling{{Action: RelabelDrop, Source: "instance"}},
+			want:  model.Metric{"temporal_namespace": "disneyland", "operation": "StartWorkflowExecution"},
+		},
+		{
+			name: "keep drops unmatched labels",
+			rules: Relabeling{
+				{Action: RelabelKeep, Source: "operation"},
+				{Action: RelabelRename, Source: "temporal_namespace", Target: "namespace"},
+			},
+			want: model.Metric{"namespace": "disneyland", "operation": "StartWorkflowExecution"},
+		},
+		{
+			name: "first matching rule wins",
+			rules: Relabeling{
+				{Action: RelabelDrop, Source: "operation"},
+				{Action: RelabelRename, Source: "operation", Target: "op"},
+			},
+			want: model.Metric{"temporal_namespace": "disneyland", "instance": "10.0.0.1:9090"},
+		},
+		{
+			name:  "rename overwrites existing target",
+			rules: Relabeling{{Action: RelabelRename, Source: "temporal_namespace", Target: "operation"}},
+			want:  model.Metric{"operation": "disneyland", "instance": "10.0.0.1:9090"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, tc.rules.Apply(metric))
+		})
+	}
+	assert.Len(t, metric, 3, "input metric must not be modified")
+}
+
+func TestParseRelabeling(t *testing.T) {
+	rules, err := ParseRelabeling("rename:temporal_namespace:namespace, drop:instance,keep:operation")
+	require.NoError(t, err)
+	assert.Equal(t, Relabeling{
+		{Action: RelabelRename, Source: "temporal_namespace", Target: "namespace"},
+		{Action: RelabelDrop, Source: "instance"},
+		{Action: RelabelKeep, Source: "operation"},
+	}, rules)
+
+	rules, err = ParseRelabeling("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, invalid := range []string{"rename:temporal_namespace", "drop", "keep:a:b", "replace:a:b", "drop:"} {
+		_, err := ParseRelabeling(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRelabelingKeepsAveragePartLabel(t *testing.T) {
+	rules := Relabeling{{Action: RelabelKeep, Source: "temporal_namespace"}}
+	got := rules.Apply(model.Metric{"temporal_namespace": "disneyland", "operation": "Poll", AveragePartLabel: "sum"})
+	assert.Equal(t, model.Metric{"temporal_namespace": "disneyland", AveragePartLabel: "sum"}, got)
+}
+
+func TestRelabelingKeepsSummaryQuantile(t *testing.T) {
+	for _, rules := range []Relabeling{
+		{{Action: RelabelKeep, Source: "temporal_namespace"}},
+		{{Action: RelabelDrop, Source: "quantile"}},
+		{{Action: RelabelRename, Source: "quantile", Target: "q"}},
+	} {
+		relabeled := rules.ApplyMatrix(model.Matrix{&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland", model.QuantileLabel: "0.99"},
+			Values: []model.SamplePair{{Timestamp: 60_000, Value: 0.25}},
+		}}, query{kind: SeriesKindSummary}.merge)
+		series := QuantileNaming{}.SummaryToGauge("gc_pause", relabeled)
+		require.Len(t, series, 1, rules)
+		assert.Equal(t, "gc_pause_P99", series[0].Metric, rules)
+	}
+}
+
+func TestRelabelingMergesCollidingStreams(t *testing.T) {
+	matrix := model.Matrix{
+		&model.SampleStream{Metric: model.Metric{"temporal_namespace": "disneyland", "region": "us-east-1"}, Values: []model.SamplePair{
+			{Timestamp: 60_000, Value: 1},
+			{Timestamp: 120_000, Value: 2},
+		}},
+		&model.SampleStream{Metric: model.Metric{"temporal_namespace": "disneyland", "region": "eu-west-1"}, Values: []model.SamplePair{
+			{Timestamp: 120_000, Value: 5},
+			{Timestamp: 180_000, Value: 3},
+		}},
+		&model.SampleStream{Metric: model.Metric{"temporal_namespace": "tomorrowland", "region": "us-east-1"}, Values: []model.SamplePair{
+			{Timestamp: 60_000, Value: 7},
+		}},
+	}
+	rules := Relabeling{{Action: RelabelDrop, Source: "region"}}
+
+	summed := rules.ApplyMatrix(matrix, query{kind: SeriesKindCount}.merge)
+	require.Len(t, summed, 2, "one stream per label set")
+	assert.Equal(t, model.Metric{"temporal_namespace": "disneyland"}, summed[0].Metric)
+	assert.Equal(t, []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 7}, {Timestamp: 180_000, Value: 3}}, summed[0].Values)
+	assert.Equal(t, []model.SamplePair{{Timestamp: 60_000, Value: 7}}, summed[1].Values)
+	assert.Len(t, matrix[0].Values, 2, "the input matrix is not modified")
+
+	quantiles := rules.ApplyMatrix(matrix, query{kind: SeriesKindHistogram}.merge)
+	require.Len(t, quantiles, 2)
+	assert.Equal(t, []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 5}, {Timestamp: 180_000, Value: 3}}, quantiles[0].Values, "quantiles are not summed")
+
+	series := PromGaugeToDatadogGauge("pending_tasks", summed)
+	require.Len(t, series, 2, "no two series share their tags")
+}
+
+func TestRelabelingWithRename(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rules Relabeling
+		want  Relabeling
+	}{
+		{
+			name: "appended",
+			want: Relabeling{{Action: RelabelRename, Source: "temporal_namespace", Target: "namespace"}},
+		},
+		{
+			name:  "explicit keep renamed",
+			rules: Relabeling{{Action: RelabelKeep, Source: "temporal_namespace"}, {Action: RelabelKeep, Source: "operation"}},
+			want:  Relabeling{{Action: RelabelRename, Source: "temporal_namespace", Target: "namespace"}, {Action: RelabelKeep, Source: "operation"}},
+		},
+		{
+			name:  "dropped by keep rules",
+			rules: Relabeling{{Action: RelabelKeep, Source: "operation"}},
+			want:  Relabeling{{Action: RelabelKeep, Source: "operation"}},
+		},
+		{
+			name:  "explicit drop wins",
+			rules: Relabeling{{Action: RelabelDrop, Source: "temporal_namespace"}},
+			want:  Relabeling{{Action: RelabelDrop, Source: "temporal_namespace"}},
+		},
+		{
+			name:  "explicit rename wins",
+			rules: Relabeling{{Action: RelabelRename, Source: "temporal_namespace", Target: "ns"}},
+			want:  Relabeling{{Action: RelabelRename, Source: "temporal_namespace", Target: "ns"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, tc.rules.withRename("temporal_namespace", "namespace"), tc.name)
+	}
+	rules := Relabeling{{Action: RelabelKeep, Source: "temporal_namespace"}}
+	rules.withRename("temporal_namespace", "namespace")
+	assert.Equal(t, RelabelKeep, rules[0].Action, "rules must not be modified")
+}
+
+func TestWorkerNamespaceAndOperationTags(t *testing.T) {
+	var submitted []datadogV2.MetricSeries
+	var queries []string
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Histograms: []string{"latency_bucket"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				queries = append(queries, promql)
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{
+					"temporal_namespace": "disneyland",
+					"operation":          "StartWorkflowExecution",
+				}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		Quantiles:       []float64{0.99},
+		NamespaceAllow:  []string{"disneyland"},
+		StepDuration:    time.Minute,
+		QueryInterval:   10 * time.Minute,
+		NamespaceTag:    "namespace",
+		OperationTag:    "temporal_operation",
+		AllLabelsAsTags: true,
+	}
+
+	require.NoError(t, w.RunOnce(context.Background()))
+	assert.Equal(t, []string{
+		`histogram_quantile(0.99, sum(rate(latency_bucket{temporal_namespace=~"disneyland"}[1m])) by (temporal_namespace,operation,le))`,
+	}, queries, "queries keep the Prometheus label names")
+	require.Len(t, submitted, 1)
+	resources := map[string]string{}
+	for _, r := range submitted[0].Resources {
+		resources[r.GetType()] = r.GetName()
+	}
+	assert.Equal(t, map[string]string{"namespace": "disneyland", "temporal_operation": "StartWorkflowExecution"}, resources)
+	assert.ElementsMatch(t, []string{"namespace:disneyland", "temporal_operation:startworkflowexecution"}, submitted[0].Tags)
+}
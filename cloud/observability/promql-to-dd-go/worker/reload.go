@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+// Settings are the worker fields that can change while Run is running, see Worker.Reloads.
+type Settings struct {
+	MetricPrefix      string
+	MetricPrefixes    []string
+	PrefixTag         string
+	Quantiles         []float64
+	QuantileOverrides QuantileOverrides
+	HistogramGroupBy  []string
+	NamespaceAllow    []string
+	NamespaceDeny     []string
+	OperationFilter   []string
+	QueryTemplates    QueryTemplates
+	Relabeling        Relabeling
+	NamespaceTag      string
+	OperationTag      string
+	AllLabelsAsTags   bool
+}
+
+// Settings returns the current settings of the worker.
+func (w *Worker) Settings() Settings {
+	return Settings{
+		MetricPrefix:      w.MetricPrefix,
+		MetricPrefixes:    w.MetricPrefixes,
+		PrefixTag:         w.PrefixTag,
+		Quantiles:         w.Quantiles,
+		QuantileOverrides: w.QuantileOverrides,
+		HistogramGroupBy:  w.HistogramGroupBy,
+		NamespaceAllow:    w.NamespaceAllow,
+		NamespaceDeny:     w.NamespaceDeny,
+		OperationFilter:   w.OperationFilter,
+		QueryTemplates:    w.QueryTemplates,
+		Relabeling:        w.Relabeling,
+		NamespaceTag:      w.NamespaceTag,
+		OperationTag:      w.OperationTag,
+		AllLabelsAsTags:   w.AllLabelsAsTags,
+	}
+}
+
+// ApplySettings sets the fields of s. It must not be called while a cycle is in flight; send
+// on Reloads instead while Run is running.
+func (w *Worker) ApplySettings(s Settings) {
+	w.MetricPrefix = s.MetricPrefix
+	w.MetricPrefixes = s.MetricPrefixes
+	w.PrefixTag = s.PrefixTag
+	w.Quantiles = s.Quantiles
+	w.QuantileOverrides = s.QuantileOverrides
+	w.HistogramGroupBy = s.HistogramGroupBy
+	w.NamespaceAllow = s.NamespaceAllow
+	w.NamespaceDeny = s.NamespaceDeny
+	w.OperationFilter = s.OperationFilter
+	w.QueryTemplates = s.QueryTemplates
+	w.Relabeling = s.Relabeling
+	w.NamespaceTag = s.NamespaceTag
+	w.OperationTag = s.OperationTag
+	w.AllLabelsAsTags = s.AllLabelsAsTags
+}
+
+// reload applies s between cycles, logging the settings that changed.
+func (w *Worker) reload(s Settings) {
+	changes := w.Settings().diff(s)
+	w.ApplySettings(s)
+	if len(changes) == 0 {
+		w.logger().Info("Configuration reloaded, nothing changed")
+		return
+	}
+	w.logger().Info("Configuration reloaded", changes...)
+	w.checkConfig()
+}
+
+// diff returns a log group per field of s changed in next, holding the old and new values.
+// Values are compared as printed, which is what the log shows and sidesteps the compiled
+// regular expressions and templates of QueryTemplates.
+func (s Settings) diff(next Settings) []any {
+	changes := []any{}
+	prev, cur := reflect.ValueOf(s), reflect.ValueOf(next)
+	for i := 0; i < prev.NumField(); i++ {
+		before, after := fmt.Sprint(prev.Field(i).Interface()), fmt.Sprint(cur.Field(i).Interface())
+		if before != after {
+			changes = append(changes, slog.Group(prev.Type().Field(i).Name, "old", before, "new", after))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerReloadBetweenCycles(t *testing.T) {
+	var mu sync.Mutex
+	queries := []string{}
+	cycles := make(chan struct{}, 10)
+	reloads := make(chan Settings, 1)
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Histograms: []string{"latency_bucket"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				mu.Lock()
+				queries = append(queries, promql)
+				first := len(queries) == 1
+				mu.Unlock()
+				if first {
+					// Reloaded mid-cycle, applied to the next one only.
+					reloads <- Settings{Quantiles: []float64{0.99}, NamespaceAllow: []string{"prod-.*"}}
+				}
+				cycles <- struct{}{}
+				return model.Matrix{}, nil
+			},
+		},
+		Submitter:     &fakeSubmitter{submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil }},
+		Quantiles:     []float64{0.5},
+		QueryInterval: time.Minute,
+		StepDuration:  time.Minute,
+		SleepDuration: 50 * time.Millisecond,
+		Reloads:       reloads,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	<-cycles
+	<-cycles
+	cancel()
+	require.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(queries), 2)
+	assert.Contains(t, queries[0], "histogram_quantile(0.5,")
+	assert.NotContains(t, queries[0], "prod-")
+	assert.Contains(t, queries[1], "histogram_quantile(0.99,")
+	assert.Contains(t, queries[1], `temporal_namespace=~"prod-.*"`)
+	assert.Equal(t, []float64{0.99}, w.Quantiles)
+}
+
+func TestSettingsDiff(t *testing.T) {
+	tmpl, err := ParseQueryTemplate("replication_lag=max({{.Selector}})")
+	require.NoError(t, err)
+	before := Settings{Quantiles: []float64{0.5, 0.99}, NamespaceTag: "namespace"}
+	after := before
+	after.Quantiles = []float64{0.99}
+	after.QueryTemplates = QueryTemplates{tmpl}
+
+	changes := before.diff(after)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "Quantiles=[old=[0.5 0.99] new=[0.99]]", changes[0].(interface{ String() string }).String())
+	assert.Equal(t, "QueryTemplates=[old=[] new=[replication_lag=max({{.Selector}})]]", changes[1].(interface{ String() string }).String())
+	assert.Empty(t, before.diff(before))
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+// SubmissionStatus is the outcome of the submission step of a cycle.
+type SubmissionStatus string
+
+const (
+	// SubmissionNotAttempted means the cycle failed before submitting, for instance because
+	// every source failed or the context was cancelled.
+	SubmissionNotAttempted SubmissionStatus = ""
+	// SubmissionSucceeded means the series were submitted.
+	SubmissionSucceeded SubmissionStatus = "submitted"
+	// SubmissionFailed means the submission was attempted and failed.
+	SubmissionFailed SubmissionStatus = "failed"
+	// SubmissionSkipped means there were no series to submit.
+	SubmissionSkipped SubmissionStatus = "skipped"
+	// SubmissionDryRun means the series were logged instead of submitted.
+	SubmissionDryRun SubmissionStatus = "dry-run"
+	// SubmissionPaused means the series were dropped because submission is paused, see Pause.
+	SubmissionPaused SubmissionStatus = "paused"
+)
+
+// Result describes what a cycle did.
+type Result struct {
+	Range promapi.Range
+	// Discovered counts the metric names discovered by kind, summed over the sources.
+	Discovered Discovered
+	// Series counts the converted series by series kind, such as SeriesKindHistogram.
+	Series map[string]int
+	// Submitted is the number of series handed to the Submitter, after deduplication.
+	Submitted int
+	Status    SubmissionStatus
+	// Queries holds the stats of every query issued, in no particular order.
+	Queries []QueryStats
+}
+
+// QueryStats describes a single query of a cycle, to spot the slow or large ones.
+type QueryStats struct {
+	Source string
+	// Metric is the discovered metric name the query was built for.
+	Metric   string
+	PromQL   string
+	Kind     string
+	Duration time.Duration
+	// Series and Samples count the streams and samples returned, before conversion.
+	Series  int
+	Samples int
+	Err     error
+}
+
+func newQueryStats(q query, d time.Duration, matrix model.Matrix, err error) QueryStats {
+	st := QueryStats{Metric: q.metric, PromQL: q.promql, Kind: q.kind, Duration: d, Series: len(matrix), Err: err}
+	for _, stream := range matrix {
+		st.Samples += len(stream.Values)
+	}
+	return st
+}
+
+// QuerySummary aggregates the query stats of a cycle.
+type QuerySummary struct {
+	Queries int
+	// Duration is the summed duration of the queries, exceeding the wall time of the cycle
+	// when queries run concurrently.
+	Duration time.Duration
+	Samples  int
+	Slowest  QueryStats
+	Largest  QueryStats
+}
+
+// QuerySummary summarizes Queries.
+func (r Result) QuerySummary() QuerySummary {
+	summary := QuerySummary{Queries: len(r.Queries)}
+	for _, st := range r.Queries {
+		summary.Duration += st.Duration
+		summary.Samples += st.Samples
+		if st.Duration > summary.Slowest.Duration {
+			summary.Slowest = st
+		}
+		if st.Samples > summary.Largest.Samples {
+			summary.Largest = st
+		}
+	}
+	return summary
+}
+
+type Discovered struct {
+	Histograms int
+	Counters   int
+	Gauges     int
+	Summaries  int
+}
+
+func (d *Discovered) add(metrics prometheus.MetricNames) {
+	d.Histograms += len(metrics.Histograms)
+	d.Counters += len(metrics.Counters)
+	d.Gauges += len(metrics.Gauges)
+	d.Summaries += len(metrics.Summaries)
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestWorkerReconcile(t *testing.T) {
+	newWorker := func(metrics prometheus.MetricNames, submitErr error) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return metrics, nil
+				},
+				queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 2}}}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return submitErr },
+			},
+			Quantiles:     []float64{0.5, 0.99},
+			StepDuration:  time.Minute,
+			QueryInterval: 10 * time.Minute,
+		}
+	}
+	metrics := prometheus.MetricNames{
+		Histograms: []string{"latency_bucket"},
+		Counters:   []string{"requests_count", "errors_count"},
+		Gauges:     []string{"pending_tasks"},
+	}
+
+	t.Run("submitted", func(t *testing.T) {
+		result, err := newWorker(metrics, nil).Reconcile(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Discovered{Histograms: 1, Counters: 2, Gauges: 1}, result.Discovered)
+		assert.Equal(t, map[string]int{
+			SeriesKindHistogram: 2,
+			SeriesKindRate:      2,
+			SeriesKindCount:     2,
+			SeriesKindGauge:     1,
+			SeriesKindSummary:   0,
+			SeriesKindAverage:   0,
+		}, result.Series)
+		assert.Equal(t, 7, result.Submitted)
+		assert.Equal(t, SubmissionSucceeded, result.Status)
+		assert.Equal(t, time.Minute, result.Range.Step)
+		assert.Equal(t, 12*time.Minute, result.Range.End.Sub(result.Range.Start))
+	})
+
+	t.Run("failed submission", func(t *testing.T) {
+		errRejected := errors.New("rejected")
+		result, err := newWorker(metrics, errRejected).Reconcile(context.Background())
+		assert.ErrorIs(t, err, errRejected)
+		assert.Equal(t, SubmissionFailed, result.Status)
+		assert.Zero(t, result.Submitted)
+		assert.Equal(t, 1, result.Discovered.Gauges)
+	})
+
+	t.Run("nothing to submit", func(t *testing.T) {
+		result, err := newWorker(prometheus.MetricNames{}, nil).Reconcile(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, SubmissionSkipped, result.Status)
+		assert.Equal(t, Discovered{}, result.Discovered)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		w := newWorker(metrics, nil)
+		w.DryRun = true
+		result, err := w.Reconcile(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, SubmissionDryRun, result.Status)
+		assert.Zero(t, result.Submitted)
+		assert.Equal(t, 1, result.Series[SeriesKindGauge])
+	})
+
+	t.Run("discovery failure", func(t *testing.T) {
+		w := newWorker(metrics, nil)
+		w.Querier = &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{}, errors.New("prometheus unavailable")
+			},
+		}
+		result, err := w.Reconcile(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, SubmissionNotAttempted, result.Status)
+	})
+}
+
+func TestWorkerReconcileQueryStats(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks", "slow_gauge"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				if promql == "slow_gauge" {
+					time.Sleep(20 * time.Millisecond)
+					return model.Matrix{}, nil
+				}
+				return model.Matrix{
+					&model.SampleStream{Metric: model.Metric{"temporal_namespace": "a"}, Values: []model.SamplePair{{Value: 1}, {Value: 2}, {Value: 3}}},
+					&model.SampleStream{Metric: model.Metric{"temporal_namespace": "b"}, Values: []model.SamplePair{{Value: 1}}},
+				}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		MetricPrefix:  "temporal_",
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		Logger:        slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	result, err := w.Reconcile(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Queries, 2)
+	byPromQL := map[string]QueryStats{}
+	for _, st := range result.Queries {
+		byPromQL[st.PromQL] = st
+	}
+	fast, slow := byPromQL["pending_tasks"], byPromQL["slow_gauge"]
+	assert.Equal(t, "temporal_", fast.Source)
+	assert.Equal(t, SeriesKindGauge, fast.Kind)
+	assert.Equal(t, 2, fast.Series)
+	assert.Equal(t, 4, fast.Samples)
+	assert.Equal(t, 0, slow.Series)
+	assert.GreaterOrEqual(t, slow.Duration, 20*time.Millisecond)
+
+	summary := result.QuerySummary()
+	assert.Equal(t, 2, summary.Queries)
+	assert.Equal(t, 4, summary.Samples)
+	assert.Equal(t, fast.Duration+slow.Duration, summary.Duration)
+	assert.Equal(t, "slow_gauge", summary.Slowest.PromQL)
+	assert.Equal(t, "pending_tasks", summary.Largest.PromQL)
+
+	assert.Contains(t, buf.String(), `"msg":"Query finished","promql":"pending_tasks","kind":"gauge","duration":`)
+	assert.Contains(t, buf.String(), `"series":2,"samples":4`)
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// DefaultQueryRetryBackoff is used when QueryRetryBackoff is not set.
+const DefaultQueryRetryBackoff = time.Second
+
+func (w *Worker) queryRetryBackoff() time.Duration {
+	if w.QueryRetryBackoff <= 0 {
+		return DefaultQueryRetryBackoff
+	}
+	return w.QueryRetryBackoff
+}
+
+// transientQueryError reports whether a failed query is worth repeating: Prometheus answered
+// with a server error, such as 503 while it restarts, or the request failed on the network.
+// Rejected queries, timeouts and cancellations are final.
+func transientQueryError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *promapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Type == promapi.ErrServer
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryQuery runs attempt bounded by QueryTimeout, repeating it up to QueryRetries times
+// while it fails with a transient error. The delays between attempts grow exponentially from
+// QueryRetryBackoff, up to eight times that. Once the retries are exhausted, the last error is
+// returned and the cycle fails as usual.
+func (w *Worker) retryQuery(ctx context.Context, q query, attempt func(ctx context.Context) error) error {
+	var delays *backoff
+	for n := 0; ; n++ {
+		err := w.withQueryTimeout(ctx, attempt)
+		if err == nil || n >= w.QueryRetries || !transientQueryError(err) {
+			return err
+		}
+		if delays == nil {
+			delays = newBackoff(w.queryRetryBackoff(), 8*w.queryRetryBackoff())
+		}
+		delay := delays.Next()
+		w.logger().Warn("Query failed, retrying", "promql", q.promql, "attempt", n+1, "retry_in", delay, "error", err)
+		w.Metrics.incQueryRetries(q.kind)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
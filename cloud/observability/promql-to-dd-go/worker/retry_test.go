@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+var errUnavailable = fmt.Errorf("failed to query Prometheus: %w", &promapi.Error{Type: promapi.ErrServer, Msg: "server error: 503"})
+
+func retryWorker(queryMetrics func(context.Context, string, promapi.Range) (model.Matrix, error), submitted *[]datadogV2.MetricSeries) *Worker {
+	return &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"workflow_count"}}, nil
+			},
+			queryMetrics: queryMetrics,
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				*submitted = series
+				return nil
+			},
+		},
+		StepDuration:      time.Minute,
+		QueryInterval:     time.Minute,
+		QueryConcurrency:  1,
+		QueryRetries:      2,
+		QueryRetryBackoff: time.Millisecond,
+	}
+}
+
+func TestWorkerRetriesTransientQueryErrors(t *testing.T) {
+	attempts := 0
+	var submitted []datadogV2.MetricSeries
+	w := retryWorker(func(context.Context, string, promapi.Range) (model.Matrix, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errUnavailable
+		}
+		return model.Matrix{&model.SampleStream{Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+	}, &submitted)
+	registry := promclient.NewRegistry()
+	w.Metrics = NewMetrics(registry)
+	require.NoError(t, w.RunOnce(context.Background()))
+
+	assert.Equal(t, 2, attempts)
+	require.Len(t, submitted, 1)
+	assert.Equal(t, "workflow_count", submitted[0].Metric)
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `exporter_query_retries_total{kind="gauge"} 1`)
+}
+
+func TestWorkerQueryRetriesExhausted(t *testing.T) {
+	attempts := 0
+	var submitted []datadogV2.MetricSeries
+	w := retryWorker(func(context.Context, string, promapi.Range) (model.Matrix, error) {
+		attempts++
+		return nil, errUnavailable
+	}, &submitted)
+
+	err := w.RunOnce(context.Background())
+	assert.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 3, attempts)
+	assert.Empty(t, submitted)
+}
+
+func TestWorkerDoesNotRetryRejectedQueries(t *testing.T) {
+	attempts := 0
+	var submitted []datadogV2.MetricSeries
+	w := retryWorker(func(context.Context, string, promapi.Range) (model.Matrix, error) {
+		attempts++
+		return nil, &promapi.Error{Type: promapi.ErrBadData, Msg: "parse error"}
+	}, &submitted)
+
+	assert.Error(t, w.RunOnce(context.Background()))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestTransientQueryError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		transient bool
+	}{
+		{errUnavailable, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&promapi.Error{Type: promapi.ErrClient, Msg: "client error: 404"}, false},
+		{&promapi.Error{Type: promapi.ErrBadData, Msg: "parse error"}, false},
+		{fmt.Errorf("%w: %w", context.DeadlineExceeded, errUnavailable), false},
+		{context.Canceled, false},
+		{errors.New("unexpected"), false},
+	} {
+		assert.Equal(t, tc.transient, transientQueryError(tc.err), tc.err.Error())
+	}
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ValidateJitter checks that the jitter keeps consecutive cycles in order.
+func ValidateJitter(jitter float64) error {
+	if !(jitter >= 0 && jitter <= 0.5) {
+		return fmt.Errorf("jitter must be between 0 and 0.5, got %v", jitter)
+	}
+	return nil
+}
+
+// schedule spaces cycles like a ticker of interval, each tick shifted by a random offset of at
+// most jitter·interval either way so that replicas started together spread their load. Ticks
+// stay anchored to the grid of interval, so the average cadence remains interval, and like a
+// ticker, ticks missed by a slow cycle are dropped rather than fired in a burst.
+type schedule struct {
+	start    time.Time
+	interval time.Duration
+	jitter   float64
+	tick     int
+	random   func() float64
+}
+
+func newSchedule(start time.Time, interval time.Duration, jitter float64) *schedule {
+	return &schedule{start: start, interval: interval, jitter: jitter, random: rand.Float64}
+}
+
+// next returns how long to wait from now until the next tick, zero when it is already due.
+func (s *schedule) next(now time.Time) time.Duration {
+	s.tick++
+	if s.interval <= 0 {
+		return 0
+	}
+	if missed := int(now.Sub(s.start)/s.interval) - s.tick; missed > 0 {
+		s.tick += missed
+	}
+	offset := time.Duration((2*s.random() - 1) * s.jitter * float64(s.interval))
+	return max(s.start.Add(time.Duration(s.tick)*s.interval+offset).Sub(now), 0)
+}
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleJitter(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newSchedule(start, time.Minute, 0.2)
+	s.random = rand.New(rand.NewSource(1)).Float64
+
+	now := start
+	intervals := map[time.Duration]bool{}
+	const cycles = 1000
+	for i := 0; i < cycles; i++ {
+		delay := s.next(now)
+		// Cycles are shifted by at most 12s either way, so consecutive starts are 36s to 84s apart.
+		assert.GreaterOrEqual(t, delay, 36*time.Second)
+		assert.LessOrEqual(t, delay, 84*time.Second)
+		intervals[delay] = true
+		now = now.Add(delay)
+	}
+	assert.Greater(t, len(intervals), cycles/2, "intervals vary")
+
+	average := now.Sub(start) / cycles
+	assert.InDelta(t, float64(time.Minute), float64(average), float64(time.Second), "the average cadence is the interval")
+}
+
+func TestScheduleWithoutJitter(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newSchedule(start, time.Minute, 0)
+
+	assert.Equal(t, time.Minute, s.next(start))
+	// A 20s cycle only waits for the rest of the interval, like a ticker.
+	assert.Equal(t, 40*time.Second, s.next(start.Add(80*time.Second)))
+	// A cycle overrunning several intervals starts the next one right away, once, and drops the
+	// other missed ticks.
+	assert.Equal(t, time.Duration(0), s.next(start.Add(5*time.Minute+30*time.Second)))
+	assert.Equal(t, 30*time.Second, s.next(start.Add(5*time.Minute+30*time.Second)))
+}
+
+func TestValidateJitter(t *testing.T) {
+	for _, jitter := range []float64{0, 0.1, 0.5} {
+		assert.NoError(t, ValidateJitter(jitter))
+	}
+	for _, jitter := range []float64{-0.1, 0.6} {
+		assert.Error(t, ValidateJitter(jitter))
+	}
+}
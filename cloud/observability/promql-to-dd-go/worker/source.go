@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+// Source is a Prometheus endpoint queried by the worker.
+type Source struct {
+	prometheus.Querier
+	// Name identifies the source in logs. Defaults to MetricPrefix.
+	Name         string
+	MetricPrefix string
+	// Tag is an optional key:value tag added to every series of this source.
+	Tag string
+}
+
+func (s Source) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.MetricPrefix
+}
+
+// sources returns the configured Sources or, when none are configured, one source per
+// metric prefix of the worker's own Querier.
+func (w *Worker) sources() []Source {
+	if len(w.Sources) > 0 {
+		return w.Sources
+	}
+	prefixes := w.MetricPrefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{w.MetricPrefix}
+	}
+	sources := make([]Source, len(prefixes))
+	for i, prefix := range prefixes {
+		sources[i] = Source{Querier: w.Querier, MetricPrefix: prefix}
+		if w.PrefixTag != "" {
+			sources[i].Tag = w.PrefixTag + ":" + prefix
+		}
+	}
+	return sources
+}
+
+// collect discovers, queries and converts the metrics of a single source, counting the
+// discovered metrics, the series per series kind and the issued queries into result. With BestEffortQueries, the
+// series of the successful queries are returned along with the error of the failed ones. The
+// converted points are charged to budget.
+func (w *Worker) collect(ctx context.Context, source Source, queryRange promapi.Range, budget *pointBudget, result *Result) ([]datadogV2.MetricSeries, error) {
+	metrics, err := source.ListMetrics(ctx, source.MetricPrefix)
+	if err != nil {
+		return nil, err
+	}
+	result.Discovered.add(metrics)
+
+	logger := w.logger().With("source", source.name())
+	logger.Debug("Querying Prometheus")
+	logger.Debug("Found histogram metrics", "count", len(metrics.Histograms), "names", metrics.Histograms)
+	logger.Debug("Found counter metrics", "count", len(metrics.Counters), "names", metrics.Counters)
+	logger.Debug("Found gauge metrics", "count", len(metrics.Gauges), "names", metrics.Gauges)
+	logger.Debug("Found summary metrics", "count", len(metrics.Summaries), "names", metrics.Summaries)
+
+	queries := w.buildQueries(metrics, queryRange.Step)
+	results, stats, queryErr := w.runQueries(ctx, source, queries, queryRange, budget)
+	for i := range stats {
+		stats[i].Source = source.name()
+	}
+	result.Queries = append(result.Queries, stats...)
+	if results == nil {
+		return nil, queryErr
+	}
+	w.Metrics.setHighCardinality(source.name(), w.guardCardinality(source, results))
+	w.Metrics.setEmptyQueryMetrics(source.name(), w.trackEmptyMetrics(source, stats))
+
+	series := []datadogV2.MetricSeries{}
+	received := map[string]int{}
+	for i, q := range queries {
+		for _, s := range results[i] {
+			if source.Tag != "" {
+				s.Tags = append(s.Tags, source.Tag)
+			}
+			s.Tags = append(s.Tags, w.Tags...)
+			series = append(series, s)
+			received[q.seriesKind(s)]++
+		}
+	}
+	for _, kind := range seriesKinds {
+		logger.Debug("Received series", "kind", kind, "count", received[kind])
+		result.Series[kind] += received[kind]
+	}
+	return series, queryErr
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// status records the outcome of the most recent cycles. It is safe for concurrent use.
+type status struct {
+	mu             sync.RWMutex
+	lastSuccess    time.Time
+	lastFailure    time.Time
+	lastSubmission time.Time
+}
+
+func (s *status) recordSuccess(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSuccess = t
+}
+
+func (s *status) recordFailure(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastFailure = t
+}
+
+func (s *status) recordSubmission(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSubmission = t
+}
+
+// LastCycle returns the completion times of the last successful and the last failed cycle.
+// A zero time means no such cycle happened yet.
+func (w *Worker) LastCycle() (lastSuccess, lastFailure time.Time) {
+	w.status.mu.RLock()
+	defer w.status.mu.RUnlock()
+	return w.status.lastSuccess, w.status.lastFailure
+}
+
+// LastSubmission returns the time of the last successful submission, zero if none happened
+// yet. Cycles without series and dry runs do not submit.
+func (w *Worker) LastSubmission() time.Time {
+	w.status.mu.RLock()
+	defer w.status.mu.RUnlock()
+	return w.status.lastSubmission
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/common/model"
+)
+
+// QueryTemplate overrides the PromQL of the metrics whose name matches Pattern.
+type QueryTemplate struct {
+	Pattern  *regexp.Regexp
+	Template *template.Template
+}
+
+// TemplateData holds the placeholders available to a QueryTemplate, for instance
+// histogram_quantile({{.Quantile}}, sum(irate({{.Selector}}[{{.RateWindow}}])) by ({{.GroupBy}})).
+type TemplateData struct {
+	// Metric is the discovered metric name, such as latency_bucket.
+	Metric string
+	// Selector is Metric with the namespace and operation filters applied.
+	Selector string
+	// Quantile is the quantile of histogram queries, zero otherwise.
+	Quantile float64
+	// RateWindow is the rate window in PromQL duration syntax, such as 1m.
+	RateWindow string
+	// GroupBy is the comma separated histogram aggregation labels, including le.
+	GroupBy string
+}
+
+// QueryTemplates is an ordered list of overrides, the first template whose pattern matches a
+// metric wins. A template replaces the quantile queries of a histogram, the rate query of a
+// counter and the query of a gauge or summary; other queries keep their defaults.
+type QueryTemplates []QueryTemplate
+
+// ParseQueryTemplate parses an override of the form <pattern>=<template>, the pattern being a
+// regular expression matched against the whole metric name and the template a text/template
+// over TemplateData. The template is checked by rendering it with sample data, so that
+// unknown placeholders are reported at startup.
+func ParseQueryTemplate(s string) (QueryTemplate, error) {
+	pattern, text, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" || strings.TrimSpace(text) == "" {
+		return QueryTemplate{}, fmt.Errorf("invalid query template %q, expected <pattern>=<template>", s)
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return QueryTemplate{}, fmt.Errorf("invalid query template pattern %q: %w", pattern, err)
+	}
+	tmpl, err := template.New(pattern).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return QueryTemplate{}, fmt.Errorf("invalid query template for %q: %w", pattern, err)
+	}
+	sample := TemplateData{Metric: "metric", Selector: "metric", Quantile: 0.99, RateWindow: "1m", GroupBy: "le"}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return QueryTemplate{}, fmt.Errorf("invalid query template for %q: %w", pattern, err)
+	}
+	return QueryTemplate{Pattern: re, Template: tmpl}, nil
+}
+
+// String returns the template in the <pattern>=<template> form accepted by ParseQueryTemplate.
+func (qt QueryTemplate) String() string {
+	return qt.Template.Name() + "=" + qt.Template.Root.String()
+}
+
+func (t QueryTemplates) match(metric string) (QueryTemplate, bool) {
+	for _, qt := range t {
+		if qt.Pattern.MatchString(metric) {
+			return qt, true
+		}
+	}
+	return QueryTemplate{}, false
+}
+
+// promql renders the override of metric, or returns fallback when none matches. A template
+// failing to render, which validation makes unlikely, is logged and the default used.
+func (w *Worker) promql(metric string, quantile float64, fallback string) string {
+	qt, ok := w.QueryTemplates.match(metric)
+	if !ok {
+		return fallback
+	}
+	var b strings.Builder
+	err := qt.Template.Execute(&b, TemplateData{
+		Metric:     metric,
+		Selector:   w.selector(metric),
+		Quantile:   quantile,
+		RateWindow: model.Duration(w.rateWindow()).String(),
+		GroupBy:    strings.Join(w.histogramGroupBy(), ","),
+	})
+	if err != nil {
+		w.logger().Error("Failed rendering query template, using the default query", "metric", metric, "error", err)
+		return fallback
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func mustParseQueryTemplates(t *testing.T, raw ...string) QueryTemplates {
+	t.Helper()
+	templates := QueryTemplates{}
+	for _, s := range raw {
+		qt, err := ParseQueryTemplate(s)
+		require.NoError(t, err, s)
+		templates = append(templates, qt)
+	}
+	return templates
+}
+
+func TestParseQueryTemplateRejectsInvalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "no separator", raw: "latency_bucket", wantErr: "expected <pattern>=<template>"},
+		{name: "empty template", raw: "latency_bucket= ", wantErr: "expected <pattern>=<template>"},
+		{name: "invalid pattern", raw: "latency_(=max({{.Selector}})", wantErr: "invalid query template pattern"},
+		{name: "invalid syntax", raw: "latency_.*=max({{.Selector)", wantErr: "invalid query template"},
+		{name: "unknown placeholder", raw: "latency_.*=max({{.Bucket}})", wantErr: "can't evaluate field Bucket"},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseQueryTemplate(tc.raw)
+		assert.ErrorContains(t, err, tc.wantErr, tc.name)
+	}
+}
+
+func TestWorkerQueryTemplates(t *testing.T) {
+	w := Worker{
+		NamespaceAllow: []string{"prod-.*"},
+		QueryTemplates: mustParseQueryTemplates(t,
+			`service_latency_bucket=histogram_quantile({{.Quantile}}, sum(increase({{.Selector}}[{{.RateWindow}}])) by ({{.GroupBy}}))`,
+			`.*_requests_count=sum(rate({{.Selector}}[5m]))`,
+			`.*_requests_.*=never_used`,
+			`replication_lag=max({{.Metric}})`,
+		),
+	}
+
+	assert.Equal(t,
+		`histogram_quantile(0.99, sum(increase(service_latency_bucket{temporal_namespace=~"prod-.*"}[1m])) by (temporal_namespace,operation,le))`,
+		w.histogramPromQL(0.99, "service_latency_bucket"))
+	assert.Equal(t,
+		`histogram_quantile(0.99, sum(rate(replay_latency_bucket{temporal_namespace=~"prod-.*"}[1m])) by (temporal_namespace,operation,le))`,
+		w.histogramPromQL(0.99, "replay_latency_bucket"), "unmatched metrics keep the default")
+	assert.Equal(t, `sum(rate(frontend_requests_count{temporal_namespace=~"prod-.*"}[5m]))`, w.ratePromQL("frontend_requests_count"),
+		"the first matching template wins")
+	assert.Equal(t, `rate(frontend_errors_count{temporal_namespace=~"prod-.*"}[1m])`, w.ratePromQL("frontend_errors_count"))
+	assert.Equal(t, "max(replication_lag)", w.promql("replication_lag", 0, "default"))
+	assert.Equal(t, "default", w.promql("replication_lag_seconds", 0, "default"), "patterns match the whole name")
+}
+
+func TestWorkerQueryTemplatesIssued(t *testing.T) {
+	var mu sync.Mutex
+	queries := []string{}
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{
+					Gauges:    []string{"replication_lag", "pending_tasks"},
+					Summaries: []string{"gc_pause"},
+				}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				mu.Lock()
+				queries = append(queries, promql)
+				mu.Unlock()
+				return model.Matrix{}, nil
+			},
+		},
+		Submitter:      &fakeSubmitter{},
+		StepDuration:   time.Minute,
+		QueryInterval:  10 * time.Minute,
+		QueryTemplates: mustParseQueryTemplates(t, `replication_lag|gc_pause=max({{.Selector}}) by (temporal_namespace)`),
+	}
+
+	require.NoError(t, w.RunOnce(context.Background()))
+	assert.ElementsMatch(t, []string{
+		"max(replication_lag) by (temporal_namespace)",
+		"pending_tasks",
+		"max(gc_pause) by (temporal_namespace)",
+	}, queries)
+}
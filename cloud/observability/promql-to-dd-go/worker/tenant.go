@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TenantTagKey is the tag key identifying the tenant of every series, see Tenant.
+const TenantTagKey = "tenant"
+
+// Tenant is the worker exporting the metrics of one customer of a shared exporter, with its
+// own Querier, Submitter and prefixes. Its Tags should include TenantTagKey:<Name>.
+type Tenant struct {
+	Name string
+	*Worker
+}
+
+// Tenants run side by side, each worker with its own cycles, coverage, checkpoint and circuit
+// breaker, so that the failures of a tenant, down to its worker giving up, do not affect the
+// others.
+type Tenants []Tenant
+
+// Validate checks that tenant names are set and unique, and validates every worker.
+func (t Tenants) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, tenant := range t {
+		switch {
+		case tenant.Name == "":
+			errs = append(errs, fmt.Errorf("tenant %d has no name", i+1))
+		case seen[tenant.Name]:
+			errs = append(errs, fmt.Errorf("tenant %s is configured twice", tenant.Name))
+		}
+		seen[tenant.Name] = true
+		if tenant.Worker == nil {
+			errs = append(errs, fmt.Errorf("tenant %s has no worker", tenant.Name))
+			continue
+		}
+		if err := tenant.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run runs the worker of every tenant until ctx is cancelled. A worker giving up after
+// MaxConsecutiveFailures is logged and the others keep running; Run then returns the errors
+// of the workers that gave up once every worker returned.
+func (t Tenants) Run(ctx context.Context) error {
+	return t.each(func(tenant Tenant) error {
+		err := tenant.Run(ctx)
+		if err != nil {
+			tenant.logger().Error("Tenant worker exited, the other tenants keep running", "tenant", tenant.Name, "error", err)
+		}
+		return err
+	})
+}
+
+// RunOnce executes a single cycle for every tenant concurrently and returns the errors of the
+// failed ones. Every tenant runs its cycle whatever the outcome of the others.
+func (t Tenants) RunOnce(ctx context.Context) error {
+	return t.each(func(tenant Tenant) error {
+		return tenant.RunOnce(ctx)
+	})
+}
+
+func (t Tenants) each(fn func(Tenant) error) error {
+	errs := make([]error, len(t))
+	var wg sync.WaitGroup
+	for i, tenant := range t {
+		i, tenant := i, tenant
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(tenant); err != nil {
+				errs[i] = fmt.Errorf("tenant %s: %w", tenant.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// LastCycle reports the tenants as a whole: the last successful cycle of any tenant and, only
+// when the last cycle of every tenant failed, the last failure. A single failing tenant is
+// surfaced by its logs and metrics rather than by failing the readiness of every tenant.
+func (t Tenants) LastCycle() (lastSuccess, lastFailure time.Time) {
+	failing := len(t) > 0
+	for _, tenant := range t {
+		success, failure := tenant.LastCycle()
+		if success.After(lastSuccess) {
+			lastSuccess = success
+		}
+		if failure.After(lastFailure) {
+			lastFailure = failure
+		}
+		if failure.IsZero() || failure.Before(success) {
+			failing = false
+		}
+	}
+	if !failing {
+		lastFailure = time.Time{}
+	}
+	return lastSuccess, lastFailure
+}
+
+// LastSubmission returns the last successful submission of any tenant.
+func (t Tenants) LastSubmission() time.Time {
+	var last time.Time
+	for _, tenant := range t {
+		if s := tenant.LastSubmission(); s.After(last) {
+			last = s
+		}
+	}
+	return last
+}
+
+// Pause pauses the submissions of every tenant, see Worker.Pause.
+func (t Tenants) Pause() {
+	for _, tenant := range t {
+		tenant.Pause()
+	}
+}
+
+// Resume resumes the submissions of every tenant.
+func (t Tenants) Resume() {
+	for _, tenant := range t {
+		tenant.Resume()
+	}
+}
+
+// Paused reports whether the submissions of every tenant are paused.
+func (t Tenants) Paused() bool {
+	for _, tenant := range t {
+		if !tenant.Paused() {
+			return false
+		}
+	}
+	return len(t) > 0
+}
@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+// tenantSubmissions records the series submitted by every tenant.
+type tenantSubmissions struct {
+	mu     sync.Mutex
+	series map[string][]datadogV2.MetricSeries
+}
+
+func (s *tenantSubmissions) get(tenant string) []datadogV2.MetricSeries {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.series[tenant]
+}
+
+func newTestTenant(name, prefix string, queryErr error, submissions *tenantSubmissions) Tenant {
+	return Tenant{Name: name, Worker: &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(_ context.Context, metricPrefix string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{metricPrefix + "pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				if queryErr != nil {
+					return nil, queryErr
+				}
+				return model.Matrix{&model.SampleStream{Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submissions.mu.Lock()
+				defer submissions.mu.Unlock()
+				submissions.series[name] = append(submissions.series[name], series...)
+				return nil
+			},
+		},
+		MetricPrefix:     prefix,
+		Tags:             []string{TenantTagKey + ":" + name},
+		StepDuration:     time.Minute,
+		QueryInterval:    time.Minute,
+		SleepDuration:    10 * time.Millisecond,
+		QueryConcurrency: 1,
+	}}
+}
+
+func TestTenantsRunOnceIsolatesFailures(t *testing.T) {
+	submissions := &tenantSubmissions{series: map[string][]datadogV2.MetricSeries{}}
+	errDown := errors.New("prometheus down")
+	tenants := Tenants{
+		newTestTenant("acme", "acme_", errDown, submissions),
+		newTestTenant("globex", "globex_", nil, submissions),
+	}
+
+	err := tenants.RunOnce(context.Background())
+	require.ErrorIs(t, err, errDown)
+	assert.Contains(t, err.Error(), "tenant acme:")
+	assert.NotContains(t, err.Error(), "globex")
+
+	assert.Empty(t, submissions.get("acme"))
+	globex := submissions.get("globex")
+	require.Len(t, globex, 1)
+	assert.Equal(t, "globex_pending_tasks", globex[0].Metric)
+	assert.Contains(t, globex[0].Tags, "tenant:globex")
+	assert.NotContains(t, globex[0].Tags, "tenant:acme")
+}
+
+func TestTenantsRunKeepsRunningWhenATenantGivesUp(t *testing.T) {
+	submissions := &tenantSubmissions{series: map[string][]datadogV2.MetricSeries{}}
+	errDown := errors.New("prometheus down")
+	failing := newTestTenant("acme", "acme_", errDown, submissions)
+	failing.MaxConsecutiveFailures = 1
+	tenants := Tenants{failing, newTestTenant("globex", "globex_", nil, submissions)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tenants.Run(ctx) }()
+	assert.Eventually(t, func() bool { return len(submissions.get("globex")) >= 3 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	err := <-done
+	require.ErrorIs(t, err, ErrTooManyFailures)
+	assert.Contains(t, err.Error(), "tenant acme:")
+	assert.Empty(t, submissions.get("acme"))
+}
+
+func TestTenantsLastCycle(t *testing.T) {
+	at := func(minute int) time.Time { return time.Unix(int64(minute)*60, 0) }
+	tenant := func(success, failure time.Time) Tenant {
+		w := &Worker{}
+		w.status.lastSuccess, w.status.lastFailure = success, failure
+		return Tenant{Worker: w}
+	}
+
+	success, failure := Tenants{tenant(at(10), at(20)), tenant(at(15), time.Time{})}.LastCycle()
+	assert.Equal(t, at(15), success)
+	assert.True(t, failure.IsZero(), "a single failing tenant keeps the tenants ready")
+
+	success, failure = Tenants{tenant(at(10), at(20)), tenant(time.Time{}, at(16))}.LastCycle()
+	assert.Equal(t, at(10), success)
+	assert.Equal(t, at(20), failure)
+}
+
+func TestTenantsValidate(t *testing.T) {
+	submissions := &tenantSubmissions{series: map[string][]datadogV2.MetricSeries{}}
+	valid := newTestTenant("acme", "acme_", nil, submissions)
+	unnamed := newTestTenant("", "b_", nil, submissions)
+	noPrefix := newTestTenant("globex", "", nil, submissions)
+
+	require.NoError(t, Tenants{valid}.Validate())
+	err := Tenants{valid, valid, unnamed, noPrefix}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tenant acme is configured twice")
+	assert.Contains(t, err.Error(), "tenant 3 has no name")
+	assert.Contains(t, err.Error(), "tenant globex: metric prefix is empty")
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+)
+
+// HistogramUnit is the Datadog unit histogram quantiles and averages are exported in. Temporal
+// latency histograms are recorded in seconds.
+type HistogramUnit string
+
+const (
+	// HistogramUnitSecond keeps the values and declares them in seconds.
+	HistogramUnitSecond HistogramUnit = "second"
+	// HistogramUnitMillisecond multiplies the values by 1000 and declares them in milliseconds.
+	HistogramUnitMillisecond HistogramUnit = "millisecond"
+)
+
+// factor returns the multiplier converting seconds to u.
+func (u HistogramUnit) factor() float64 {
+	if u == HistogramUnitMillisecond {
+		return 1000
+	}
+	return 1
+}
+
+// Apply converts the values of series, in seconds, to u and sets u as their Datadog unit.
+func (u HistogramUnit) Apply(series []datadogV2.MetricSeries) []datadogV2.MetricSeries {
+	factor := u.factor()
+	for i := range series {
+		unit := string(u)
+		series[i].Unit = &unit
+		if factor == 1 {
+			continue
+		}
+		for j, p := range series[i].Points {
+			if p.Value != nil {
+				v := *p.Value * factor
+				series[i].Points[j].Value = &v
+			}
+		}
+	}
+	return series
+}
+
+// UnitRule declares the unit of the histograms whose name matches Pattern.
+type UnitRule struct {
+	Pattern *regexp.Regexp
+	Unit    HistogramUnit
+}
+
+// UnitRules is an ordered list of rules, the first rule whose pattern matches a histogram
+// wins. Histograms matching no rule are exported as they are, without a unit.
+type UnitRules []UnitRule
+
+// ParseUnitRule parses a rule of the form <pattern>=<unit>, the pattern being a regular
+// expression matched against the whole histogram name, such as .*_latency_bucket, and the unit
+// second or millisecond.
+func ParseUnitRule(s string) (UnitRule, error) {
+	pattern, unit, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" {
+		return UnitRule{}, fmt.Errorf("invalid unit rule %q, expected <pattern>=<unit>", s)
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return UnitRule{}, fmt.Errorf("invalid unit rule pattern %q: %w", pattern, err)
+	}
+	switch u := HistogramUnit(strings.TrimSpace(unit)); u {
+	case HistogramUnitSecond, HistogramUnitMillisecond:
+		return UnitRule{Pattern: re, Unit: u}, nil
+	default:
+		return UnitRule{}, fmt.Errorf("unknown unit %q in unit rule %q, want %q or %q", unit, s, HistogramUnitSecond, HistogramUnitMillisecond)
+	}
+}
+
+// String returns the rule in the <pattern>=<unit> form accepted by ParseUnitRule.
+func (r UnitRule) String() string {
+	pattern := strings.TrimSuffix(strings.TrimPrefix(r.Pattern.String(), "^(?:"), ")$")
+	return pattern + "=" + string(r.Unit)
+}
+
+// convert applies the unit of the first rule matching metric to series.
+func (r UnitRules) convert(metric string, series []datadogV2.MetricSeries) []datadogV2.MetricSeries {
+	for _, rule := range r {
+		if rule.Pattern.MatchString(metric) {
+			return rule.Unit.Apply(series)
+		}
+	}
+	return series
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+func TestHistogramUnitApply(t *testing.T) {
+	matrix := model.Matrix{&model.SampleStream{
+		Metric: model.Metric{"temporal_namespace": "disneyland"},
+		Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(60), Value: 0.25}, {Timestamp: model.TimeFromUnix(120), Value: 1.5}},
+	}}
+
+	ms := HistogramUnitMillisecond.Apply(PromHistogramToDatadogGauge("latency_bucket", 0.99, matrix))
+	require.Len(t, ms, 1)
+	assert.Equal(t, "millisecond", ms[0].GetUnit())
+	require.Len(t, ms[0].Points, 2)
+	assert.Equal(t, 250.0, *ms[0].Points[0].Value)
+	assert.Equal(t, 1500.0, *ms[0].Points[1].Value)
+
+	s := HistogramUnitSecond.Apply(PromHistogramToDatadogGauge("latency_bucket", 0.99, matrix))
+	assert.Equal(t, "second", s[0].GetUnit())
+	assert.Equal(t, 0.25, *s[0].Points[0].Value)
+}
+
+func TestParseUnitRule(t *testing.T) {
+	rule, err := ParseUnitRule(".*_latency_bucket=millisecond")
+	require.NoError(t, err)
+	assert.Equal(t, HistogramUnitMillisecond, rule.Unit)
+	assert.True(t, rule.Pattern.MatchString("temporal_cloud_v0_service_latency_bucket"))
+	assert.False(t, rule.Pattern.MatchString("temporal_cloud_v0_service_latency_bucket_total"), "the pattern matches whole names")
+	assert.Equal(t, ".*_latency_bucket=millisecond", rule.String())
+
+	for _, raw := range []string{"", "latency_bucket", "=second", "(=second", "latency_bucket=minute"} {
+		_, err := ParseUnitRule(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestWorkerHistogramUnits(t *testing.T) {
+	ms, err := ParseUnitRule(".*_latency_bucket=millisecond")
+	require.NoError(t, err)
+	w := Worker{Quantiles: []float64{0.99}, HistogramAverage: true, HistogramUnits: UnitRules{ms}}
+	matrix := model.Matrix{&model.SampleStream{
+		Metric: model.Metric{},
+		Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(60), Value: 0.5}},
+	}}
+
+	queries := w.buildQueries(prometheus.MetricNames{Histograms: []string{"service_latency_bucket", "payload_size_bucket"}}, w.step())
+	units := map[string]string{}
+	for _, q := range queries {
+		if q.kind != SeriesKindHistogram {
+			continue
+		}
+		for _, s := range q.convert(matrix) {
+			units[s.Metric] = s.GetUnit()
+			if s.GetUnit() == "millisecond" {
+				assert.Equal(t, 500.0, *s.Points[0].Value)
+			}
+		}
+	}
+	assert.Equal(t, map[string]string{"service_latency_P99": "millisecond", "payload_size_P99": ""}, units)
+}
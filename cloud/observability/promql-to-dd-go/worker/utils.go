@@ -1,81 +1,224 @@
 package worker
 
 import (
-	"fmt"
-	"math"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	"github.com/prometheus/common/model"
 )
 
-func interruptCh() <-chan interface{} {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	ret := make(chan interface{}, 1)
-	go func() {
-		s := <-c
-		ret <- s
-		close(ret)
-	}()
-
-	return ret
+// PromHistogramToDatadogGauge converts the result of a histogram_quantile query into one gauge
+// series per stream, named <metric>_P<percentile>. Whatever the matrix holds, it returns a
+// non-nil slice with at most one series per stream, and every series has the gauge type, at
+// least one point, only finite values and one resource per label; nil streams and streams
+// without a finite value are skipped.
+func PromHistogramToDatadogGauge(name string, quantile float64, matrix model.Matrix) []datadogV2.MetricSeries {
+	return QuantileNaming{}.HistogramToGauge(name, quantile, matrix)
 }
 
-func PromHistogramToDatadogGauge(name string, quantile float64, matrix model.Matrix) []datadogV2.MetricSeries {
-	name = strings.TrimSuffix(name, "_bucket") + fmt.Sprintf("_P%2.0f", quantile*100)
+// AveragePartLabel marks whether a stream of a histogram average query holds the rate of the
+// _sum or of the _count series.
+const AveragePartLabel = "promql_to_dd_part"
+
+// PromHistogramToDatadogAverage divides the _sum rate by the _count rate of every stream of an
+// average query, producing a <metric>.avg gauge. Points where the count is zero or missing are
+// skipped.
+func PromHistogramToDatadogAverage(name string, matrix model.Matrix) []datadogV2.MetricSeries {
+	name = strings.TrimSuffix(name, "_bucket") + ".avg"
 	metricType := datadogV2.METRICINTAKETYPE_GAUGE
-	return matrixToSeries(name, metricType, matrix)
+
+	type halves struct {
+		metric model.Metric
+		sums   []model.SamplePair
+		counts map[model.Time]model.SampleValue
+	}
+	byLabels := map[model.Fingerprint]*halves{}
+	order := []model.Fingerprint{}
+	for _, stream := range matrix {
+		metric := stream.Metric.Clone()
+		part := metric[AveragePartLabel]
+		delete(metric, AveragePartLabel)
+		fp := metric.Fingerprint()
+		h, ok := byLabels[fp]
+		if !ok {
+			h = &halves{metric: metric, counts: map[model.Time]model.SampleValue{}}
+			byLabels[fp] = h
+			order = append(order, fp)
+		}
+		switch part {
+		case "sum":
+			h.sums = append(h.sums, stream.Values...)
+		case "count":
+			for _, pair := range stream.Values {
+				h.counts[pair.Timestamp] = pair.Value
+			}
+		}
+	}
+
+	averages := model.Matrix{}
+	for _, fp := range order {
+		h := byLabels[fp]
+		values := []model.SamplePair{}
+		for _, pair := range h.sums {
+			count, ok := h.counts[pair.Timestamp]
+			if !ok || count == 0 {
+				continue
+			}
+			values = append(values, model.SamplePair{Timestamp: pair.Timestamp, Value: pair.Value / count})
+		}
+		if len(values) > 0 {
+			averages = append(averages, &model.SampleStream{Metric: h.metric, Values: values})
+		}
+	}
+	return matrixToSeries(name, metricType, averages)
 }
 
-func PromCountToDatadogRate(name string, matrix model.Matrix) []datadogV2.MetricSeries {
+// PromCountToDatadogRate converts per-second rates into Datadog rate series. Datadog needs
+// the interval between points to interpret rates, which is the query step.
+func PromCountToDatadogRate(name string, interval time.Duration, matrix model.Matrix) []datadogV2.MetricSeries {
 	name = strings.TrimSuffix(name, "_count") + "_rate1m"
 	metricType := datadogV2.METRICINTAKETYPE_RATE
-	return matrixToSeries(name, metricType, matrix)
+	series := matrixToSeries(name, metricType, matrix)
+	intervals := make([]int64, len(series))
+	for i := range series {
+		intervals[i] = int64(interval.Seconds())
+		series[i].Interval = &intervals[i]
+	}
+	return series
+}
+
+// PromCountToDatadogDerivedRate converts raw counter samples into Datadog rate series, named
+// like PromCountToDatadogRate. The per-second rate of every point is its increase since the
+// previous point, so the first point of every stream has no rate; consecutive query ranges
+// overlap by at least a step, which covers it.
+func PromCountToDatadogDerivedRate(name string, interval time.Duration, matrix model.Matrix) []datadogV2.MetricSeries {
+	return PromCountToDatadogRate(name, interval, mapIncreases(matrix, func(increase counterIncrease) model.SampleValue {
+		return increase.value / model.SampleValue(increase.elapsed.Seconds())
+	}))
 }
 
+// mapIncreases replaces the samples of every stream by value applied to its counter increases.
+func mapIncreases(matrix model.Matrix, value func(counterIncrease) model.SampleValue) model.Matrix {
+	out := make(model.Matrix, 0, len(matrix))
+	for _, stream := range matrix {
+		if stream == nil {
+			continue
+		}
+		increases := counterIncreases(stream.Values)
+		values := make([]model.SamplePair, 0, len(increases))
+		for _, increase := range increases {
+			values = append(values, model.SamplePair{Timestamp: increase.end, Value: value(increase)})
+		}
+		out = append(out, &model.SampleStream{Metric: stream.Metric, Values: values})
+	}
+	return out
+}
+
+type counterIncrease struct {
+	end     model.Time
+	elapsed time.Duration
+	value   model.SampleValue
+}
+
+// counterIncreases returns the increase of a counter between consecutive samples. A sample
+// lower than the previous one is a counter reset, the process restarted: the counter counted
+// from zero since, so the increase is clamped to the sample itself rather than a negative
+// delta, which would show as a huge spike. Non-finite samples and samples not after the
+// previous accepted one are skipped, and the next increase is taken from that accepted sample.
+func counterIncreases(values []model.SamplePair) []counterIncrease {
+	increases := make([]counterIncrease, 0, max(len(values)-1, 0))
+	var prev *model.SamplePair
+	for i := range values {
+		cur := values[i]
+		if !isFinite(cur.Value) {
+			continue
+		}
+		if prev == nil {
+			prev = &values[i]
+			continue
+		}
+		elapsed := cur.Timestamp.Sub(prev.Timestamp)
+		if elapsed <= 0 {
+			continue
+		}
+		value := cur.Value - prev.Value
+		if cur.Value < prev.Value {
+			value = cur.Value
+		}
+		increases = append(increases, counterIncrease{end: cur.Timestamp, elapsed: elapsed, value: value})
+		prev = &values[i]
+	}
+	return increases
+}
+
+// PromCountToDatadogCount converts raw counter samples into Datadog count series. Every point
+// counts the increase since the previous point, clamped on counter resets like
+// PromCountToDatadogDerivedRate, so the first point of every stream has no count.
 func PromCountToDatadogCount(name string, matrix model.Matrix) []datadogV2.MetricSeries {
 	metricType := datadogV2.METRICINTAKETYPE_COUNT
+	return matrixToSeries(name, metricType, mapIncreases(matrix, func(increase counterIncrease) model.SampleValue {
+		return increase.value
+	}))
+}
+
+func PromGaugeToDatadogGauge(name string, matrix model.Matrix) []datadogV2.MetricSeries {
+	metricType := datadogV2.METRICINTAKETYPE_GAUGE
 	return matrixToSeries(name, metricType, matrix)
 }
 
+// PromSummaryToDatadogGauge converts the pre-computed quantile series of a summary into one
+// gauge per quantile, named like histogram quantiles. Streams without a valid quantile label
+// are skipped.
+func PromSummaryToDatadogGauge(name string, matrix model.Matrix) []datadogV2.MetricSeries {
+	return QuantileNaming{}.SummaryToGauge(name, matrix)
+}
+
+// matrixToSeries converts every stream to a series, skipping NaN and ±Inf samples which
+// Datadog cannot represent, and nil streams or streams left without a point, such as the
+// all-NaN quantiles of an idle namespace. The label strings, timestamps and values the
+// series point to are allocated once per stream rather than once per label and point, which
+// dominated the allocations of large matrices.
 func matrixToSeries(name string, metricType datadogV2.MetricIntakeType, matrix model.Matrix) []datadogV2.MetricSeries {
-	series := make([]datadogV2.MetricSeries, len(matrix))
-	for i, stream := range matrix {
-		labels := []datadogV2.MetricResource{}
-		for k, v := range stream.Metric {
-			name := string(k)
-			if name == "__rollup__" {
+	series := make([]datadogV2.MetricSeries, 0, len(matrix))
+	for _, stream := range matrix {
+		if stream == nil {
+			continue
+		}
+		points := make([]datadogV2.MetricPoint, 0, len(stream.Values))
+		timestamps := make([]int64, 0, len(stream.Values))
+		values := make([]float64, 0, len(stream.Values))
+		for _, valuePair := range stream.Values {
+			if !isFinite(valuePair.Value) {
 				continue
 			}
-			value := string(v)
-			labels = append(labels, datadogV2.MetricResource{Type: &name, Name: &value})
+			timestamps = append(timestamps, valuePair.Timestamp.Unix())
+			values = append(values, float64(valuePair.Value))
+			points = append(points, datadogV2.MetricPoint{
+				Timestamp: &timestamps[len(timestamps)-1],
+				Value:     &values[len(values)-1],
+			})
+		}
+		if len(points) == 0 {
+			continue
 		}
 
-		points := []datadogV2.MetricPoint{}
-		for _, valuePair := range stream.Values {
-			value := float64(valuePair.Value)
-			if math.IsNaN(value) {
-				value = 0.0
-			}
-			timestamp := valuePair.Timestamp.Unix()
-			point := datadogV2.MetricPoint{
-				Timestamp: &timestamp,
-				Value:     &value,
+		labels := make([]datadogV2.MetricResource, 0, len(stream.Metric))
+		strs := make([]string, 0, 2*len(stream.Metric))
+		for k, v := range stream.Metric {
+			if k == "__rollup__" {
+				continue
 			}
-			points = append(points, point)
+			strs = append(strs, string(k), string(v))
+			labels = append(labels, datadogV2.MetricResource{Type: &strs[len(strs)-2], Name: &strs[len(strs)-1]})
 		}
 
-		series[i] = datadogV2.MetricSeries{
+		series = append(series, datadogV2.MetricSeries{
 			Metric:    name,
 			Type:      metricType.Ptr(),
 			Points:    points,
 			Resources: labels,
-		}
+		})
 	}
 	return series
 }
@@ -1,13 +1,18 @@
 package worker
 
 import (
+	"encoding/binary"
+	"fmt"
 	"math"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Ptr[T any](v T) *T {
@@ -57,7 +62,7 @@ func TestPromHistogramToDatadogGauge(t *testing.T) {
 			},
 		},
 		{
-			name:       "contains NaN vlaues",
+			name:       "contains NaN and Inf values",
 			metricName: "latency",
 			quantile:   0.5,
 			matrix: model.Matrix{
@@ -68,6 +73,10 @@ func TestPromHistogramToDatadogGauge(t *testing.T) {
 							Timestamp: model.Time(time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC).Unix()),
 							Value:     model.SampleValue(math.NaN()),
 						},
+						{
+							Timestamp: model.Time(time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC).Unix()),
+							Value:     model.SampleValue(math.Inf(1)),
+						},
 						{
 							Timestamp: model.Time(time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC).Unix()),
 							Value:     2.0,
@@ -80,7 +89,6 @@ func TestPromHistogramToDatadogGauge(t *testing.T) {
 					Metric: "latency_P50",
 					Type:   datadogV2.METRICINTAKETYPE_GAUGE.Ptr(),
 					Points: []datadogV2.MetricPoint{
-						{Timestamp: Ptr(int64(1257894)), Value: Ptr(float64(0.0))},
 						{Timestamp: Ptr(int64(1257894)), Value: Ptr(float64(2.0))},
 					},
 					Resources: []datadogV2.MetricResource{
@@ -97,6 +105,7 @@ func TestPromHistogramToDatadogGauge(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 			gotSeries := PromHistogramToDatadogGauge(tc.metricName, tc.quantile, tc.matrix)
+			require.Len(t, gotSeries, len(tc.wantSeries))
 			for i := range gotSeries {
 				assert.Equal(t, gotSeries[i].Metric, tc.wantSeries[i].Metric)
 				assert.Equal(t, gotSeries[i].Type, tc.wantSeries[i].Type)
@@ -106,3 +115,357 @@ func TestPromHistogramToDatadogGauge(t *testing.T) {
 		})
 	}
 }
+
+func TestPromCountToDatadogRate(t *testing.T) {
+	matrix := model.Matrix{
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland"},
+			Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(1257894000), Value: 0.5}},
+		},
+	}
+
+	gotSeries := PromCountToDatadogRate("temporal_cloud_v0_frontend_service_request_count", 30*time.Second, matrix)
+	require.Len(t, gotSeries, 1)
+	assert.Equal(t, "temporal_cloud_v0_frontend_service_request_rate1m", gotSeries[0].Metric)
+	assert.Equal(t, datadogV2.METRICINTAKETYPE_RATE.Ptr(), gotSeries[0].Type)
+	assert.Equal(t, Ptr(int64(30)), gotSeries[0].Interval)
+}
+
+func TestPromCountToDatadogDerivedRate(t *testing.T) {
+	matrix := model.Matrix{
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland"},
+			Values: []model.SamplePair{
+				{Timestamp: model.TimeFromUnix(1257894000), Value: 100},
+				{Timestamp: model.TimeFromUnix(1257894060), Value: 160},
+				{Timestamp: model.TimeFromUnix(1257894120), Value: 280},
+				{Timestamp: model.TimeFromUnix(1257894180), Value: 30},
+			},
+		},
+	}
+
+	gotSeries := PromCountToDatadogDerivedRate("temporal_cloud_v0_frontend_service_request_count", time.Minute, matrix)
+	require.Len(t, gotSeries, 1)
+	assert.Equal(t, "temporal_cloud_v0_frontend_service_request_rate1m", gotSeries[0].Metric)
+	assert.Equal(t, datadogV2.METRICINTAKETYPE_RATE.Ptr(), gotSeries[0].Type)
+	assert.Equal(t, Ptr(int64(60)), gotSeries[0].Interval)
+
+	got := []float64{}
+	for _, point := range gotSeries[0].Points {
+		got = append(got, *point.Value)
+	}
+	assert.Equal(t, []float64{1, 2, 0.5}, got, "the first point has no rate and the reset counts from zero")
+	assert.Equal(t, int64(1257894060), *gotSeries[0].Points[0].Timestamp)
+}
+
+func TestCounterIncreasesSuppressResetSpikes(t *testing.T) {
+	at := func(minutes int64) model.Time { return model.TimeFromUnix(1257894000 + 60*minutes) }
+	values := []model.SamplePair{
+		{Timestamp: at(0), Value: 1_000_000},
+		{Timestamp: at(1), Value: 1_000_600},
+		// The process restarted and the counter counted from zero.
+		{Timestamp: at(2), Value: 120},
+		{Timestamp: at(3), Value: 720},
+		// Out of order samples are ignored.
+		{Timestamp: at(3), Value: 0},
+	}
+
+	assert.Equal(t, []counterIncrease{
+		{end: at(1), elapsed: time.Minute, value: 600},
+		{end: at(2), elapsed: time.Minute, value: 120},
+		{end: at(3), elapsed: time.Minute, value: 600},
+	}, counterIncreases(values), "the reset is clamped instead of a -999880 delta")
+
+	series := PromCountToDatadogDerivedRate("requests_count", time.Minute, model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: values}})
+	require.Len(t, series, 1)
+	for _, point := range series[0].Points {
+		assert.LessOrEqual(t, *point.Value, 10.0)
+		assert.GreaterOrEqual(t, *point.Value, 0.0)
+	}
+}
+
+func TestPromCountToDatadogCount(t *testing.T) {
+	at := func(minutes int64) model.Time { return model.TimeFromUnix(1257894000 + 60*minutes) }
+	matrix := model.Matrix{&model.SampleStream{
+		Metric: model.Metric{"temporal_namespace": "disneyland"},
+		Values: []model.SamplePair{
+			{Timestamp: at(0), Value: 1_000_000},
+			{Timestamp: at(1), Value: 1_000_600},
+			// The process restarted and the counter counted from zero.
+			{Timestamp: at(2), Value: 120},
+			{Timestamp: at(3), Value: 720},
+			// A duplicate timestamp is skipped, and not used as the base of the next delta.
+			{Timestamp: at(3), Value: 0},
+			{Timestamp: at(4), Value: 780},
+		},
+	}}
+
+	series := PromCountToDatadogCount("requests_count", matrix)
+	require.Len(t, series, 1)
+	assert.Equal(t, "requests_count", series[0].Metric)
+	assert.Equal(t, datadogV2.METRICINTAKETYPE_COUNT.Ptr(), series[0].Type)
+	got := []float64{}
+	for _, point := range series[0].Points {
+		got = append(got, point.GetValue())
+	}
+	assert.Equal(t, []float64{600, 120, 600, 60}, got, "counts are reset-clamped increases")
+	assert.Equal(t, at(1).Unix(), series[0].Points[0].GetTimestamp(), "the first sample has no count")
+}
+
+func TestPromGaugeToDatadogGauge(t *testing.T) {
+	matrix := model.Matrix{
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland", "__rollup__": "true"},
+			Values: []model.SamplePair{
+				{Timestamp: model.TimeFromUnix(1257894000), Value: 42.0},
+			},
+		},
+	}
+
+	gotSeries := PromGaugeToDatadogGauge("temporal_cloud_v0_pending_tasks", matrix)
+	require.Len(t, gotSeries, 1)
+	assert.Equal(t, "temporal_cloud_v0_pending_tasks", gotSeries[0].Metric)
+	assert.Equal(t, datadogV2.METRICINTAKETYPE_GAUGE.Ptr(), gotSeries[0].Type)
+	assert.ElementsMatch(t, []datadogV2.MetricPoint{
+		{Timestamp: Ptr(int64(1257894000)), Value: Ptr(float64(42.0))},
+	}, gotSeries[0].Points)
+	assert.ElementsMatch(t, []datadogV2.MetricResource{
+		{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")},
+	}, gotSeries[0].Resources)
+}
+
+func TestPromSummaryToDatadogGauge(t *testing.T) {
+	matrix := model.Matrix{
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland", "quantile": "0.5"},
+			Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(1257894000), Value: 1.5}},
+		},
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland", "quantile": "0.99"},
+			Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(1257894000), Value: 9.9}},
+		},
+		&model.SampleStream{
+			Metric: model.Metric{"temporal_namespace": "disneyland"},
+			Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(1257894000), Value: 3.0}},
+		},
+	}
+
+	gotSeries := PromSummaryToDatadogGauge("rpc_latency", matrix)
+	require.Len(t, gotSeries, 2)
+
+	assert.Equal(t, "rpc_latency_P50", gotSeries[0].Metric)
+	assert.Equal(t, "rpc_latency_P99", gotSeries[1].Metric)
+	for i, want := range []float64{1.5, 9.9} {
+		assert.Equal(t, datadogV2.METRICINTAKETYPE_GAUGE.Ptr(), gotSeries[i].Type)
+		assert.ElementsMatch(t, []datadogV2.MetricPoint{
+			{Timestamp: Ptr(int64(1257894000)), Value: Ptr(want)},
+		}, gotSeries[i].Points)
+		assert.ElementsMatch(t, []datadogV2.MetricResource{
+			{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")},
+		}, gotSeries[i].Resources, "quantile label should not be forwarded as a tag")
+	}
+	assert.Equal(t, model.LabelValue("0.99"), matrix[1].Metric["quantile"], "input matrix must not be modified")
+}
+
+func TestPromHistogramToDatadogAverage(t *testing.T) {
+	labels := func(ns, part string) model.Metric {
+		return model.Metric{"temporal_namespace": model.LabelValue(ns), AveragePartLabel: model.LabelValue(part)}
+	}
+	matrix := model.Matrix{
+		&model.SampleStream{
+			Metric: labels("disneyland", "sum"),
+			Values: []model.SamplePair{
+				{Timestamp: model.TimeFromUnix(60), Value: 3.0},
+				{Timestamp: model.TimeFromUnix(120), Value: 5.0},
+				{Timestamp: model.TimeFromUnix(180), Value: 1.0},
+			},
+		},
+		&model.SampleStream{
+			Metric: labels("disneyland", "count"),
+			Values: []model.SamplePair{
+				{Timestamp: model.TimeFromUnix(60), Value: 2.0},
+				{Timestamp: model.TimeFromUnix(120), Value: 0.0},
+			},
+		},
+		&model.SampleStream{
+			Metric: labels("epcot", "count"),
+			Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(60), Value: 4.0}},
+		},
+		&model.SampleStream{
+			Metric: labels("epcot", "sum"),
+			Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(60), Value: 2.0}},
+		},
+	}
+
+	gotSeries := PromHistogramToDatadogAverage("temporal_cloud_v0_service_latency_bucket", matrix)
+	require.Len(t, gotSeries, 2)
+	assert.Equal(t, "temporal_cloud_v0_service_latency.avg", gotSeries[0].Metric)
+	assert.Equal(t, datadogV2.METRICINTAKETYPE_GAUGE.Ptr(), gotSeries[0].Type)
+	// The zero count at 120 and the missing count at 180 are skipped.
+	assert.Equal(t, []datadogV2.MetricPoint{{Timestamp: Ptr(int64(60)), Value: Ptr(1.5)}}, gotSeries[0].Points)
+	assert.Equal(t, []datadogV2.MetricResource{{Type: Ptr("temporal_namespace"), Name: Ptr("disneyland")}}, gotSeries[0].Resources)
+	assert.Equal(t, []datadogV2.MetricPoint{{Timestamp: Ptr(int64(60)), Value: Ptr(0.5)}}, gotSeries[1].Points)
+}
+
+func TestConverterMetricTypes(t *testing.T) {
+	matrix := func(metric model.Metric) model.Matrix {
+		return model.Matrix{&model.SampleStream{
+			Metric: metric,
+			Values: []model.SamplePair{
+				{Timestamp: model.TimeFromUnix(1257894000), Value: 1},
+				{Timestamp: model.TimeFromUnix(1257894060), Value: 2},
+			},
+		}}
+	}
+	plain := matrix(model.Metric{"temporal_namespace": "disneyland"})
+
+	testCases := []struct {
+		name   string
+		series []datadogV2.MetricSeries
+		want   datadogV2.MetricIntakeType
+	}{
+		{name: "histogram quantile", series: PromHistogramToDatadogGauge("latency_bucket", 0.99, plain), want: datadogV2.METRICINTAKETYPE_GAUGE},
+		{name: "rate", series: PromCountToDatadogRate("requests_count", time.Minute, plain), want: datadogV2.METRICINTAKETYPE_RATE},
+		{name: "count", series: PromCountToDatadogCount("requests_count", plain), want: datadogV2.METRICINTAKETYPE_COUNT},
+		{name: "derived rate", series: PromCountToDatadogDerivedRate("requests_count", time.Minute, plain), want: datadogV2.METRICINTAKETYPE_RATE},
+		{name: "gauge", series: PromGaugeToDatadogGauge("pending_tasks", plain), want: datadogV2.METRICINTAKETYPE_GAUGE},
+		{name: "summary", series: PromSummaryToDatadogGauge("rpc_latency", matrix(model.Metric{"quantile": "0.5"})), want: datadogV2.METRICINTAKETYPE_GAUGE},
+		{
+			name: "histogram average",
+			series: PromHistogramToDatadogAverage("latency_bucket", append(
+				matrix(model.Metric{AveragePartLabel: "sum"}),
+				matrix(model.Metric{AveragePartLabel: "count"})...,
+			)),
+			want: datadogV2.METRICINTAKETYPE_GAUGE,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			require.Len(t, tc.series, 1)
+			require.NotNil(t, tc.series[0].Type)
+			assert.Equal(t, tc.want, *tc.series[0].Type)
+		})
+	}
+}
+
+// fuzzMatrix decodes a matrix from fuzzer input: labels holds one stream per line of
+// name=value pairs separated by commas, a line of a single "nil" being a nil stream, and
+// samples holds 16 bytes per sample, a timestamp and a float64, dealt round-robin to the
+// streams.
+func fuzzMatrix(labels string, samples []byte) model.Matrix {
+	matrix := model.Matrix{}
+	for _, line := range strings.Split(labels, "\n") {
+		if line == "nil" {
+			matrix = append(matrix, nil)
+			continue
+		}
+		metric := model.Metric{}
+		for _, pair := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(pair, "=")
+			metric[model.LabelName(name)] = model.LabelValue(value)
+		}
+		matrix = append(matrix, &model.SampleStream{Metric: metric})
+	}
+	for i := 0; len(samples) >= 16; i++ {
+		stream := matrix[i%len(matrix)]
+		if stream != nil {
+			stream.Values = append(stream.Values, model.SamplePair{
+				Timestamp: model.Time(binary.LittleEndian.Uint64(samples)),
+				Value:     model.SampleValue(math.Float64frombits(binary.LittleEndian.Uint64(samples[8:]))),
+			})
+		}
+		samples = samples[16:]
+	}
+	return matrix
+}
+
+func FuzzPromHistogramToDatadogGauge(f *testing.F) {
+	sample := func(ts int64, v float64) []byte {
+		b := binary.LittleEndian.AppendUint64(nil, uint64(ts))
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	f.Add("latency_bucket", 0.99, "operation=StartWorkflowExecution,temporal_namespace=ns", sample(60_000, 0.25))
+	f.Add("latency_bucket", 0.5, "", []byte{})
+	f.Add("", math.NaN(), "nil\n=\n__rollup__=true", append(sample(-1, math.Inf(1)), sample(math.MaxInt64, math.NaN())...))
+	f.Add("latency", -1.5, "le=+Inf\nle=", append(sample(0, -0.0), sample(1, math.MaxFloat64)...))
+
+	f.Fuzz(func(t *testing.T, name string, quantile float64, labels string, samples []byte) {
+		matrix := fuzzMatrix(labels, samples)
+		series := PromHistogramToDatadogGauge(name, quantile, matrix)
+
+		require.NotNil(t, series)
+		streams := 0
+		for _, stream := range matrix {
+			if stream != nil && slices.ContainsFunc(stream.Values, func(p model.SamplePair) bool { return isFinite(p.Value) }) {
+				streams++
+			}
+		}
+		require.Len(t, series, streams, "one series per stream with a finite sample")
+		for _, s := range series {
+			assert.True(t, strings.HasPrefix(s.Metric, strings.TrimSuffix(name, "_bucket")))
+			assert.Equal(t, datadogV2.METRICINTAKETYPE_GAUGE, s.GetType())
+			require.NotEmpty(t, s.Points)
+			for _, p := range s.Points {
+				require.NotNil(t, p.Timestamp)
+				require.NotNil(t, p.Value)
+				assert.True(t, isFinite(model.SampleValue(*p.Value)), "non-finite value %v", *p.Value)
+			}
+			for _, r := range s.Resources {
+				require.NotNil(t, r.Name)
+				require.NotNil(t, r.Type)
+			}
+		}
+	})
+}
+
+// benchmarkMatrix returns streams of samples each, labelled like Temporal Cloud series.
+func benchmarkMatrix(streams, samples int) model.Matrix {
+	matrix := make(model.Matrix, streams)
+	for i := range matrix {
+		values := make([]model.SamplePair, samples)
+		for j := range values {
+			values[j] = model.SamplePair{Timestamp: model.Time(j * 60_000), Value: model.SampleValue(j)}
+		}
+		matrix[i] = &model.SampleStream{Metric: model.Metric{
+			"temporal_namespace": model.LabelValue(fmt.Sprintf("ns-%d", i%10)),
+			"operation":          model.LabelValue(fmt.Sprintf("Operation%d", i)),
+			"temporal_account":   "account",
+		}, Values: values}
+	}
+	return matrix
+}
+
+var benchmarkSizes = []struct{ streams, samples int }{{10, 10}, {100, 10}, {100, 100}, {1000, 60}}
+
+func benchmarkConversion(b *testing.B, convert func(model.Matrix) []datadogV2.MetricSeries) {
+	for _, size := range benchmarkSizes {
+		matrix := benchmarkMatrix(size.streams, size.samples)
+		b.Run(fmt.Sprintf("%dx%d", size.streams, size.samples), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				convert(matrix)
+			}
+		})
+	}
+}
+
+func BenchmarkPromHistogramToDatadogGauge(b *testing.B) {
+	benchmarkConversion(b, func(matrix model.Matrix) []datadogV2.MetricSeries {
+		return PromHistogramToDatadogGauge("latency_bucket", 0.99, matrix)
+	})
+}
+
+func BenchmarkPromCountToDatadogRate(b *testing.B) {
+	benchmarkConversion(b, func(matrix model.Matrix) []datadogV2.MetricSeries {
+		return PromCountToDatadogRate("requests_count", time.Minute, matrix)
+	})
+}
+
+func BenchmarkPromCountToDatadogCount(b *testing.B) {
+	benchmarkConversion(b, func(matrix model.Matrix) []datadogV2.MetricSeries {
+		return PromCountToDatadogCount("requests_count", matrix)
+	})
+}
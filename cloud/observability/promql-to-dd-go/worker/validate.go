@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Validate checks the configuration before Run, RunOnce or Backfill, reporting every problem
+// at once, one per line, rather than failing on the first cycle. Endpoints are validated when
+// their clients are built, see prometheus.ValidateEndpoint.
+func (w *Worker) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if w.Submitter == nil {
+		fail("no submitter configured, at least one output is required")
+	}
+	if len(w.Sources) == 0 {
+		if w.Querier == nil {
+			fail("no Prometheus querier configured")
+		}
+		if len(w.MetricPrefixes) == 0 && w.MetricPrefix == "" {
+			fail("metric prefix is empty, set it to the prefix of the exported metrics such as temporal_cloud_v0_")
+		}
+		for i, prefix := range w.MetricPrefixes {
+			if prefix == "" {
+				fail("metric prefix %d is empty", i+1)
+			}
+		}
+	}
+	for i, source := range w.Sources {
+		if source.Querier == nil {
+			fail("source %d (%s) has no Prometheus querier", i+1, source.name())
+		}
+		if source.MetricPrefix == "" {
+			fail("source %d (%s) has an empty metric prefix", i+1, source.name())
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"step duration", w.StepDuration},
+		{"query interval", w.QueryInterval},
+		{"sleep duration", w.SleepDuration},
+	} {
+		if d.value <= 0 {
+			fail("%s must be positive, got %s", d.name, d.value)
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"rate window", w.RateWindow},
+		{"scrape interval", w.ScrapeInterval},
+		{"query timeout", w.QueryTimeout},
+		{"query retry backoff", w.QueryRetryBackoff},
+		{"breaker open duration", w.BreakerOpenDuration},
+		{"retry backoff base", w.RetryBackoffBase},
+		{"retry backoff max", w.RetryBackoffMax},
+		{"query delay", w.QueryDelay},
+		{"max sample age", w.MaxSampleAge},
+		{"drain timeout", w.DrainTimeout},
+		{"checkpoint max age", w.CheckpointMaxAge},
+		{"min step duration", w.MinStepDuration},
+		{"max step duration", w.MaxStepDuration},
+	} {
+		if d.value < 0 {
+			fail("%s must not be negative, got %s", d.name, d.value)
+		}
+	}
+	if w.RetryBackoffBase > 0 && w.RetryBackoffMax > 0 && w.RetryBackoffMax < w.RetryBackoffBase {
+		fail("retry backoff max %s is lower than the retry backoff base %s", w.RetryBackoffMax, w.RetryBackoffBase)
+	}
+	if w.MinStepDuration > 0 && w.MaxStepDuration > 0 && w.MaxStepDuration < w.MinStepDuration {
+		fail("max step duration %s is lower than the min step duration %s", w.MaxStepDuration, w.MinStepDuration)
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"query concurrency", w.QueryConcurrency},
+		{"max query steps", w.MaxQuerySteps},
+		{"query retries", w.QueryRetries},
+		{"adaptive step points", w.AdaptiveStepPoints},
+		{"max series per metric", w.MaxSeriesPerMetric},
+		{"empty query cycles", w.EmptyQueryCycles},
+		{"max points per cycle", w.MaxPointsPerCycle},
+		{"breaker failure threshold", w.BreakerFailureThreshold},
+		{"max consecutive failures", w.MaxConsecutiveFailures},
+	} {
+		if n.value < 0 {
+			fail("%s must not be negative, got %d", n.name, n.value)
+		}
+	}
+
+	if err := ValidateQuantiles(w.Quantiles); err != nil {
+		errs = append(errs, err)
+	}
+	for _, o := range w.QuantileOverrides {
+		if err := ValidateQuantiles(o.Quantiles); err != nil {
+			errs = append(errs, fmt.Errorf("quantile override %s: %w", o, err))
+		}
+	}
+	if err := ValidateOverlapFactor(w.OverlapFactor); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ValidateJitter(w.Jitter); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ParseQuantileNaming(string(w.QuantileNaming.Style), w.QuantileNaming.Tag); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ParseCardinalityAction(string(w.CardinalityAction)); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ParseNonFinitePolicy(string(w.NonFinite)); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validWorker() Worker {
+	return Worker{
+		Querier:       &fakeQuerier{},
+		Submitter:     &fakeSubmitter{},
+		MetricPrefix:  "temporal_cloud_v0_",
+		Quantiles:     []float64{0.5, 0.99},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		SleepDuration: 10 * time.Minute,
+	}
+}
+
+func TestWorkerValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		modify  func(w *Worker)
+		wantErr string
+	}{
+		{name: "no submitter", modify: func(w *Worker) { w.Submitter = nil }, wantErr: "no submitter configured"},
+		{name: "no querier", modify: func(w *Worker) { w.Querier = nil }, wantErr: "no Prometheus querier configured"},
+		{name: "empty prefix", modify: func(w *Worker) { w.MetricPrefix = "" }, wantErr: "metric prefix is empty"},
+		{name: "empty prefix in list", modify: func(w *Worker) { w.MetricPrefixes = []string{"a_", ""} }, wantErr: "metric prefix 2 is empty"},
+		{name: "source without querier", modify: func(w *Worker) { w.Sources = []Source{{Name: "eu", MetricPrefix: "a_"}} }, wantErr: "source 1 (eu) has no Prometheus querier"},
+		{name: "source without prefix", modify: func(w *Worker) { w.Sources = []Source{{Querier: &fakeQuerier{}}} }, wantErr: "source 1 () has an empty metric prefix"},
+		{name: "zero step", modify: func(w *Worker) { w.StepDuration = 0 }, wantErr: "step duration must be positive, got 0s"},
+		{name: "zero query interval", modify: func(w *Worker) { w.QueryInterval = 0 }, wantErr: "query interval must be positive"},
+		{name: "negative sleep", modify: func(w *Worker) { w.SleepDuration = -time.Second }, wantErr: "sleep duration must be positive, got -1s"},
+		{name: "negative rate window", modify: func(w *Worker) { w.RateWindow = -time.Minute }, wantErr: "rate window must not be negative"},
+		{name: "negative query timeout", modify: func(w *Worker) { w.QueryTimeout = -time.Second }, wantErr: "query timeout must not be negative"},
+		{name: "negative query delay", modify: func(w *Worker) { w.QueryDelay = -time.Minute }, wantErr: "query delay must not be negative"},
+		{name: "inverted backoff", modify: func(w *Worker) { w.RetryBackoffBase, w.RetryBackoffMax = time.Minute, time.Second }, wantErr: "retry backoff max 1s is lower"},
+		{name: "negative concurrency", modify: func(w *Worker) { w.QueryConcurrency = -1 }, wantErr: "query concurrency must not be negative"},
+		{name: "negative failures", modify: func(w *Worker) { w.MaxConsecutiveFailures = -1 }, wantErr: "max consecutive failures must not be negative"},
+		{name: "quantile one", modify: func(w *Worker) { w.Quantiles = []float64{0.5, 1} }, wantErr: "invalid quantile 1"},
+		{name: "overlap factor", modify: func(w *Worker) { w.OverlapFactor = 0.5 }, wantErr: "overlap factor must be at least 1"},
+		{name: "jitter", modify: func(w *Worker) { w.Jitter = 0.8 }, wantErr: "jitter must be between 0 and 0.5"},
+		{name: "quantile naming", modify: func(w *Worker) { w.QuantileNaming = QuantileNaming{Style: QuantileStyleNone} }, wantErr: "requires the quantile tag"},
+		{name: "cardinality action", modify: func(w *Worker) { w.CardinalityAction = "explode" }, wantErr: "unknown cardinality action"},
+		{name: "non-finite policy", modify: func(w *Worker) { w.NonFinite = "nan" }, wantErr: "unknown non-finite policy"},
+	}
+
+	valid := validWorker()
+	require.NoError(t, valid.Validate())
+	for _, tc := range testCases {
+		w := validWorker()
+		tc.modify(&w)
+		assert.ErrorContains(t, w.Validate(), tc.wantErr, tc.name)
+	}
+}
+
+func TestWorkerValidateAggregatesErrors(t *testing.T) {
+	w := Worker{}
+	err := w.Validate()
+	require.Error(t, err)
+	lines := strings.Split(err.Error(), "\n")
+	assert.Equal(t, []string{
+		"no submitter configured, at least one output is required",
+		"no Prometheus querier configured",
+		"metric prefix is empty, set it to the prefix of the exported metrics such as temporal_cloud_v0_",
+		"step duration must be positive, got 0s",
+		"query interval must be positive, got 0s",
+		"sleep duration must be positive, got 0s",
+	}, lines)
+}
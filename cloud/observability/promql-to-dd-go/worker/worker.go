@@ -1,12 +1,20 @@
 package worker
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
 
 	"github.com/temporalio/promql-to-dd-go/datadog"
 	"github.com/temporalio/promql-to-dd-go/prometheus"
@@ -15,120 +23,534 @@ import (
 type Worker struct {
 	prometheus.Querier
 	datadog.Submitter
-	MetricPrefix  string
-	Quantiles     []float64
-	QueryInterval time.Duration
-	StepDuration  time.Duration
-	SleepDuration time.Duration
+	MetricPrefix string
+	// MetricPrefixes are queried in turn with the embedded Querier, instead of MetricPrefix.
+	MetricPrefixes []string
+	// PrefixTag is an optional tag key; when set, series of MetricPrefixes are tagged
+	// <PrefixTag>:<prefix>.
+	PrefixTag string
+	// Sources lists the Prometheus endpoints queried each cycle. When empty, the embedded
+	// Querier is queried with MetricPrefixes, or MetricPrefix.
+	Sources []Source
+	// Tags are added to every series, such as tenant:<name> for the worker of a Tenant.
+	Tags []string
+	// Quantiles are the histogram quantiles exported, typically 0.5, 0.9, 0.95 and 0.99.
+	// Values outside (0, 1) are ignored, see ValidateQuantile.
+	Quantiles []float64
+	// QuantileOverrides replaces Quantiles for matching histograms.
+	QuantileOverrides QuantileOverrides
+	QueryInterval     time.Duration
+	StepDuration      time.Duration
+	// AdaptiveStepPoints derives the step of every range from its length instead of using
+	// StepDuration, targeting that many points per series and query. The step is bounded by
+	// MinStepDuration and MaxStepDuration, which default to DefaultMinStepDuration and
+	// DefaultMaxStepDuration. Disabled when zero.
+	AdaptiveStepPoints int
+	MinStepDuration    time.Duration
+	MaxStepDuration    time.Duration
+	SleepDuration      time.Duration
+	// Jitter shifts every cycle by a random offset of up to Jitter·SleepDuration either way,
+	// so that replicas do not query and submit in lockstep. At most 0.5.
+	Jitter float64
+	// QuantileNaming controls how quantiles are encoded in metric names and tags.
+	QuantileNaming QuantileNaming
+	// OverlapFactor stretches QueryInterval into QueryWindow. More overlap avoids gaps for
+	// high-churn metrics, less reduces duplicates. Must be at least 1, defaults to
+	// DefaultOverlapFactor.
+	OverlapFactor float64
+	// QueryDelay shifts the end of every range into the past, so that samples ingested late
+	// by Prometheus are queried once they arrived rather than missed. Disabled when zero.
+	QueryDelay time.Duration
+	// MaxSampleAge drops the samples older than that before conversion, such as those of a
+	// range stretched back by failed cycles, which the output would reject anyway; Datadog
+	// rejects points older than datadog.MaxPointAge. Disabled when zero.
+	MaxSampleAge time.Duration
+	// RateWindow is the range selector used inside rate(). Defaults to DefaultRateWindow.
+	RateWindow time.Duration
+	// HistogramGroupBy lists the labels histograms are aggregated by. "le" is always added.
+	HistogramGroupBy []string
+	// HistogramUnits converts the quantiles and averages of matching histograms from seconds
+	// and declares their Datadog unit. Histograms matching no rule are exported unchanged.
+	HistogramUnits UnitRules
+	// HistogramAverage additionally emits the mean of every histogram as <metric>.avg,
+	// computed from the rates of its _sum and _count series.
+	HistogramAverage bool
+	// HistogramCountSum forwards the _count of every histogram as a Datadog count and its _sum
+	// as a gauge. Both are then skipped by the counter and gauge paths, which would otherwise
+	// export them as well since their names match the counter and gauge heuristics.
+	HistogramCountSum bool
+	// DeriveCounterRates computes the rate of every counter from its raw series instead of a
+	// separate rate() query, halving the counter queries. The derived rate is evaluated over
+	// one step rather than RateWindow.
+	DeriveCounterRates bool
+	// CombineQuantiles queries all the quantiles of a histogram at once, the union of the
+	// quantile queries, instead of one query per quantile. The series are the same, split on
+	// conversion, but a failure or timeout then loses every quantile of the histogram.
+	CombineQuantiles bool
+	// DisableHistograms skips the queries of histograms, quantiles, averages and
+	// HistogramCountSum alike, for users only interested in throughput; their _count and _sum
+	// are then exported like any counter and gauge. DisableCounters skips the queries of
+	// counters, for users only interested in latencies; the _count of histograms is then only
+	// forwarded by HistogramCountSum.
+	DisableHistograms bool
+	DisableCounters   bool
+	// InstantGauges queries gauges with a single instant query at the end of every range,
+	// rather than a range query, exporting one point per cycle instead of one per step.
+	InstantGauges bool
+	// NamespaceAllow and NamespaceDeny are regular expressions matched server-side against the
+	// temporal_namespace label of every query. Deny takes precedence when both match.
+	NamespaceAllow []string
+	NamespaceDeny  []string
+	// OperationFilter lists regular expressions of operations excluded server-side, for
+	// operations dominating cardinality. Series without an operation label are kept.
+	OperationFilter []string
+	// MaxSeriesPerMetric is the number of distinct tag sets a metric may have within a cycle
+	// and source, a guard against label explosions driving up Datadog custom metrics.
+	// Exceeding metrics are handled according to CardinalityAction. Disabled when zero.
+	MaxSeriesPerMetric int
+	CardinalityAction  CardinalityAction
+	// EmptyQueryCycles is the number of cycles in a row all queries of a discovered metric
+	// must return no series before it is reported as empty. Defaults to
+	// DefaultEmptyQueryCycles.
+	EmptyQueryCycles int
+	// MaxPointsPerCycle bounds the points converted within a cycle across all sources, a guard
+	// against matrices large enough to exhaust memory. The points beyond it are dropped with a
+	// warning. Disabled when zero.
+	MaxPointsPerCycle int
+	// AllLabelsAsTags additionally maps every label to a key:value Datadog tag, sanitized to
+	// Datadog's tag rules.
+	AllLabelsAsTags bool
+	// QueryTemplates overrides the default PromQL of matching metrics.
+	QueryTemplates QueryTemplates
+	// Relabeling maps Prometheus labels onto Datadog tags for every converted series.
+	Relabeling Relabeling
+	// NamespaceTag and OperationTag rename the NamespaceLabel and OperationLabel tag keys of
+	// the converted series, such as namespace for temporal_namespace. Queries keep using the
+	// Prometheus label names. Rules of Relabeling for the same labels take precedence.
+	NamespaceTag string
+	OperationTag string
+	// Naming rewrites the Datadog metric names of every converted series.
+	Naming NameTransform
+	// ScrapeInterval is the resolution of the source metrics, used to sanity check RateWindow.
+	ScrapeInterval time.Duration
+	// QueryConcurrency bounds the number of in-flight Prometheus queries. Defaults to 1.
+	QueryConcurrency int
+	// QueryTimeout bounds every single Prometheus query. Defaults to DefaultQueryTimeout.
+	// A timed out query is logged and skipped unless AbortOnQueryTimeout is set, and its
+	// range is queried again by the next cycle.
+	QueryTimeout        time.Duration
+	AbortOnQueryTimeout bool
+	// QueryRetries repeats a query failing with a Prometheus server or network error that many
+	// times before failing the cycle, waiting an exponential backoff from QueryRetryBackoff,
+	// which defaults to DefaultQueryRetryBackoff. Independent of the retries of failed cycles
+	// and submissions. Disabled when zero.
+	QueryRetries      int
+	QueryRetryBackoff time.Duration
+	// BestEffortQueries submits the series of the successful queries when some fail, instead
+	// of failing the whole cycle upfront. The cycle still reports the failed queries.
+	BestEffortQueries bool
+	// MaxQuerySteps splits ranges evaluating more steps into several queries whose results
+	// are concatenated. Defaults to DefaultMaxQuerySteps.
+	MaxQuerySteps int
+	// BreakerFailureThreshold opens a circuit breaker after that many failed submissions in a
+	// row, skipping submissions for BreakerOpenDuration before probing with a single one.
+	// Disabled when zero.
+	BreakerFailureThreshold int
+	// BreakerOpenDuration defaults to DefaultBreakerOpenDuration.
+	BreakerOpenDuration time.Duration
+	// RetryBackoffBase and RetryBackoffMax bound the exponential backoff applied after failed
+	// cycles. They default to DefaultRetryBackoffBase and DefaultRetryBackoffMax.
+	RetryBackoffBase time.Duration
+	RetryBackoffMax  time.Duration
+	// MaxConsecutiveFailures makes Run give up after that many failed cycles in a row.
+	// Zero retries forever.
+	MaxConsecutiveFailures int
+	// Checkpoint persists the end of the last fully submitted range, so that a restarted
+	// worker resumes from it rather than from the query window alone. CheckpointMaxAge bounds
+	// how far back a restored checkpoint reaches, unlimited when zero.
+	Checkpoint       CheckpointStore
+	CheckpointMaxAge time.Duration
+	// DrainTimeout bounds a final submission of the series already converted when ctx is
+	// cancelled mid-cycle, which would otherwise be lost; Run waits for it before returning.
+	// Disabled when zero.
+	DrainTimeout time.Duration
+	// Reloads delivers new Settings while Run is running. They are applied between cycles,
+	// never to a cycle in flight, and the changes logged. Nil disables reloading.
+	Reloads <-chan Settings
+	// Metrics records self-observability metrics, nil disables them.
+	Metrics *Metrics
+	// DryRun runs the full query and conversion pipeline but logs the series instead of
+	// submitting them. DryRunJSON additionally logs every series as JSON.
+	DryRun     bool
+	DryRunJSON bool
+	// NonFinite controls whether NaN and ±Inf samples are dropped or submitted as 0.
+	// Defaults to NonFiniteSkip.
+	NonFinite NonFinitePolicy
+	// Deduplicate merges identical series and collapses points sharing a timestamp before
+	// submission, at the cost of holding an index of all points in memory.
+	Deduplicate bool
+	// Logger receives the worker's logs. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	status   status
+	coverage coverage
+	empty    emptyMetrics
+	breaker  breaker
+	paused   atomic.Bool
 }
 
 const (
-	HistogramPromQL = "histogram_quantile(%.2f, sum(rate(%s[1m])) by (temporal_namespace,operation,le))"
-	RatePromQL      = "rate(%s[1m])"
-	RetryInterval   = 3 * time.Second
+	HistogramPromQL   = "histogram_quantile(%g, sum(rate(%s[%s])) by (%s))"
+	RatePromQL        = "rate(%s[%s])"
+	DefaultRateWindow = time.Minute
+	// DefaultOverlapFactor is used when OverlapFactor is not set, a 20% range overlap
+	// between consecutive queries.
+	DefaultOverlapFactor = 1.2
+	// DefaultQueryTimeout is used when QueryTimeout is not set.
+	DefaultQueryTimeout = 10 * time.Second
+	// DefaultMaxQuerySteps is Prometheus' limit of points per series of a range query.
+	DefaultMaxQuerySteps = 11000
+	// DefaultMinStepDuration and DefaultMaxStepDuration bound adaptive steps when
+	// MinStepDuration and MaxStepDuration are not set.
+	DefaultMinStepDuration = 15 * time.Second
+	DefaultMaxStepDuration = time.Hour
 )
 
-func (w *Worker) Run() {
-	interrupt := interruptCh()
-	ticker := time.NewTicker(w.SleepDuration)
-	defer ticker.Stop()
+// DefaultHistogramGroupBy is used when HistogramGroupBy is empty.
+var DefaultHistogramGroupBy = []string{"temporal_namespace", "operation"}
+
+// ErrTooManyFailures is returned by Run when MaxConsecutiveFailures cycles failed in a row.
+var ErrTooManyFailures = errors.New("too many consecutive failures")
+
+// Run executes cycles until ctx is cancelled, in which case it returns nil, or until
+// MaxConsecutiveFailures cycles failed in a row, in which case it returns ErrTooManyFailures
+// wrapping the last error.
+func (w *Worker) Run(ctx context.Context) error {
+	w.checkConfig()
+
+	ticks := newSchedule(time.Now(), w.SleepDuration, w.Jitter)
 	errs := make(chan error, 1)
+	retry := newBackoff(w.RetryBackoffBase, w.RetryBackoffMax)
+	failures := 0
 
 	for {
-		go w.do(errs)
+		go w.do(ctx, errs)
 
+		var wait <-chan time.Time
 		select {
 		case err := <-errs:
-			log.Println("Worker failed:", err)
-			time.Sleep(RetryInterval)
-		case <-ticker.C:
-			continue
-		case s := <-interrupt:
-			log.Println("Worker has been stopped.", "Signal", s)
-			return
+			if err == nil {
+				w.status.recordSuccess(time.Now())
+				retry.Reset()
+				failures = 0
+				delay := ticks.next(time.Now())
+				w.logger().Debug("Awaiting next tick", "interval", w.SleepDuration, "in", delay)
+				wait = time.After(delay)
+				break
+			}
+			w.status.recordFailure(time.Now())
+			failures++
+			if w.MaxConsecutiveFailures > 0 && failures >= w.MaxConsecutiveFailures {
+				w.logger().Error("Worker giving up", "error", err, "consecutive_failures", failures)
+				return fmt.Errorf("%w (%d): %w", ErrTooManyFailures, failures, err)
+			}
+			delay := retry.Next()
+			w.logger().Error("Worker failed", "error", err, "retry_in", delay)
+			wait = time.After(delay)
+		case <-ctx.Done():
+			w.awaitDrain(errs)
+			w.logger().Info("Worker has been stopped", "reason", ctx.Err())
+			return nil
+		}
+
+	waiting:
+		for {
+			select {
+			case <-wait:
+				break waiting
+			case settings := <-w.Reloads:
+				w.reload(settings)
+			case <-ctx.Done():
+				w.logger().Info("Worker has been stopped", "reason", ctx.Err())
+				return nil
+			}
 		}
 	}
 }
 
+// RunOnce executes a single cycle, for cron style scheduling, and returns its error.
+func (w *Worker) RunOnce(ctx context.Context) error {
+	w.checkConfig()
+	errs := make(chan error, 1)
+	w.do(ctx, errs)
+	err := <-errs
+	if err != nil {
+		w.status.recordFailure(time.Now())
+		return err
+	}
+	w.status.recordSuccess(time.Now())
+	return nil
+}
+
+// checkConfig logs a warning for every setting combination that silently degrades the data.
+func (w *Worker) checkConfig() {
+	if err := ValidateQuantiles(w.Quantiles); err != nil {
+		w.logger().Warn("Ignoring invalid quantiles", "quantiles", w.Quantiles, "error", err)
+	}
+
+	if w.ScrapeInterval > 0 && w.rateWindow() < w.ScrapeInterval {
+		w.logger().Warn("Rate window is smaller than the scrape interval, rates may be empty",
+			"rate_window", model.Duration(w.rateWindow()), "scrape_interval", model.Duration(w.ScrapeInterval))
+	}
+
+	window := w.QueryWindow()
+	step := w.StepDuration
+	if w.AdaptiveStepPoints > 0 {
+		step = w.stepFor(window)
+	}
+	switch {
+	case step > window:
+		w.logger().Warn("Step duration is larger than the query window, cycles yield at most one point per series; lower the step or raise the query interval",
+			"step", model.Duration(step), "query_window", model.Duration(window))
+	case step > 0 && window%step != 0:
+		w.logger().Warn("Query window is not a multiple of the step duration, points may be unevenly spaced across cycles",
+			"step", model.Duration(step), "query_window", model.Duration(window))
+	}
+}
+
+// QueryWindow is the range covered by a cycle: QueryInterval stretched by the overlap factor so
+// consecutive cycles overlap.
 func (w *Worker) QueryWindow() time.Duration {
-	return time.Duration(w.QueryInterval.Seconds()*1.2) * time.Second // 20% range overlap between queries
+	return time.Duration(w.QueryInterval.Seconds()*w.overlapFactor()) * time.Second
 }
 
-func (w *Worker) do(errorChan chan<- error) {
-	queryRange := w.calcRange()
-	histograms, counters, err := w.ListMetrics(w.MetricPrefix)
-	if err != nil {
-		panic(err)
-	}
-
-	log.Printf("Querying Prometheus\n")
-	log.Printf("Found %d histogram metrics: %v\n", len(histograms), histograms)
-	log.Printf("Found %d counter metrics: %v\n", len(counters), counters)
-
-	histogramSeries := []datadogV2.MetricSeries{}
-	// histograms
-	for _, quantile := range w.Quantiles {
-		for _, bucketName := range histograms {
-			promql := fmt.Sprintf(HistogramPromQL, quantile, bucketName)
-			matrix, err := w.QueryMetrics(promql, queryRange)
-			if err != nil {
-				errorChan <- err
-				return
-			}
-			histogramSeries = append(histogramSeries, PromHistogramToDatadogGauge(bucketName, quantile, matrix)...)
+func (w *Worker) overlapFactor() float64 {
+	if w.OverlapFactor == 0 {
+		return DefaultOverlapFactor
+	}
+	return w.OverlapFactor
+}
+
+// ValidateOverlapFactor checks that the factor does not shrink the query window below the
+// query interval, which would leave gaps between cycles. Zero selects the default.
+func ValidateOverlapFactor(factor float64) error {
+	if factor != 0 && !(factor >= 1) {
+		return fmt.Errorf("overlap factor must be at least 1, got %v", factor)
+	}
+	return nil
+}
+
+// relabeling returns Relabeling extended with the NamespaceTag and OperationTag renames.
+func (w *Worker) relabeling() Relabeling {
+	return w.Relabeling.withRename(NamespaceLabel, w.NamespaceTag).withRename(OperationLabel, w.OperationTag)
+}
+
+func (w *Worker) logger() *slog.Logger {
+	if w.Logger == nil {
+		return slog.Default()
+	}
+	return w.Logger
+}
+
+func (w *Worker) rateWindow() time.Duration {
+	if w.RateWindow <= 0 {
+		return DefaultRateWindow
+	}
+	return w.RateWindow
+}
+
+func (w *Worker) histogramGroupBy() []string {
+	labels := w.HistogramGroupBy
+	if len(labels) == 0 {
+		labels = DefaultHistogramGroupBy
+	}
+	groupBy := make([]string, 0, len(labels)+1)
+	for _, label := range labels {
+		if label != "le" {
+			groupBy = append(groupBy, label)
 		}
 	}
-	log.Printf("Received %d histogram series\n", len(histogramSeries))
+	return append(groupBy, "le")
+}
 
-	// rates
-	rateSeries := []datadogV2.MetricSeries{}
-	// counts
-	countSeries := []datadogV2.MetricSeries{}
-	for _, counterName := range counters {
-		// Query and submit rate metrics
-		promql := fmt.Sprintf(RatePromQL, counterName)
-		matrix, err := w.QueryMetrics(promql, queryRange)
-		if err != nil {
-			errorChan <- err
-			return
+func (w *Worker) histogramPromQL(quantile float64, bucketName string) string {
+	return w.promql(bucketName, quantile,
+		fmt.Sprintf(HistogramPromQL, quantile, w.selector(bucketName), model.Duration(w.rateWindow()), strings.Join(w.histogramGroupBy(), ",")))
+}
+
+// histogramQuantilesPromQL returns the quantiles of a histogram in a single query, the union of
+// the histogramPromQL of every quantile, each tagged with QuantilePartLabel.
+func (w *Worker) histogramQuantilesPromQL(quantiles []float64, bucketName string) string {
+	parts := make([]string, len(quantiles))
+	for i, quantile := range quantiles {
+		parts[i] = fmt.Sprintf(`label_replace(%s, "%s", "%s", "", "")`,
+			w.histogramPromQL(quantile, bucketName), QuantilePartLabel, strconv.FormatFloat(quantile, 'f', -1, 64))
+	}
+	return strings.Join(parts, " or ")
+}
+
+// histogramAveragePromQL returns the rates of the _sum and _count series of a histogram in a
+// single query, each half tagged with AveragePartLabel so the division happens on conversion
+// and a zero count can be skipped instead of yielding NaN.
+func (w *Worker) histogramAveragePromQL(bucketName string) string {
+	base := strings.TrimSuffix(bucketName, "_bucket")
+	groupBy := w.histogramGroupBy()
+	groupBy = groupBy[:len(groupBy)-1] // drop "le"
+	part := func(suffix, value string) string {
+		return fmt.Sprintf(`label_replace(sum(rate(%s[%s])) by (%s), "%s", "%s", "", "")`,
+			w.selector(base+suffix), model.Duration(w.rateWindow()), strings.Join(groupBy, ","), AveragePartLabel, value)
+	}
+	return part("_sum", "sum") + " or " + part("_count", "count")
+}
+
+func (w *Worker) ratePromQL(counterName string) string {
+	return w.promql(counterName, 0, fmt.Sprintf(RatePromQL, w.selector(counterName), model.Duration(w.rateWindow())))
+}
+
+// do runs a single query-and-submit cycle and reports its outcome on errorChan,
+// sending nil when the cycle succeeded.
+func (w *Worker) do(ctx context.Context, errorChan chan<- error) {
+	result, err := w.Reconcile(ctx)
+	w.logger().Debug("Cycle finished", "start", result.Range.Start, "end", result.Range.End,
+		"series", result.Submitted, "status", result.Status, "error", err)
+	if summary := result.QuerySummary(); summary.Queries > 0 {
+		w.logger().Debug("Query summary", "queries", summary.Queries, "duration", summary.Duration, "samples", summary.Samples,
+			"slowest", summary.Slowest.PromQL, "slowest_duration", summary.Slowest.Duration,
+			"largest", summary.Largest.PromQL, "largest_samples", summary.Largest.Samples)
+	}
+	errorChan <- err
+}
+
+// Reconcile runs a single cycle over the range following the previous cycles and reports what
+// it did. The range is marked as covered only when the cycle fully succeeded, without a
+// skipped query; when only some queries failed or timed out, those that succeeded are marked
+// as covered on their own, so that the next cycles do not submit their series again.
+func (w *Worker) Reconcile(ctx context.Context) (Result, error) {
+	start := time.Now()
+	defer func() { w.Metrics.observeCycleDuration(time.Since(start)) }()
+
+	w.restoreCheckpoint(start)
+	queryRange := w.calcRange(time.Now())
+	result, err := w.process(ctx, queryRange)
+	skipped := slices.ContainsFunc(result.Queries, func(st QueryStats) bool { return st.Err != nil })
+	switch {
+	case err == nil && !skipped:
+		w.coverage.advance(queryRange.End)
+		w.saveCheckpoint(w.coverage.end())
+	case result.Status != SubmissionNotAttempted && result.Status != SubmissionFailed:
+		for _, st := range result.Queries {
+			if st.Err == nil {
+				w.coverage.advanceQuery(queryKey{source: st.Source, promql: st.PromQL}, queryRange.End)
+			}
 		}
-		rateSeries = append(rateSeries, PromCountToDatadogRate(counterName, matrix)...)
+	}
+	return result, err
+}
 
-		// Query and submit raw count metrics
-		matrix, err = w.QueryMetrics(counterName, queryRange)
+// process queries, converts and submits every source over queryRange. A failed source fails
+// the range even though the others were submitted.
+func (w *Worker) process(ctx context.Context, queryRange promapi.Range) (Result, error) {
+	result := Result{Range: queryRange, Series: map[string]int{}}
+	series := []datadogV2.MetricSeries{}
+	var sourceErrs []error
+	budget := newPointBudget(w.MaxPointsPerCycle)
+	// cancelled is set when ctx was cancelled before every source was collected; the series of
+	// the collected ones are then still drained when DrainTimeout is set.
+	var cancelled error
+	for _, source := range w.sources() {
+		if err := ctx.Err(); err != nil {
+			cancelled = err
+			break
+		}
+		sourceSeries, err := w.collect(ctx, source, queryRange, budget, &result)
 		if err != nil {
-			errorChan <- err
-			return
+			if ctx.Err() != nil {
+				cancelled = err
+				break
+			}
+			w.logger().Error("Source failed", "source", source.name(), "error", err)
+			sourceErrs = append(sourceErrs, fmt.Errorf("source %s: %w", source.name(), err))
 		}
-		countSeries = append(countSeries, PromCountToDatadogCount(counterName, matrix)...)
+		// With BestEffortQueries, a failed source still yields its successful queries.
+		series = append(series, sourceSeries...)
+	}
+	if dropped := budget.overflow(); dropped > 0 {
+		w.logger().Warn("Cycle exceeded the maximum points, dropped the remainder; raise the limit or narrow the exported metrics",
+			"max_points", w.MaxPointsPerCycle, "dropped", dropped)
+		w.Metrics.addPointsDropped(dropReasonPointLimit, dropped)
+	}
+	if cancelled != nil {
+		if w.DrainTimeout <= 0 || len(series) == 0 {
+			return result, cancelled
+		}
+		sourceErrs = append(sourceErrs, cancelled)
+	}
+	if len(series) == 0 && len(sourceErrs) == len(w.sources()) {
+		return result, errors.Join(sourceErrs...)
 	}
-	log.Printf("Received %d rate series\n", len(rateSeries))
-	log.Printf("Received %d count series\n", len(countSeries))
 
-	log.Printf("Submitting to Datadog\n")
-	series := append(histogramSeries, rateSeries...)
-	series = append(series, countSeries...)
-	err = w.SubmitMetrics(series)
-	if err != nil {
-		errorChan <- err
-		return
+	if w.Deduplicate {
+		before, points := len(series), countPoints(series)
+		series = dedupSeries(series)
+		w.Metrics.addPointsDropped(dropReasonDedup, points-countPoints(series))
+		w.logger().Debug("Deduplicated series", "before", before, "after", len(series))
+	}
+	w.Metrics.addPointsDropped(dropReasonDuplicate, orderPoints(series))
+
+	if len(series) == 0 {
+		w.logger().Info("No series to submit, skipping submission")
+		result.Status = SubmissionSkipped
+		return result, errors.Join(sourceErrs...)
+	}
+
+	if w.Paused() {
+		w.logger().Warn("Submission paused, dropping the series of this cycle", "count", len(series))
+		result.Status = SubmissionPaused
+		return result, errors.Join(sourceErrs...)
 	}
-	log.Printf("Submitted total of %d series\n", len(series))
-	log.Printf("Awaits next tick (interval: %.0f seconds)\n", w.SleepDuration.Seconds())
-}
 
-func (w *Worker) calcRange() promapi.Range {
-	end := time.Now().Unix() / 60 * 60 // round seconds
-	star := end - int64(w.QueryWindow().Seconds())
-	stepSeconds := int64(w.StepDuration.Seconds())
+	if w.DryRun {
+		w.logDryRun(series, result.Series)
+		result.Status = SubmissionDryRun
+		return result, errors.Join(sourceErrs...)
+	}
 
-	// add padding
-	star = ((star / stepSeconds) - 1) * stepSeconds
-	end = ((end / stepSeconds) + 1) * stepSeconds
+	w.logger().Debug("Submitting series", "count", len(series))
+	if err := w.flush(ctx, series); err != nil {
+		w.Metrics.incSubmitErrors()
+		result.Status = SubmissionFailed
+		return result, errors.Join(append(sourceErrs, err)...)
+	}
+	submitted := time.Now()
+	w.status.recordSubmission(submitted)
+	w.Metrics.setLastSuccess(submitted)
+	for kind, n := range result.Series {
+		w.Metrics.addSeriesSubmitted(kind, n)
+	}
+	result.Submitted = len(series)
+	result.Status = SubmissionSucceeded
+	w.logger().Debug("Submitted series", "count", len(series))
+	return result, errors.Join(sourceErrs...)
+}
 
-	return promapi.Range{
-		Start: time.Unix(star, 0),
-		End:   time.Unix(end, 0),
-		Step:  w.StepDuration,
+func (w *Worker) logDryRun(series []datadogV2.MetricSeries, received map[string]int) {
+	w.logger().Info("Dry run: would submit series",
+		"count", len(series),
+		SeriesKindHistogram, received[SeriesKindHistogram],
+		SeriesKindRate, received[SeriesKindRate],
+		SeriesKindCount, received[SeriesKindCount],
+		SeriesKindGauge, received[SeriesKindGauge],
+		SeriesKindSummary, received[SeriesKindSummary],
+		SeriesKindAverage, received[SeriesKindAverage])
+	if !w.DryRunJSON {
+		return
+	}
+	for _, s := range series {
+		b, err := json.Marshal(s)
+		if err != nil {
+			w.logger().Error("Dry run: failed to marshal series", "metric", s.Metric, "error", err)
+			continue
+		}
+		w.logger().Info("Dry run: series", "series", string(b))
 	}
 }
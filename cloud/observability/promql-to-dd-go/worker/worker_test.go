@@ -0,0 +1,1208 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	promapi "github.com/prometheus/client_golang/api/prometheus/v1"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/temporalio/promql-to-dd-go/health"
+	"github.com/temporalio/promql-to-dd-go/prometheus"
+)
+
+type fakeQuerier struct {
+	listMetrics  func(ctx context.Context, metricPrefix string) (prometheus.MetricNames, error)
+	queryMetrics func(ctx context.Context, promql string, queryRange promapi.Range) (model.Matrix, error)
+	queryInstant func(ctx context.Context, promql string, ts time.Time) (model.Vector, error)
+}
+
+func (q *fakeQuerier) ListMetrics(ctx context.Context, metricPrefix string) (prometheus.MetricNames, error) {
+	return q.listMetrics(ctx, metricPrefix)
+}
+
+func (q *fakeQuerier) QueryMetrics(ctx context.Context, promql string, queryRange promapi.Range) (model.Matrix, error) {
+	return q.queryMetrics(ctx, promql, queryRange)
+}
+
+func (q *fakeQuerier) QueryInstant(ctx context.Context, promql string, ts time.Time) (model.Vector, error) {
+	return q.queryInstant(ctx, promql, ts)
+}
+
+type fakeSubmitter struct {
+	submitMetrics func(ctx context.Context, series []datadogV2.MetricSeries) error
+}
+
+func (s *fakeSubmitter) SubmitMetrics(ctx context.Context, series []datadogV2.MetricSeries) error {
+	return s.submitMetrics(ctx, series)
+}
+
+func TestWorkerListMetricsErrorIsRetried(t *testing.T) {
+	var calls atomic.Int32
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				calls.Add(1)
+				return prometheus.MetricNames{}, errors.New("prometheus unavailable")
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				t.Error("SubmitMetrics must not be called when ListMetrics fails")
+				return nil
+			},
+		},
+		StepDuration:     time.Minute,
+		QueryInterval:    10 * time.Minute,
+		SleepDuration:    time.Hour,
+		RetryBackoffBase: 10 * time.Millisecond,
+		RetryBackoffMax:  50 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop after context cancellation")
+	}
+	assert.GreaterOrEqual(t, calls.Load(), int32(2))
+}
+
+func TestWorkerGivesUpAfterMaxConsecutiveFailures(t *testing.T) {
+	var calls atomic.Int32
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				calls.Add(1)
+				return prometheus.MetricNames{}, errors.New("prometheus unavailable")
+			},
+		},
+		StepDuration:           time.Minute,
+		QueryInterval:          10 * time.Minute,
+		SleepDuration:          time.Hour,
+		RetryBackoffBase:       time.Millisecond,
+		RetryBackoffMax:        time.Millisecond,
+		MaxConsecutiveFailures: 3,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := w.Run(ctx)
+	require.ErrorIs(t, err, ErrTooManyFailures)
+	assert.ErrorContains(t, err, "prometheus unavailable")
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWorkerResetsFailuresOnSuccess(t *testing.T) {
+	// Fail, fail, succeed, fail, fail: never three failures in a row.
+	outcomes := []error{errors.New("boom"), errors.New("boom"), nil, errors.New("boom"), errors.New("boom")}
+	var calls atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				i := int(calls.Add(1)) - 1
+				if i >= len(outcomes) {
+					cancel()
+					return prometheus.MetricNames{}, context.Canceled
+				}
+				return prometheus.MetricNames{}, outcomes[i]
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		StepDuration:           time.Minute,
+		QueryInterval:          10 * time.Minute,
+		SleepDuration:          time.Millisecond,
+		RetryBackoffBase:       time.Millisecond,
+		RetryBackoffMax:        time.Millisecond,
+		MaxConsecutiveFailures: 3,
+	}
+
+	assert.NoError(t, w.Run(ctx))
+	assert.Equal(t, int32(len(outcomes)+1), calls.Load())
+}
+
+func TestWorkerSkipsSubmissionWithoutSeries(t *testing.T) {
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{
+					Histograms: []string{"temporal_cloud_v0_latency_bucket"},
+					Counters:   []string{"temporal_cloud_v0_requests_count"},
+				}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				t.Error("SubmitMetrics must not be called without series")
+				return nil
+			},
+		},
+		Quantiles:     []float64{0.99},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+	}
+
+	errs := make(chan error, 1)
+	w.do(context.Background(), errs)
+	assert.NoError(t, <-errs)
+}
+
+func TestWorkerRunOnce(t *testing.T) {
+	newWorker := func(submitErr error) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+				},
+				queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+					return model.Matrix{&model.SampleStream{Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(60), Value: 1}}}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return submitErr },
+			},
+			StepDuration:  time.Minute,
+			QueryInterval: 10 * time.Minute,
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		w := newWorker(nil)
+		require.NoError(t, w.RunOnce(context.Background()))
+		lastSuccess, lastFailure := w.LastCycle()
+		assert.False(t, lastSuccess.IsZero())
+		assert.True(t, lastFailure.IsZero())
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		errRejected := errors.New("rejected")
+		w := newWorker(errRejected)
+		assert.ErrorIs(t, w.RunOnce(context.Background()), errRejected)
+		lastSuccess, lastFailure := w.LastCycle()
+		assert.True(t, lastSuccess.IsZero())
+		assert.False(t, lastFailure.IsZero())
+	})
+}
+
+func TestWorkerQueryMetricsRespectsContext(t *testing.T) {
+	var calls atomic.Int32
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{
+					Histograms: []string{"temporal_cloud_v0_latency_bucket"},
+					Counters:   []string{"temporal_cloud_v0_frontend_service_request_count"},
+				}, nil
+			},
+			queryMetrics: func(ctx context.Context, _ string, _ promapi.Range) (model.Matrix, error) {
+				calls.Add(1)
+				_, hasDeadline := ctx.Deadline()
+				assert.True(t, hasDeadline)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				t.Error("SubmitMetrics must not be called after cancellation")
+				return nil
+			},
+		},
+		Quantiles:     []float64{0.5, 0.99},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 1)
+	w.do(ctx, errs)
+
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	default:
+		t.Fatal("expected do() to report the cancellation")
+	}
+	assert.Equal(t, int32(1), calls.Load(), "no further queries should be issued after cancellation")
+}
+
+func TestWorkerPromQLRateWindow(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rateWindow    time.Duration
+		wantHistogram string
+		wantRate      string
+	}{
+		{
+			name:          "default window",
+			wantHistogram: "histogram_quantile(0.95, sum(rate(latency_bucket[1m])) by (temporal_namespace,operation,le))",
+			wantRate:      "rate(requests_count[1m])",
+		},
+		{
+			name:          "custom window",
+			rateWindow:    2 * time.Minute,
+			wantHistogram: "histogram_quantile(0.95, sum(rate(latency_bucket[2m])) by (temporal_namespace,operation,le))",
+			wantRate:      "rate(requests_count[2m])",
+		},
+		{
+			name:          "mixed units",
+			rateWindow:    90 * time.Second,
+			wantHistogram: "histogram_quantile(0.95, sum(rate(latency_bucket[1m30s])) by (temporal_namespace,operation,le))",
+			wantRate:      "rate(requests_count[1m30s])",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			w := Worker{RateWindow: tc.rateWindow}
+			assert.Equal(t, tc.wantHistogram, w.histogramPromQL(0.95, "latency_bucket"))
+			assert.Equal(t, tc.wantRate, w.ratePromQL("requests_count"))
+		})
+	}
+}
+
+func TestWorkerHistogramAveragePromQL(t *testing.T) {
+	w := Worker{NamespaceDeny: []string{"load-test"}}
+	assert.Equal(t,
+		`label_replace(sum(rate(latency_sum{temporal_namespace!~"load-test"}[1m])) by (temporal_namespace,operation), "promql_to_dd_part", "sum", "", "")`+
+			` or `+
+			`label_replace(sum(rate(latency_count{temporal_namespace!~"load-test"}[1m])) by (temporal_namespace,operation), "promql_to_dd_part", "count", "", "")`,
+		w.histogramAveragePromQL("latency_bucket"))
+}
+
+func TestWorkerHistogramCountSum(t *testing.T) {
+	metrics := prometheus.ClassifyMetrics([]string{
+		"latency_bucket",
+		"latency_count",
+		"latency_sum",
+		"requests_count",
+		"pending_tasks",
+	})
+	require.Equal(t, []string{"latency_count", "requests_count"}, metrics.Counters)
+	require.Equal(t, []string{"latency_sum", "pending_tasks"}, metrics.Gauges)
+
+	promqls := func(w *Worker) map[string][]string {
+		byKind := map[string][]string{}
+		for _, q := range w.buildQueries(metrics, w.step()) {
+			byKind[q.kind] = append(byKind[q.kind], q.promql)
+		}
+		return byKind
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		got := promqls(&Worker{})
+		assert.Equal(t, []string{"latency_count", "requests_count"}, got[SeriesKindCount])
+		assert.Equal(t, []string{"rate(latency_count[1m])", "rate(requests_count[1m])"}, got[SeriesKindRate])
+		assert.Equal(t, []string{"latency_sum", "pending_tasks"}, got[SeriesKindGauge])
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		got := promqls(&Worker{HistogramCountSum: true})
+		assert.Equal(t, []string{"latency_count", "requests_count"}, got[SeriesKindCount], "latency_count must be queried once")
+		assert.Equal(t, []string{"rate(requests_count[1m])"}, got[SeriesKindRate])
+		assert.Equal(t, []string{"latency_sum", "pending_tasks"}, got[SeriesKindGauge], "latency_sum must be queried once")
+	})
+}
+
+func TestWorkerRateIntervalMatchesStep(t *testing.T) {
+	w := &Worker{StepDuration: 2 * time.Minute}
+	matrix := model.Matrix{&model.SampleStream{Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(120), Value: 1}, {Timestamp: model.TimeFromUnix(240), Value: 2}}}}
+	for _, q := range w.buildQueries(prometheus.MetricNames{Counters: []string{"requests_count"}}, w.step()) {
+		series := q.convert(matrix)
+		require.Len(t, series, 1)
+		if q.kind == SeriesKindRate {
+			assert.Equal(t, Ptr(int64(120)), series[0].Interval)
+		} else {
+			assert.Nil(t, series[0].Interval, q.kind)
+		}
+	}
+}
+
+func TestWorkerSplitsLongRanges(t *testing.T) {
+	var ranges []promapi.Range
+	w := Worker{
+		Querier: &fakeQuerier{
+			queryMetrics: func(_ context.Context, _ string, queryRange promapi.Range) (model.Matrix, error) {
+				ranges = append(ranges, queryRange)
+				values := []model.SamplePair{}
+				for ts := queryRange.Start; !ts.After(queryRange.End); ts = ts.Add(queryRange.Step) {
+					values = append(values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: 1})
+				}
+				return model.Matrix{
+					&model.SampleStream{Metric: model.Metric{"temporal_namespace": "a"}, Values: values},
+					&model.SampleStream{Metric: model.Metric{"temporal_namespace": "b"}, Values: values},
+				}, nil
+			},
+		},
+		MaxQuerySteps: 4,
+	}
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	queryRange := promapi.Range{Start: start, End: start.Add(9 * time.Minute), Step: time.Minute}
+	matrix, err := w.query(context.Background(), w.Querier, query{promql: "pending_tasks"}, queryRange)
+	require.NoError(t, err)
+
+	require.Len(t, ranges, 3)
+	for i := 1; i < len(ranges); i++ {
+		assert.Equal(t, ranges[i-1].End.Add(time.Minute), ranges[i].Start, "sub-ranges are contiguous")
+	}
+
+	require.Len(t, matrix, 2)
+	for _, stream := range matrix {
+		require.Len(t, stream.Values, 10, "no duplicate or missing point at the seams")
+		for i, pair := range stream.Values {
+			assert.Equal(t, start.Add(time.Duration(i)*time.Minute).Unix(), pair.Timestamp.Unix())
+		}
+	}
+}
+
+func TestWorkerDisableHistogramsAndCounters(t *testing.T) {
+	run := func(w *Worker) []string {
+		var mu sync.Mutex
+		queries := []string{}
+		w.Querier = &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{
+					Histograms: []string{"latency_bucket"},
+					Counters:   []string{"requests_count"},
+					Gauges:     []string{"pending_tasks"},
+				}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				queries = append(queries, promql)
+				return model.Matrix{}, nil
+			},
+		}
+		w.Submitter = &fakeSubmitter{submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil }}
+		w.StepDuration = time.Minute
+		require.NoError(t, w.RunOnce(context.Background()))
+		return queries
+	}
+	mentions := func(queries []string, metric string) bool {
+		for _, q := range queries {
+			if strings.Contains(q, metric) {
+				return true
+			}
+		}
+		return false
+	}
+
+	queries := run(&Worker{DisableHistograms: true, HistogramAverage: true, Quantiles: []float64{0.99}})
+	assert.False(t, mentions(queries, "latency_bucket"), "histograms issue no queries: %v", queries)
+	assert.True(t, mentions(queries, "requests_count"))
+	assert.True(t, mentions(queries, "pending_tasks"))
+
+	queries = run(&Worker{DisableCounters: true, Quantiles: []float64{0.99}})
+	assert.False(t, mentions(queries, "requests_count"), "counters issue no queries: %v", queries)
+	assert.True(t, mentions(queries, "latency_bucket"))
+	assert.True(t, mentions(queries, "pending_tasks"))
+}
+
+func TestWorkerDeriveCounterRates(t *testing.T) {
+	// A counter scraped every 15s whose per-second increase changes every five minutes.
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	perSecond := []float64{2, 0.5, 7, 3}
+	value := func(ts time.Time) float64 {
+		v := 0.0
+		for i := time.Duration(0); i < ts.Sub(start); i += time.Second {
+			v += perSecond[int(i/(5*time.Minute))%len(perSecond)]
+		}
+		return v
+	}
+	// promqlRate mimics rate(counter[1m]): the increase between the first and last samples of
+	// the window, extrapolated to the window.
+	promqlRate := func(ts time.Time) float64 {
+		first := ts.Add(-45 * time.Second)
+		return (value(ts) - value(first)) / 45
+	}
+
+	newWorker := func(derive bool, queries *[]string, submitted *[]datadogV2.MetricSeries) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Counters: []string{"requests_count"}}, nil
+				},
+				queryMetrics: func(_ context.Context, promql string, queryRange promapi.Range) (model.Matrix, error) {
+					*queries = append(*queries, promql)
+					values := []model.SamplePair{}
+					for ts := queryRange.Start; !ts.After(queryRange.End); ts = ts.Add(queryRange.Step) {
+						v := value(ts)
+						if strings.HasPrefix(promql, "rate(") {
+							v = promqlRate(ts)
+						}
+						values = append(values, model.SamplePair{Timestamp: model.TimeFromUnixNano(ts.UnixNano()), Value: model.SampleValue(v)})
+					}
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: values}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+					*submitted = series
+					return nil
+				},
+			},
+			StepDuration:       time.Minute,
+			DeriveCounterRates: derive,
+		}
+	}
+	rates := func(series []datadogV2.MetricSeries) map[int64]float64 {
+		points := map[int64]float64{}
+		for _, s := range series {
+			if s.Metric == "requests_rate1m" {
+				for _, p := range s.Points {
+					points[*p.Timestamp] = *p.Value
+				}
+			}
+		}
+		return points
+	}
+	queryRange := promapi.Range{Start: start.Add(time.Minute), End: start.Add(20 * time.Minute), Step: time.Minute}
+
+	var promqlQueries, derivedQueries []string
+	var promqlSeries, derivedSeries []datadogV2.MetricSeries
+	_, err := newWorker(false, &promqlQueries, &promqlSeries).process(context.Background(), queryRange)
+	require.NoError(t, err)
+	_, err = newWorker(true, &derivedQueries, &derivedSeries).process(context.Background(), queryRange)
+	require.NoError(t, err)
+
+	assert.Len(t, promqlQueries, 2)
+	assert.Equal(t, []string{"requests_count"}, derivedQueries, "a single query per counter")
+
+	want, got := rates(promqlSeries), rates(derivedSeries)
+	require.Len(t, got, len(want)-1, "the first point has no derived rate")
+	for ts, rate := range got {
+		assert.InDelta(t, want[ts], rate, 0.01*want[ts], "rate at %d", ts)
+	}
+}
+
+func TestWorkerHistogramGroupBy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		groupBy []string
+		want    string
+	}{
+		{
+			name: "default labels",
+			want: "histogram_quantile(0.99, sum(rate(latency_bucket[1m])) by (temporal_namespace,operation,le))",
+		},
+		{
+			name:    "custom labels",
+			groupBy: []string{"temporal_namespace", "task_queue", "worker_type"},
+			want:    "histogram_quantile(0.99, sum(rate(latency_bucket[1m])) by (temporal_namespace,task_queue,worker_type,le))",
+		},
+		{
+			name:    "le is not duplicated",
+			groupBy: []string{"le", "operation"},
+			want:    "histogram_quantile(0.99, sum(rate(latency_bucket[1m])) by (operation,le))",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			w := Worker{HistogramGroupBy: tc.groupBy}
+			assert.Equal(t, tc.want, w.histogramPromQL(0.99, "latency_bucket"))
+		})
+	}
+}
+
+func TestWorkerBoundedQueryConcurrency(t *testing.T) {
+	const limit = 3
+	var inFlight, maxInFlight, calls atomic.Int32
+	submitted := 0
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{
+					Histograms: []string{"a_bucket", "b_bucket", "c_bucket"},
+					Counters:   []string{"d_count", "e_count"},
+					Gauges:     []string{"f"},
+				}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				calls.Add(1)
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					m := maxInFlight.Load()
+					if n <= m || maxInFlight.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 2}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = len(series)
+				return nil
+			},
+		},
+		Quantiles:        []float64{0.5, 0.9, 0.99},
+		StepDuration:     time.Minute,
+		QueryInterval:    10 * time.Minute,
+		QueryConcurrency: limit,
+	}
+
+	errs := make(chan error, 1)
+	w.do(context.Background(), errs)
+
+	require.NoError(t, <-errs)
+	// 3 quantiles x 3 histograms + 2 queries per counter + 1 gauge
+	assert.Equal(t, int32(14), calls.Load())
+	assert.Equal(t, 14, submitted)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(limit))
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+}
+
+func TestWorkerFailureReportedByReadiness(t *testing.T) {
+	var fail atomic.Bool
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				if fail.Load() {
+					return prometheus.MetricNames{}, errors.New("prometheus unavailable")
+				}
+				return prometheus.MetricNames{Gauges: []string{"temporal_cloud_v0_pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		StepDuration:     time.Minute,
+		QueryInterval:    10 * time.Minute,
+		SleepDuration:    20 * time.Millisecond,
+		RetryBackoffBase: 10 * time.Millisecond,
+		RetryBackoffMax:  10 * time.Millisecond,
+	}
+	mux := http.NewServeMux()
+	health.RegisterHandlers(mux, &w, time.Minute)
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	require.Eventually(t, func() bool { return readyz() == http.StatusOK }, time.Second, 10*time.Millisecond)
+
+	fail.Store(true)
+	require.Eventually(t, func() bool { return readyz() == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond)
+}
+
+func TestWorkerSelfMetrics(t *testing.T) {
+	registry := promclient.NewRegistry()
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Histograms: []string{"latency_bucket"}, Counters: []string{"requests_count"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}, {Timestamp: 120_000, Value: 2}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		Quantiles:     []float64{0.5, 0.99},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		Metrics:       NewMetrics(registry),
+	}
+
+	errs := make(chan error, 1)
+	w.do(context.Background(), errs)
+	require.NoError(t, <-errs)
+
+	w.Submitter = &fakeSubmitter{
+		submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return errors.New("rejected") },
+	}
+	w.do(context.Background(), errs)
+	require.Error(t, <-errs)
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `exporter_queries_total{kind="histogram"} 4`)
+	assert.Contains(t, body, `exporter_queries_total{kind="rate"} 2`)
+	assert.Contains(t, body, `exporter_queries_total{kind="count"} 2`)
+	assert.Contains(t, body, `exporter_series_submitted_total{kind="histogram"} 2`)
+	assert.Contains(t, body, `exporter_series_submitted_total{kind="rate"} 1`)
+	assert.Contains(t, body, `exporter_series_submitted_total{kind="count"} 1`)
+	assert.Contains(t, body, `exporter_submit_errors_total 1`)
+	assert.Contains(t, body, `exporter_cycle_duration_seconds_count 2`)
+}
+
+func TestWorkerLastSubmission(t *testing.T) {
+	registry := promclient.NewRegistry()
+	var submitErr error
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return submitErr },
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		Metrics:       NewMetrics(registry),
+	}
+	lastSuccessGauge := func() string {
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if strings.HasPrefix(line, "exporter_last_success_timestamp_seconds ") {
+				return line
+			}
+		}
+		return ""
+	}
+	assert.True(t, w.LastSubmission().IsZero())
+
+	before := time.Now()
+	require.NoError(t, w.RunOnce(context.Background()))
+	last := w.LastSubmission()
+	assert.False(t, last.Before(before))
+	gauge := lastSuccessGauge()
+	assert.NotEqual(t, "exporter_last_success_timestamp_seconds 0", gauge)
+
+	submitErr = errors.New("rejected")
+	require.Error(t, w.RunOnce(context.Background()))
+	assert.Equal(t, last, w.LastSubmission(), "failed cycles do not update the timestamp")
+	assert.Equal(t, gauge, lastSuccessGauge())
+}
+
+func TestWorkerDryRunDoesNotSubmit(t *testing.T) {
+	var queries atomic.Int32
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{
+					Histograms: []string{"latency_bucket"},
+					Counters:   []string{"requests_count"},
+					Gauges:     []string{"pending_tasks"},
+				}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				queries.Add(1)
+				return model.Matrix{&model.SampleStream{
+					Metric: model.Metric{"temporal_namespace": "disneyland"},
+					Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(1257894000), Value: 1}},
+				}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error {
+				t.Error("SubmitMetrics must not be called in dry-run mode")
+				return nil
+			},
+		},
+		Quantiles:     []float64{0.5},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		DryRun:        true,
+		DryRunJSON:    true,
+	}
+
+	errs := make(chan error, 1)
+	w.do(context.Background(), errs)
+	require.NoError(t, <-errs)
+	assert.Equal(t, int32(4), queries.Load(), "the query pipeline should still run")
+}
+
+func TestWorkerQueryTimeout(t *testing.T) {
+	newWorker := func(abort bool, submitted *int) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Gauges: []string{"slow_gauge", "fast_gauge"}}, nil
+				},
+				queryMetrics: func(ctx context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+					if promql == "slow_gauge" {
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+					*submitted = len(series)
+					return nil
+				},
+			},
+			StepDuration:        time.Minute,
+			QueryInterval:       10 * time.Minute,
+			QueryTimeout:        20 * time.Millisecond,
+			AbortOnQueryTimeout: abort,
+		}
+	}
+
+	t.Run("skip timed out query", func(t *testing.T) {
+		submitted := 0
+		w := newWorker(false, &submitted)
+		result, err := w.Reconcile(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, submitted)
+		assert.True(t, w.coverage.end().IsZero(), "the range of the timed out query is queried again")
+		assert.Equal(t, result.Range.End, w.coverage.queryEnd(queryKey{promql: "fast_gauge"}))
+		assert.True(t, w.coverage.queryEnd(queryKey{promql: "slow_gauge"}).IsZero())
+	})
+
+	t.Run("abort on timeout", func(t *testing.T) {
+		submitted := 0
+		errs := make(chan error, 1)
+		newWorker(true, &submitted).do(context.Background(), errs)
+		assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+		assert.Equal(t, 0, submitted)
+	})
+}
+
+func TestWorkerBestEffortQueries(t *testing.T) {
+	newWorker := func(bestEffort bool, submitted *[]datadogV2.MetricSeries) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Gauges: []string{"pending_tasks", "malformed_gauge", "open_workflows"}}, nil
+				},
+				queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+					if promql == "malformed_gauge" {
+						return nil, errors.New("bad_data: parse error")
+					}
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+					*submitted = series
+					return nil
+				},
+			},
+			StepDuration:      time.Minute,
+			QueryInterval:     10 * time.Minute,
+			BestEffortQueries: bestEffort,
+		}
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		var submitted []datadogV2.MetricSeries
+		err := newWorker(false, &submitted).RunOnce(context.Background())
+		assert.ErrorContains(t, err, "parse error")
+		assert.Empty(t, submitted)
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		var submitted []datadogV2.MetricSeries
+		w := newWorker(true, &submitted)
+		err := w.RunOnce(context.Background())
+		assert.ErrorContains(t, err, "query malformed_gauge: bad_data: parse error", "the failure is still reported")
+
+		names := []string{}
+		for _, s := range submitted {
+			names = append(names, s.Metric)
+		}
+		assert.ElementsMatch(t, []string{"pending_tasks", "open_workflows"}, names)
+		assert.False(t, w.LastSubmission().IsZero())
+	})
+
+	t.Run("best effort submission failure", func(t *testing.T) {
+		var submitted []datadogV2.MetricSeries
+		w := newWorker(true, &submitted)
+		w.Submitter = &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return errors.New("rejected") },
+		}
+		err := w.RunOnce(context.Background())
+		assert.ErrorContains(t, err, "rejected")
+		assert.ErrorContains(t, err, "query malformed_gauge: bad_data: parse error", "the failed queries are still reported")
+	})
+}
+
+func TestWorkerBestEffortCoverage(t *testing.T) {
+	starts := map[string][]time.Time{}
+	fail := true
+	w := &Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks", "flaky_gauge"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, r promapi.Range) (model.Matrix, error) {
+				starts[promql] = append(starts[promql], r.Start)
+				if promql == "flaky_gauge" && fail {
+					return nil, errors.New("server_error: unavailable")
+				}
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		StepDuration:      time.Minute,
+		QueryInterval:     10 * time.Minute,
+		BestEffortQueries: true,
+	}
+
+	first, err := w.Reconcile(context.Background())
+	require.Error(t, err)
+	assert.True(t, w.coverage.end().IsZero(), "the range is not covered")
+
+	fail = false
+	second, err := w.Reconcile(context.Background())
+	require.NoError(t, err)
+	require.Len(t, starts["pending_tasks"], 2)
+	assert.Equal(t, first.Range.End.Add(-time.Minute), starts["pending_tasks"][1], "the succeeded query resumes after its submitted range")
+	assert.Equal(t, second.Range.Start, starts["flaky_gauge"][1], "the failed query is queried again")
+	assert.Equal(t, second.Range.End, w.coverage.end())
+	assert.Empty(t, w.coverage.queries, "the queries are covered by the range")
+}
+
+func TestWorkerMultipleSources(t *testing.T) {
+	newSource := func(name, metric string, fail bool) Source {
+		return Source{
+			Querier: &fakeQuerier{
+				listMetrics: func(_ context.Context, prefix string) (prometheus.MetricNames, error) {
+					if fail {
+						return prometheus.MetricNames{}, errors.New("unreachable")
+					}
+					assert.Equal(t, name+"_", prefix)
+					return prometheus.MetricNames{Gauges: []string{metric}}, nil
+				},
+				queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+				},
+			},
+			MetricPrefix: name + "_",
+			Tag:          "account:" + name,
+		}
+	}
+	var submitted []datadogV2.MetricSeries
+	w := Worker{
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+	}
+
+	t.Run("all sources submitted", func(t *testing.T) {
+		w.Sources = []Source{newSource("prod", "prod_pending_tasks", false), newSource("staging", "staging_pending_tasks", false)}
+		errs := make(chan error, 1)
+		w.do(context.Background(), errs)
+		require.NoError(t, <-errs)
+
+		require.Len(t, submitted, 2)
+		assert.Equal(t, "prod_pending_tasks", submitted[0].Metric)
+		assert.Equal(t, []string{"account:prod"}, submitted[0].Tags)
+		assert.Equal(t, "staging_pending_tasks", submitted[1].Metric)
+		assert.Equal(t, []string{"account:staging"}, submitted[1].Tags)
+	})
+
+	t.Run("failing source does not abort the others", func(t *testing.T) {
+		submitted = nil
+		w.Sources = []Source{newSource("prod", "prod_pending_tasks", true), newSource("staging", "staging_pending_tasks", false)}
+		errs := make(chan error, 1)
+		w.do(context.Background(), errs)
+		assert.ErrorContains(t, <-errs, "source prod_")
+
+		require.Len(t, submitted, 1)
+		assert.Equal(t, "staging_pending_tasks", submitted[0].Metric)
+	})
+}
+
+func TestWorkerMultipleMetricPrefixes(t *testing.T) {
+	var submitted []datadogV2.MetricSeries
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(_ context.Context, prefix string) (prometheus.MetricNames, error) {
+				if prefix == "temporal_cloud_v1_" {
+					return prometheus.MetricNames{}, errors.New("unreachable")
+				}
+				return prometheus.MetricNames{Gauges: []string{prefix + "pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		MetricPrefix:  "ignored_",
+		PrefixTag:     "prefix",
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+	}
+
+	t.Run("all prefixes submitted", func(t *testing.T) {
+		w.MetricPrefixes = []string{"temporal_cloud_v0_", "temporal_cloud_"}
+		errs := make(chan error, 1)
+		w.do(context.Background(), errs)
+		require.NoError(t, <-errs)
+
+		require.Len(t, submitted, 2)
+		assert.Equal(t, "temporal_cloud_v0_pending_tasks", submitted[0].Metric)
+		assert.Equal(t, []string{"prefix:temporal_cloud_v0_"}, submitted[0].Tags)
+		assert.Equal(t, "temporal_cloud_pending_tasks", submitted[1].Metric)
+		assert.Equal(t, []string{"prefix:temporal_cloud_"}, submitted[1].Tags)
+	})
+
+	t.Run("failing prefix does not abort the others", func(t *testing.T) {
+		submitted = nil
+		w.MetricPrefixes = []string{"temporal_cloud_v1_", "temporal_cloud_v0_"}
+		errs := make(chan error, 1)
+		w.do(context.Background(), errs)
+		assert.ErrorContains(t, <-errs, "source temporal_cloud_v1_")
+
+		require.Len(t, submitted, 1)
+		assert.Equal(t, "temporal_cloud_v0_pending_tasks", submitted[0].Metric)
+	})
+}
+
+func TestWorkerQueryWindow(t *testing.T) {
+	testCases := []struct {
+		name          string
+		overlapFactor float64
+		want          time.Duration
+	}{
+		{name: "default", want: 12 * time.Minute},
+		{name: "no overlap", overlapFactor: 1, want: 10 * time.Minute},
+		{name: "half overlap", overlapFactor: 1.5, want: 15 * time.Minute},
+		{name: "double", overlapFactor: 2, want: 20 * time.Minute},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			w := Worker{QueryInterval: 10 * time.Minute, OverlapFactor: tc.overlapFactor}
+			assert.Equal(t, tc.want, w.QueryWindow())
+		})
+	}
+}
+
+func TestValidateOverlapFactor(t *testing.T) {
+	assert.NoError(t, ValidateOverlapFactor(0))
+	assert.NoError(t, ValidateOverlapFactor(1))
+	assert.NoError(t, ValidateOverlapFactor(1.2))
+	assert.ErrorContains(t, ValidateOverlapFactor(0.8), "at least 1")
+	assert.ErrorContains(t, ValidateOverlapFactor(math.NaN()), "at least 1")
+}
+
+func TestWorkerCheckConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		step          time.Duration
+		queryInterval time.Duration
+		wantWarning   string
+	}{
+		{name: "valid", step: time.Minute, queryInterval: 10 * time.Minute},
+		{name: "step larger than window", step: time.Hour, queryInterval: 10 * time.Minute, wantWarning: "Step duration is larger than the query window"},
+		{name: "window not a multiple of step", step: 7 * time.Minute, queryInterval: 10 * time.Minute, wantWarning: "Query window is not a multiple of the step duration"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			w := &Worker{
+				StepDuration:  tc.step,
+				QueryInterval: tc.queryInterval,
+				Logger:        slog.New(slog.NewTextHandler(&buf, nil)),
+			}
+			w.checkConfig()
+			if tc.wantWarning == "" {
+				assert.Empty(t, buf.String())
+				return
+			}
+			assert.Contains(t, buf.String(), "level=WARN")
+			assert.Contains(t, buf.String(), tc.wantWarning)
+		})
+	}
+}
+
+func TestWorkerLogLevels(t *testing.T) {
+	newWorker := func(level slog.Level, buf *bytes.Buffer) *Worker {
+		return &Worker{
+			Querier: &fakeQuerier{
+				listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+					return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+				},
+				queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+					return model.Matrix{&model.SampleStream{Metric: model.Metric{}, Values: []model.SamplePair{{Timestamp: 60_000, Value: 1}}}}, nil
+				},
+			},
+			Submitter: &fakeSubmitter{
+				submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return errors.New("rejected") },
+			},
+			StepDuration:     time.Minute,
+			QueryInterval:    10 * time.Minute,
+			SleepDuration:    time.Hour,
+			RetryBackoffBase: time.Hour,
+			Logger:           slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: level})),
+		}
+	}
+	runOnce := func(w *Worker) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+		require.Eventually(t, func() bool { _, lastFailure := w.LastCycle(); return !lastFailure.IsZero() }, time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+	}
+
+	t.Run("info hides per-cycle lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		runOnce(newWorker(slog.LevelInfo, &buf))
+		out := buf.String()
+		assert.NotContains(t, out, `"level":"DEBUG"`)
+		assert.Contains(t, out, `"level":"ERROR","msg":"Worker failed","error":"rejected"`)
+		assert.Contains(t, out, `"msg":"Worker has been stopped"`)
+	})
+
+	t.Run("debug includes structured per-cycle lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		runOnce(newWorker(slog.LevelDebug, &buf))
+		out := buf.String()
+		assert.Contains(t, out, `"level":"DEBUG","msg":"Found gauge metrics","source":"","count":1`)
+		assert.Contains(t, out, `"level":"DEBUG","msg":"Received series","source":"","kind":"gauge","count":1`)
+		assert.Contains(t, out, `"level":"ERROR","msg":"Worker failed"`)
+	})
+
+	t.Run("error hides informational lines", func(t *testing.T) {
+		var buf bytes.Buffer
+		runOnce(newWorker(slog.LevelError, &buf))
+		out := buf.String()
+		assert.Contains(t, out, `"msg":"Worker failed"`)
+		assert.NotContains(t, out, `"msg":"Worker has been stopped"`)
+	})
+}
+
+func TestWorkerCachedMetricList(t *testing.T) {
+	var listCalls atomic.Int32
+	w := Worker{
+		Querier: prometheus.NewCachingQuerier(&fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				listCalls.Add(1)
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(context.Context, string, promapi.Range) (model.Matrix, error) {
+				return model.Matrix{}, nil
+			},
+		}, time.Hour),
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(context.Context, []datadogV2.MetricSeries) error { return nil },
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+	}
+
+	errs := make(chan error, 1)
+	for i := 0; i < 3; i++ {
+		w.do(context.Background(), errs)
+		require.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(1), listCalls.Load())
+}
+
+func TestWorkerInstantGauges(t *testing.T) {
+	var submitted []datadogV2.MetricSeries
+	var instantAt time.Time
+	w := Worker{
+		Querier: &fakeQuerier{
+			listMetrics: func(context.Context, string) (prometheus.MetricNames, error) {
+				return prometheus.MetricNames{Gauges: []string{"pending_tasks"}}, nil
+			},
+			queryMetrics: func(_ context.Context, promql string, _ promapi.Range) (model.Matrix, error) {
+				t.Errorf("unexpected range query %s", promql)
+				return model.Matrix{}, nil
+			},
+			queryInstant: func(_ context.Context, promql string, ts time.Time) (model.Vector, error) {
+				assert.Equal(t, "pending_tasks", promql)
+				instantAt = ts
+				return model.Vector{
+					&model.Sample{Metric: model.Metric{"temporal_namespace": "disneyland"}, Value: 42, Timestamp: model.TimeFromUnix(ts.Unix())},
+					&model.Sample{Metric: model.Metric{"temporal_namespace": "tomorrowland"}, Value: model.SampleValue(math.NaN()), Timestamp: model.TimeFromUnix(ts.Unix())},
+				}, nil
+			},
+		},
+		Submitter: &fakeSubmitter{
+			submitMetrics: func(_ context.Context, series []datadogV2.MetricSeries) error {
+				submitted = series
+				return nil
+			},
+		},
+		StepDuration:  time.Minute,
+		QueryInterval: 10 * time.Minute,
+		InstantGauges: true,
+	}
+
+	result, err := w.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, result.Range.End, instantAt, "evaluated at the end of the range")
+	require.Len(t, submitted, 1, "non-finite samples are dropped")
+	assert.Equal(t, "pending_tasks", submitted[0].Metric)
+	assert.Equal(t, datadogV2.METRICINTAKETYPE_GAUGE, submitted[0].GetType())
+	require.Len(t, submitted[0].Points, 1)
+	assert.Equal(t, instantAt.Unix(), submitted[0].Points[0].GetTimestamp())
+	assert.Equal(t, 42.0, submitted[0].Points[0].GetValue())
+	assert.Equal(t, "disneyland", submitted[0].Resources[0].GetName())
+}